@@ -3,4 +3,5 @@ package config
 type AuthConfig struct {
     AccessSecret    string      `json:"access_secret"`
     RefreshSecret   string      `json:"refreshSecret"`
+    RevocationStore string      `json:"revocation_store"`
 }
@@ -0,0 +1,47 @@
+package config
+
+type ChatConfig struct {
+    AllowedOrigins  []string        `json:"allowed_origins"`
+    Broker          string          `json:"broker"`
+    EditWindow      string          `json:"edit_window"`
+    Redis           RedisConfig     `json:"redis"`
+    Push            PushConfig      `json:"push"`
+    RateLimit       RateLimitConfig `json:"rate_limit"`
+}
+
+type RedisConfig struct {
+    Addr            string      `json:"addr"`
+    Password        string      `json:"password"`
+    ChannelPrefix   string      `json:"channel_prefix"`
+}
+
+// 사용자별, 채팅방별로 초마다 보낼 수 있는 메시지 수와 한 번에 몰아 보낼 수 있는 수
+// 비어 있으면 기본값을 쓴다.
+type RateLimitConfig struct {
+    UserPerSecond       float64 `json:"user_per_second"`
+    UserBurst           int     `json:"user_burst"`
+    ChatroomPerSecond   float64 `json:"chatroom_per_second"`
+    ChatroomBurst       int     `json:"chatroom_burst"`
+}
+
+// project_id나 key_id가 비어 있으면 그 플랫폼에는 알림을 보내지 않는다.
+type PushConfig struct {
+    CollapseWindow  string      `json:"collapse_window"`
+    FCM             FCMConfig   `json:"fcm"`
+    APNs            APNsConfig  `json:"apns"`
+}
+
+// credentials_path는 Firebase 콘솔에서 받은 서비스 계정 키 파일이다.
+type FCMConfig struct {
+    Endpoint        string      `json:"endpoint"`
+    ProjectID       string      `json:"project_id"`
+    CredentialsPath string      `json:"credentials_path"`
+}
+
+type APNsConfig struct {
+    Endpoint        string      `json:"endpoint"`
+    Topic           string      `json:"topic"`
+    KeyID           string      `json:"key_id"`
+    TeamID          string      `json:"team_id"`
+    PrivateKeyPath  string      `json:"private_key_path"`
+}
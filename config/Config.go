@@ -1,6 +1,7 @@
 package config
 
 import (
+	"carrot-market-clone-api/utils/push"
 	"encoding/json"
 	"os"
 	"time"
@@ -20,6 +21,7 @@ type Config struct {
     AWSConfig       AWSConfig       `json:"aws"`
     LogConfig       LogConfig       `json:"log"`
     AuthConfig      AuthConfig      `json:"auth"`
+    ChatConfig      ChatConfig      `json:"chat"`
 }
 
 func LoadConfig() (*Config, error){
@@ -74,3 +76,28 @@ func (c *Config) InitAuth() {
     os.Setenv("ACCESS_SECRET", c.AuthConfig.AccessSecret)
     os.Setenv("REFRESH_SECRET", c.AuthConfig.RefreshSecret)
 }
+
+func (c *Config) InitNotifiers() (push.Notifiers, error) {
+    notifiers := push.Notifiers{}
+
+    fcm := c.ChatConfig.Push.FCM
+    if fcm.ProjectID != "" {
+        credentials, err := os.ReadFile(fcm.CredentialsPath)
+        if err != nil { return nil, err }
+
+        tokenSource, err := push.NewServiceAccountTokenSource(credentials)
+        if err != nil { return nil, err }
+        notifiers[push.PlatformAndroid] = push.NewFCMNotifier(fcm.Endpoint, fcm.ProjectID, tokenSource.Token)
+    }
+
+    apns := c.ChatConfig.Push.APNs
+    if apns.KeyID != "" {
+        privateKey, err := os.ReadFile(apns.PrivateKeyPath)
+        if err != nil { return nil, err }
+
+        notifier, err := push.NewAPNsNotifier(apns.Endpoint, apns.Topic, apns.KeyID, apns.TeamID, privateKey)
+        if err != nil { return nil, err }
+        notifiers[push.PlatformIOS] = notifier
+    }
+    return notifiers, nil
+}
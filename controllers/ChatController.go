@@ -1,10 +1,21 @@
 package controllers
 
 import (
+	"bytes"
+	"carrot-market-clone-api/middlewares"
+	"carrot-market-clone-api/models"
 	"carrot-market-clone-api/models/chat"
 	"carrot-market-clone-api/services"
+	"carrot-market-clone-api/utils/transcript"
+	"encoding/json"
+	"fmt"
+	"log"
+	"mime/multipart"
 	"net/http"
+	"net/url"
+	"os"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
@@ -14,29 +25,74 @@ import (
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
+	Subprotocols:    []string{middlewares.SocketTokenProtocol},
+	CheckOrigin:     checkOrigin,
+}
+
+// Origin 헤더가 없는 요청(모바일 앱 등)은 허용하고,
+// 브라우저 요청은 CHAT_ALLOWED_ORIGINS에 등록된 origin만 허용한다.
+// 목록이 비어 있으면 같은 origin만 허용하고, "*"는 모든 origin을 허용한다.
+func checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	allowed := strings.Split(os.Getenv("CHAT_ALLOWED_ORIGINS"), ",")
+	for _, o := range allowed {
+		o = strings.TrimSpace(o)
+		if o == "*" || strings.EqualFold(o, origin) {
+			return true
+		}
+	}
+
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
 }
 
 type ChatController interface {
 	CreateConnection(c *gin.Context)
+	CreateEventStream(c *gin.Context)
+	SendChat(c *gin.Context)
 	CreateChatroom(c *gin.Context)
 	GetChatroom(c *gin.Context)
 	GetChatrooms(c *gin.Context)
+	SearchChats(c *gin.Context)
+	GetProductChatrooms(c *gin.Context)
+	LeaveChatroom(c *gin.Context)
+	UpdateChatroomSettings(c *gin.Context)
 	GetChats(c *gin.Context)
+	ReadChats(c *gin.Context)
+	SendImage(c *gin.Context)
+	SyncChats(c *gin.Context)
+	EditChat(c *gin.Context)
+	UnsendChat(c *gin.Context)
+	ExportChats(c *gin.Context)
+	ExportChatsAdmin(c *gin.Context)
+	GetReplyTemplates(c *gin.Context)
+	InsertReplyTemplate(c *gin.Context)
+	UpdateReplyTemplate(c *gin.Context)
+	DeleteReplyTemplate(c *gin.Context)
+	GetAwayMode(c *gin.Context)
+	UpdateAwayMode(c *gin.Context)
 }
 
 type ChatControllerImpl struct {
-	chatService services.ChatService
-	chatHub     chat.ChatHub
+	chatService  services.ChatService
+	replyService services.ReplyService
+	chatHub      *chat.ChatHub
 }
 
 func NewChatControllerImpl(
 	chatService services.ChatService,
-	chatHub chat.ChatHub,
+	replyService services.ReplyService,
+	chatHub *chat.ChatHub,
 ) ChatController {
 	go chatHub.Run()
 	return &ChatControllerImpl{
-		chatService: chatService,
-		chatHub:     chatHub,
+		chatService:  chatService,
+		replyService: replyService,
+		chatHub:      chatHub,
 	}
 }
 
@@ -44,7 +100,6 @@ func NewChatControllerImpl(
 func (t *ChatControllerImpl) CreateConnection(c *gin.Context) {
 	userId := c.Param("userId")
 
-	upgrader.CheckOrigin = func(r *http.Request) bool { return true }
 	w := c.Writer
 	r := c.Request
 	conn, err := upgrader.Upgrade(w, r, nil)
@@ -53,18 +108,130 @@ func (t *ChatControllerImpl) CreateConnection(c *gin.Context) {
 		return
 	}
 
-	t.chatHub.Register <- &chat.Client{
-		UserID:    userId,
-		Chatrooms: make(map[int]*chat.Chatroom),
-		Send:      make(chan chat.Chat),
-		Conn:      conn,
-		Hub:       &t.chatHub,
+	client := chat.NewClient(userId, conn, t.chatHub)
+	if err := t.chatHub.Register(client); err != nil {
+		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseInternalServerErr, ""))
+		conn.Close()
+		return
+	}
+
+	go client.WritePump()
+	go client.ReadPump()
+}
+
+// 채팅방을 만들면서 보내는 첫 메시지
+type ChatroomCreateForm struct {
+	Message *ChatMessageForm `json:"message"`
+}
+
+// REST API로 보내는 메시지. 소켓과 마찬가지로 TEXT와 LOCATION만 보낼 수 있다.
+type ChatMessageForm struct {
+	Type        models.ChatType `json:"type"`
+	Content     string          `json:"content"`
+	Payload     json.RawMessage `json:"payload"`
+	ClientMsgID *string         `json:"clientMsgId"`
+}
+
+// IMAGE와 SYSTEM 메시지는 보낼 수 없으므로 ok가 false이다.
+func (f *ChatMessageForm) toChat() (chat *models.Chat, ok bool) {
+	if f.Type != "" && f.Type != models.TEXT && f.Type != models.LOCATION {
+		return nil, false
+	}
+	return &models.Chat{
+		Type:        f.Type,
+		Content:     f.Content,
+		Payload:     f.Payload,
+		ClientMsgID: f.ClientMsgID,
+	}, true
+}
+
+// GET /api/v1/users/{userId}/chat/events
+// WebSocket을 쓸 수 없는 환경을 위한 Server-Sent Events 연결. 소켓과 같은 프레임을 data 이벤트로 받는다.
+// 메시지는 POST /api/v1/users/{userId}/chatrooms/{chatroomId}/chats로 보낸다.
+func (t *ChatControllerImpl) CreateEventStream(c *gin.Context) {
+	userId := c.Param("userId")
+
+	client := chat.NewClient(userId, nil, t.chatHub)
+	if err := t.chatHub.Register(client); err != nil {
+		c.JSON(400, gin.H{"message": "연결을 생성하지 못했습니다."})
+		return
 	}
 
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
 	c.Status(200)
+	c.Writer.Flush()
+
+	client.EventPump(c.Writer, c.Request.Context().Done())
+}
+
+// POST /api/v1/users/{userId}/chatrooms/{chatroomId}/chats
+// 소켓의 chat 프레임과 같이 메시지를 저장하고 채팅방에 전달한다. 같은 clientMsgId로 다시 보내면 저장된 메시지를 돌려준다.
+func (t *ChatControllerImpl) SendChat(c *gin.Context) {
+	userId := c.Param("userId")
+	chatroomId, err := strconv.Atoi(c.Param("chatroomId"))
+
+	if err != nil {
+		c.JSON(400, gin.H{"message": "chatroomdId는 정수값이어야 합니다."})
+		return
+	}
+
+	if ok := t.chatService.CheckCorrectUser(userId, chatroomId); !ok {
+		c.JSON(403, gin.H{"message": "접근 권한이 없습니다"})
+		return
+	}
+
+	form := ChatMessageForm{}
+	if err := c.ShouldBindJSON(&form); err != nil {
+		c.JSON(400, gin.H{"message": err.Error()})
+		return
+	}
+
+	message, ok := form.toChat()
+	if !ok {
+		c.JSON(400, gin.H{"message": services.ErrInvalidChat.Error()})
+		return
+	}
+	message.ChatroomID = chatroomId
+
+	if !t.chatHub.AllowChat(userId, chatroomId) {
+		c.JSON(429, gin.H{"message": chat.RateLimitedMessage})
+		return
+	}
+
+	duplicate, err := t.chatService.InsertChat(userId, message)
+	if err == services.ErrInvalidChat || err == services.ErrChatTooLong {
+		c.JSON(400, gin.H{"message": err.Error()})
+		return
+	}
+
+	if err == services.ErrCounterpartLeft {
+		c.JSON(409, gin.H{"message": err.Error()})
+		return
+	}
+
+	if err != nil {
+		c.JSON(400, gin.H{"message": err})
+		return
+	}
+
+	if duplicate {
+		c.JSON(200, message)
+		return
+	}
+
+	if err := t.chatHub.PublishChat(userId, message); err != nil {
+		log.Println(err)
+	}
+
+	c.JSON(201, message)
 }
 
 // POST /api/v1/users/{userId}/products/{productId}/chatrooms
+// message를 보내면 채팅방과 첫 메시지를 함께 저장한다. 새 채팅방은 접속 중인 판매자에게 바로 전달된다.
+// 판매자가 자리 비움 모드이면 새 채팅방에 자동 응답을 보낸다.
 func (t *ChatControllerImpl) CreateChatroom(c *gin.Context) {
 	userId := c.Param("userId")
 	productId, err := strconv.Atoi(c.Param("productId"))
@@ -74,7 +241,30 @@ func (t *ChatControllerImpl) CreateChatroom(c *gin.Context) {
 		return
 	}
 
-	chatroomId, err := t.chatService.CreateChatroom(productId, userId)
+	form := ChatroomCreateForm{}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&form); err != nil {
+			c.JSON(400, gin.H{"message": err.Error()})
+			return
+		}
+	}
+
+	var message *models.Chat
+	if form.Message != nil {
+		var ok bool
+		if message, ok = form.Message.toChat(); !ok {
+			c.JSON(400, gin.H{"message": services.ErrInvalidChat.Error()})
+			return
+		}
+
+		// 여러 판매자에게 같은 첫 메시지를 보내는 것도 막도록 채팅방이 아직 없으면 사용자 단위로 제한한다.
+		if !t.chatHub.AllowChat(userId, t.chatService.GetProductChatroomId(productId, userId)) {
+			c.JSON(429, gin.H{"message": chat.RateLimitedMessage})
+			return
+		}
+	}
+
+	chatroomId, created, duplicate, err := t.chatService.CreateChatroom(productId, userId, message)
 
 	if err == gorm.ErrInvalidValue {
 		c.JSON(403, gin.H{"message": "본인과 채팅할 수 없습니다."})
@@ -86,15 +276,70 @@ func (t *ChatControllerImpl) CreateChatroom(c *gin.Context) {
 		return
 	}
 
+	if err == services.ErrInvalidChat || err == services.ErrChatTooLong {
+		c.JSON(400, gin.H{"message": err.Error()})
+		return
+	}
+
+	if err == services.ErrCounterpartLeft {
+		c.JSON(409, gin.H{"message": err.Error()})
+		return
+	}
+
 	if err != nil {
 		c.JSON(400, gin.H{"message": err})
 		return
 	}
 
-	c.JSON(201, gin.H{"chatroomId": chatroomId})
+	if userIds, err := t.chatService.GetChatroomUserIds(chatroomId); err != nil {
+		log.Println(err)
+	} else {
+		t.openChatroom(chatroomId, userId, userIds, created)
+	}
+
+	if message != nil && !duplicate {
+		if err := t.chatHub.PublishChat(userId, message); err != nil {
+			log.Println(err)
+		}
+	}
+
+	if created {
+		t.chatHub.SendAwayReply(chatroomId, userId)
+	}
+
+	response := gin.H{"chatroomId": chatroomId}
+	if message != nil {
+		response["chat"] = message
+	}
+	c.JSON(201, response)
 
 }
 
+// 접속 중인 참여자들을 채팅방에 참여시키고, 새로 만든 채팅방이면 상대방에게 보낸다.
+func (t *ChatControllerImpl) openChatroom(chatroomId int, userId string, userIds []string, created bool) {
+	var (
+		recipientId string
+		chatroom    *models.Chatroom
+	)
+	if created {
+		for _, id := range userIds {
+			if id != userId {
+				recipientId = id
+			}
+		}
+
+		var err error
+		if chatroom, err = t.chatService.GetChatroom(chatroomId, recipientId); err != nil {
+			log.Println(err)
+			chatroom = nil
+		}
+	}
+
+	if err := t.chatHub.Open(chatroomId, userIds, recipientId, chatroom); err != nil {
+		log.Println(err)
+	}
+}
+
 // Done
 // GET /api/v1/users/{userId}/chatrooms/{chatroomId}
 func (t *ChatControllerImpl) GetChatroom(c *gin.Context) {
@@ -111,7 +356,7 @@ func (t *ChatControllerImpl) GetChatroom(c *gin.Context) {
 		return
 	}
 
-	chatroom, err := t.chatService.GetChatroom(chatroomId)
+	chatroom, err := t.chatService.GetChatroom(chatroomId, userId)
 
 	if err != nil {
 		c.JSON(400, gin.H{"message": err})
@@ -124,32 +369,29 @@ func (t *ChatControllerImpl) GetChatroom(c *gin.Context) {
 
 // Done
 // GET /api/v1/users/{userId}/chatrooms
+// 마지막 메시지가 최근인 채팅방부터 가져온다. 다음 페이지는 응답의 nextCursor를 cursor로 보내 요청한다.
+// archived=true이면 보관한 채팅방만 가져온다. 첫 페이지에는 고정한 채팅방이 먼저 온다.
 func (t *ChatControllerImpl) GetChatrooms(c *gin.Context) {
 	userId := c.Param("userId")
-	var (
-		err  error
-		last *int
-		size int
-	)
 
-	size, err = strconv.Atoi(c.DefaultQuery("size", "10"))
+	size, err := strconv.Atoi(c.DefaultQuery("size", strconv.Itoa(services.DefaultChatroomSize)))
 	if err != nil {
 		c.JSON(400, gin.H{"message": err})
 		return
 	}
 
-	if lastStr, lastExists := c.GetQuery("last"); lastExists {
-		temp, err := strconv.Atoi(lastStr)
-		if err != nil {
-			c.JSON(400, gin.H{"message": err})
-			return
-		}
-		last = &temp
-	} else {
-		last = nil
+	archived, err := strconv.ParseBool(c.DefaultQuery("archived", "false"))
+	if err != nil {
+		c.JSON(400, gin.H{"message": "archived는 true 또는 false여야 합니다."})
+		return
+	}
+
+	chatrooms, nextCursor, err := t.chatService.GetChatrooms(userId, c.Query("cursor"), size, archived)
+	if err == services.ErrInvalidCursor {
+		c.JSON(400, gin.H{"message": err.Error()})
+		return
 	}
 
-	chatrooms, count, err := t.chatService.GetChatrooms(userId, last, size)
 	if err == gorm.ErrRecordNotFound {
 		c.JSON(404, gin.H{"message": err})
 		return
@@ -161,12 +403,150 @@ func (t *ChatControllerImpl) GetChatrooms(c *gin.Context) {
 	}
 
 	c.JSON(200, gin.H{
-		"chatrooms": chatrooms,
-		"size":      count,
-		"userId":    userId,
+		"chatrooms":  chatrooms,
+		"size":       len(chatrooms),
+		"userId":     userId,
+		"nextCursor": nextCursor,
 	})
 }
 
+// GET /api/v1/users/{userId}/chatrooms/search?keyword={keyword}
+// 참여 중인 채팅방의 메시지에서 keyword를 찾는다. 다음 페이지는 응답의 nextCursor를 cursor로 보내 요청한다.
+func (t *ChatControllerImpl) SearchChats(c *gin.Context) {
+	userId := c.Param("userId")
+
+	size, err := strconv.Atoi(c.DefaultQuery("size", strconv.Itoa(services.DefaultSearchSize)))
+	if err != nil {
+		c.JSON(400, gin.H{"message": err})
+		return
+	}
+
+	results, nextCursor, err := t.chatService.SearchChats(userId, c.Query("keyword"), c.Query("cursor"), size)
+	if err == services.ErrInvalidKeyword || err == services.ErrInvalidCursor {
+		c.JSON(400, gin.H{"message": err.Error()})
+		return
+	}
+
+	if err != nil {
+		c.JSON(400, gin.H{"message": err})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"results":    results,
+		"size":       len(results),
+		"userId":     userId,
+		"nextCursor": nextCursor,
+	})
+}
+
+// GET /api/v1/users/{userId}/products/{productId}/chatrooms
+// 판매자 본인의 상품에 대한 구매자별 채팅방을 마지막 메시지가 최근인 순서로 가져온다.
+func (t *ChatControllerImpl) GetProductChatrooms(c *gin.Context) {
+	userId := c.Param("userId")
+	productId, err := strconv.Atoi(c.Param("productId"))
+
+	if err != nil {
+		c.JSON(400, gin.H{"message": "productId는 정수값이어야 합니다."})
+		return
+	}
+
+	size, err := strconv.Atoi(c.DefaultQuery("size", strconv.Itoa(services.DefaultChatroomSize)))
+	if err != nil {
+		c.JSON(400, gin.H{"message": err})
+		return
+	}
+
+	chatrooms, nextCursor, err := t.chatService.GetProductChatrooms(productId, userId, c.Query("cursor"), size)
+	if err == gorm.ErrRecordNotFound {
+		c.JSON(404, gin.H{"message": "존재하지 않는 상품입니다."})
+		return
+	}
+
+	if err == services.ErrNotProductOwner {
+		c.JSON(403, gin.H{"message": err.Error()})
+		return
+	}
+
+	if err == services.ErrInvalidCursor {
+		c.JSON(400, gin.H{"message": err.Error()})
+		return
+	}
+
+	if err != nil {
+		c.JSON(400, gin.H{"message": err})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"chatrooms":  chatrooms,
+		"size":       len(chatrooms),
+		"productId":  productId,
+		"nextCursor": nextCursor,
+	})
+}
+
+// DELETE /api/v1/users/{userId}/chatrooms/{chatroomId}
+// 채팅방을 나간다. 상대방에게는 나갔다는 메시지가 전달된다.
+func (t *ChatControllerImpl) LeaveChatroom(c *gin.Context) {
+	userId := c.Param("userId")
+	chatroomId, err := strconv.Atoi(c.Param("chatroomId"))
+
+	if err != nil {
+		c.JSON(400, gin.H{"message": "chatroomdId는 정수값이어야 합니다."})
+		return
+	}
+
+	if ok := t.chatService.CheckCorrectUser(userId, chatroomId); !ok {
+		c.JSON(403, gin.H{"message": "접근 권한이 없습니다"})
+		return
+	}
+
+	chat, err := t.chatService.LeaveChatroom(chatroomId, userId)
+	if err != nil {
+		c.JSON(400, gin.H{"message": err})
+		return
+	}
+
+	t.chatHub.Leave(chatroomId, userId)
+	if err := t.chatHub.PublishChat(userId, chat); err != nil {
+		log.Println(err)
+	}
+
+	c.JSON(200, gin.H{"chatroomId": chatroomId})
+}
+
+// PUT /api/v1/users/{userId}/chatrooms/{chatroomId}/settings
+// 보내지 않은 설정은 바뀌지 않는다. 알림을 꺼도 메시지는 그대로 받는다.
+func (t *ChatControllerImpl) UpdateChatroomSettings(c *gin.Context) {
+	userId := c.Param("userId")
+	chatroomId, err := strconv.Atoi(c.Param("chatroomId"))
+
+	if err != nil {
+		c.JSON(400, gin.H{"message": "chatroomdId는 정수값이어야 합니다."})
+		return
+	}
+
+	if ok := t.chatService.CheckCorrectUser(userId, chatroomId); !ok {
+		c.JSON(403, gin.H{"message": "접근 권한이 없습니다"})
+		return
+	}
+
+	settings := models.ChatroomSettings{}
+	if err := c.ShouldBindJSON(&settings); err != nil {
+		c.JSON(400, gin.H{"message": err.Error()})
+		return
+	}
+
+	chatroom, err := t.chatService.UpdateChatroomSettings(chatroomId, userId, settings)
+	if err != nil {
+		c.JSON(400, gin.H{"message": err})
+		return
+	}
+
+	c.JSON(200, chatroom)
+}
+
 // GET /api/v1/users/{userId}/chatrooms/{chatroomId}/chats
 func (t *ChatControllerImpl) GetChats(c *gin.Context) {
 	userId := c.Param("userId")
@@ -221,3 +601,421 @@ func (t *ChatControllerImpl) GetChats(c *gin.Context) {
 		"chats":      chats,
 	})
 }
+
+// PUT /api/v1/users/{userId}/chatrooms/{chatroomId}/read
+// lastReadChatId를 보내지 않으면 채팅방의 마지막 메시지까지 읽은 것으로 표시한다.
+func (t *ChatControllerImpl) ReadChats(c *gin.Context) {
+	userId := c.Param("userId")
+	chatroomId, err := strconv.Atoi(c.Param("chatroomId"))
+
+	if err != nil {
+		c.JSON(400, gin.H{"message": "chatroomdId는 정수값이어야 합니다."})
+		return
+	}
+
+	if ok := t.chatService.CheckCorrectUser(userId, chatroomId); !ok {
+		c.JSON(403, gin.H{"message": "접근 권한이 없습니다"})
+		return
+	}
+
+	var form struct {
+		LastReadChatID int `json:"lastReadChatId" form:"lastReadChatId"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBind(&form); err != nil {
+			c.JSON(400, gin.H{"message": err})
+			return
+		}
+	}
+
+	lastReadChatId, err := t.chatService.ReadChats(chatroomId, userId, form.LastReadChatID)
+
+	if err == gorm.ErrRecordNotFound {
+		c.JSON(404, gin.H{"message": "채팅방에 없는 메시지입니다."})
+		return
+	}
+
+	if err != nil {
+		c.JSON(400, gin.H{"message": err})
+		return
+	}
+
+	if err := t.chatHub.NotifyRead(chatroomId, userId, lastReadChatId); err != nil {
+		log.Println(err)
+	}
+
+	c.JSON(200, gin.H{
+		"chatroomId":     chatroomId,
+		"lastReadChatId": lastReadChatId,
+	})
+}
+
+type ChatImageForm struct {
+	File *multipart.FileHeader `form:"file" binding:"required"`
+}
+
+// POST /api/v1/users/{userId}/chatrooms/{chatroomId}/images
+// 이미지를 업로드해 IMAGE 메시지로 보낸다.
+func (t *ChatControllerImpl) SendImage(c *gin.Context) {
+	userId := c.Param("userId")
+	chatroomId, err := strconv.Atoi(c.Param("chatroomId"))
+
+	if err != nil {
+		c.JSON(400, gin.H{"message": "chatroomdId는 정수값이어야 합니다."})
+		return
+	}
+
+	if ok := t.chatService.CheckCorrectUser(userId, chatroomId); !ok {
+		c.JSON(403, gin.H{"message": "접근 권한이 없습니다"})
+		return
+	}
+
+	form := ChatImageForm{}
+	if err := c.ShouldBind(&form); err != nil {
+		c.JSON(400, gin.H{"message": err.Error()})
+		return
+	}
+
+	if !t.chatHub.AllowChat(userId, chatroomId) {
+		c.JSON(429, gin.H{"message": chat.RateLimitedMessage})
+		return
+	}
+
+	file, err := form.File.Open()
+	if err != nil {
+		c.JSON(400, gin.H{"message": err.Error()})
+		return
+	}
+	defer file.Close()
+
+	chat, err := t.chatService.SendImage(chatroomId, userId, file)
+	if err == services.ErrCounterpartLeft {
+		c.JSON(409, gin.H{"message": err.Error()})
+		return
+	}
+
+	if err != nil {
+		c.JSON(400, gin.H{"message": err})
+		return
+	}
+
+	if err := t.chatHub.PublishChat(userId, chat); err != nil {
+		log.Println(err)
+	}
+
+	c.JSON(201, chat)
+}
+
+// GET /api/v1/users/{userId}/chats?since={chatId}
+// 참여 중인 모든 채팅방에서 since 이후의 메시지를 오래된 순서로 가져온다.
+func (t *ChatControllerImpl) SyncChats(c *gin.Context) {
+	userId := c.Param("userId")
+
+	since, err := strconv.Atoi(c.DefaultQuery("since", "0"))
+	if err != nil {
+		c.JSON(400, gin.H{"message": "since는 정수값이어야 합니다."})
+		return
+	}
+
+	size, err := strconv.Atoi(c.DefaultQuery("size", strconv.Itoa(services.DefaultSyncSize)))
+	if err != nil {
+		c.JSON(400, gin.H{"message": err})
+		return
+	}
+
+	chats, hasMore, err := t.chatService.SyncChats(userId, since, size)
+	if err != nil {
+		c.JSON(400, gin.H{"message": err})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"chats":   chats,
+		"hasMore": hasMore,
+		"userId":  userId,
+	})
+}
+
+type ChatEditForm struct {
+	Content string `json:"content" form:"content" binding:"required"`
+}
+
+// PUT /api/v1/users/{userId}/chatrooms/{chatroomId}/chats/{chatId}
+func (t *ChatControllerImpl) EditChat(c *gin.Context) {
+	userId := c.Param("userId")
+	chatroomId, chatId, ok := chatParams(c)
+	if !ok {
+		return
+	}
+
+	form := ChatEditForm{}
+	if err := c.ShouldBind(&form); err != nil {
+		c.JSON(400, gin.H{"message": err.Error()})
+		return
+	}
+
+	chat, err := t.chatService.EditChat(userId, chatroomId, chatId, form.Content)
+	if err != nil {
+		respondChatUpdateError(c, err)
+		return
+	}
+
+	if err := t.chatHub.PublishChatUpdate(userId, chat); err != nil {
+		log.Println(err)
+	}
+
+	c.JSON(200, chat)
+}
+
+// DELETE /api/v1/users/{userId}/chatrooms/{chatroomId}/chats/{chatId}
+func (t *ChatControllerImpl) UnsendChat(c *gin.Context) {
+	userId := c.Param("userId")
+	chatroomId, chatId, ok := chatParams(c)
+	if !ok {
+		return
+	}
+
+	chat, err := t.chatService.UnsendChat(userId, chatroomId, chatId)
+	if err != nil {
+		respondChatUpdateError(c, err)
+		return
+	}
+
+	if err := t.chatHub.PublishChatUpdate(userId, chat); err != nil {
+		log.Println(err)
+	}
+
+	c.JSON(200, chat)
+}
+
+// GET /api/v1/users/{userId}/chatrooms/{chatroomId}/transcript?format=json|text|html
+// 분쟁 처리를 위해 채팅방의 전체 대화 내용을 내려준다. 취소된 메시지의 내용은 가린다.
+func (t *ChatControllerImpl) ExportChats(c *gin.Context) {
+	userId := c.Param("userId")
+	chatroomId, err := strconv.Atoi(c.Param("chatroomId"))
+
+	if err != nil {
+		c.JSON(400, gin.H{"message": "chatroomdId는 정수값이어야 합니다."})
+		return
+	}
+
+	if ok := t.chatService.CheckCorrectUser(userId, chatroomId); !ok {
+		c.JSON(403, gin.H{"message": "접근 권한이 없습니다"})
+		return
+	}
+
+	t.exportChats(c, chatroomId, false)
+}
+
+// GET /api/v1/admin/chatrooms/{chatroomId}/transcript?format=json|text|html
+// 운영자용. 참여 여부와 상관없이 내려주며, 취소된 메시지도 원래 내용을 보여준다.
+func (t *ChatControllerImpl) ExportChatsAdmin(c *gin.Context) {
+	chatroomId, err := strconv.Atoi(c.Param("chatroomId"))
+
+	if err != nil {
+		c.JSON(400, gin.H{"message": "chatroomdId는 정수값이어야 합니다."})
+		return
+	}
+
+	t.exportChats(c, chatroomId, true)
+}
+
+// format이 text나 html이면 파일로 내려받도록 보낸다.
+func (t *ChatControllerImpl) exportChats(c *gin.Context, chatroomId int, withDeleted bool) {
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "text" && format != "html" {
+		c.JSON(400, gin.H{"message": "format은 json, text, html 중 하나여야 합니다."})
+		return
+	}
+
+	result, err := t.chatService.GetTranscript(chatroomId, withDeleted)
+	if err == gorm.ErrRecordNotFound {
+		c.JSON(404, gin.H{"message": "존재하지 않는 채팅방입니다."})
+		return
+	}
+
+	if err != nil {
+		c.JSON(400, gin.H{"message": err})
+		return
+	}
+
+	if format == "json" {
+		c.JSON(200, result)
+		return
+	}
+
+	buf := &bytes.Buffer{}
+	contentType, extension := "text/plain; charset=utf-8", "txt"
+	if format == "html" {
+		contentType, extension = "text/html; charset=utf-8", "html"
+		err = transcript.WriteHTML(buf, result)
+	} else {
+		err = transcript.WriteText(buf, result)
+	}
+	if err != nil {
+		log.Println(err)
+		c.JSON(500, gin.H{"message": "대화 내용을 만들지 못했습니다."})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="chatroom-%d.%s"`, chatroomId, extension))
+	c.Data(200, contentType, buf.Bytes())
+}
+
+func chatParams(c *gin.Context) (chatroomId, chatId int, ok bool) {
+	chatroomId, err := strconv.Atoi(c.Param("chatroomId"))
+	if err != nil {
+		c.JSON(400, gin.H{"message": "chatroomdId는 정수값이어야 합니다."})
+		return
+	}
+
+	chatId, err = strconv.Atoi(c.Param("chatId"))
+	if err != nil {
+		c.JSON(400, gin.H{"message": "chatId는 정수값이어야 합니다."})
+		return
+	}
+	return chatroomId, chatId, true
+}
+
+func respondChatUpdateError(c *gin.Context, err error) {
+	switch err {
+	case gorm.ErrRecordNotFound:
+		c.JSON(404, gin.H{"message": "존재하지 않는 메시지입니다."})
+	case services.ErrNotChatSender, services.ErrEditWindowExpired:
+		c.JSON(403, gin.H{"message": err.Error()})
+	case services.ErrChatDeleted:
+		c.JSON(409, gin.H{"message": err.Error()})
+	case services.ErrInvalidChat, services.ErrChatTooLong:
+		c.JSON(400, gin.H{"message": err.Error()})
+	default:
+		c.JSON(400, gin.H{"message": err})
+	}
+}
+
+type ReplyTemplateForm struct {
+	Content string `json:"content" form:"content" binding:"required"`
+}
+
+// GET /api/v1/users/{userId}/reply_templates
+func (t *ChatControllerImpl) GetReplyTemplates(c *gin.Context) {
+	userId := c.Param("userId")
+
+	templates, err := t.replyService.GetReplyTemplates(userId)
+	if err != nil {
+		c.JSON(400, gin.H{"message": err})
+		return
+	}
+
+	c.JSON(200, gin.H{"templates": templates})
+}
+
+// POST /api/v1/users/{userId}/reply_templates
+func (t *ChatControllerImpl) InsertReplyTemplate(c *gin.Context) {
+	userId := c.Param("userId")
+
+	form := ReplyTemplateForm{}
+	if err := c.ShouldBind(&form); err != nil {
+		c.JSON(400, gin.H{"message": err.Error()})
+		return
+	}
+
+	template, err := t.replyService.InsertReplyTemplate(userId, form.Content)
+	if err != nil {
+		respondReplyError(c, err)
+		return
+	}
+
+	c.JSON(201, template)
+}
+
+// PUT /api/v1/users/{userId}/reply_templates/{templateId}
+func (t *ChatControllerImpl) UpdateReplyTemplate(c *gin.Context) {
+	userId := c.Param("userId")
+	templateId, err := strconv.Atoi(c.Param("templateId"))
+
+	if err != nil {
+		c.JSON(400, gin.H{"message": "templateId는 정수값이어야 합니다."})
+		return
+	}
+
+	form := ReplyTemplateForm{}
+	if err := c.ShouldBind(&form); err != nil {
+		c.JSON(400, gin.H{"message": err.Error()})
+		return
+	}
+
+	template, err := t.replyService.UpdateReplyTemplate(userId, templateId, form.Content)
+	if err != nil {
+		respondReplyError(c, err)
+		return
+	}
+
+	c.JSON(200, template)
+}
+
+// DELETE /api/v1/users/{userId}/reply_templates/{templateId}
+func (t *ChatControllerImpl) DeleteReplyTemplate(c *gin.Context) {
+	userId := c.Param("userId")
+	templateId, err := strconv.Atoi(c.Param("templateId"))
+
+	if err != nil {
+		c.JSON(400, gin.H{"message": "templateId는 정수값이어야 합니다."})
+		return
+	}
+
+	if err := t.replyService.DeleteReplyTemplate(userId, templateId); err != nil {
+		respondReplyError(c, err)
+		return
+	}
+
+	c.JSON(200, gin.H{"templateId": templateId})
+}
+
+// 자리 비움 모드를 바꾼다. message를 보내지 않으면 저장된 자동 응답 메시지를 그대로 쓴다.
+type AwayModeForm struct {
+	Enabled *bool  `json:"enabled" binding:"required"`
+	Message string `json:"message"`
+}
+
+// GET /api/v1/users/{userId}/away
+func (t *ChatControllerImpl) GetAwayMode(c *gin.Context) {
+	userId := c.Param("userId")
+
+	awayMode, err := t.replyService.GetAwayMode(userId)
+	if err != nil {
+		c.JSON(400, gin.H{"message": err})
+		return
+	}
+
+	c.JSON(200, awayMode)
+}
+
+// PUT /api/v1/users/{userId}/away
+func (t *ChatControllerImpl) UpdateAwayMode(c *gin.Context) {
+	userId := c.Param("userId")
+
+	form := AwayModeForm{}
+	if err := c.ShouldBindJSON(&form); err != nil {
+		c.JSON(400, gin.H{"message": err.Error()})
+		return
+	}
+
+	awayMode, err := t.replyService.UpdateAwayMode(userId, *form.Enabled, form.Message)
+	if err != nil {
+		respondReplyError(c, err)
+		return
+	}
+
+	c.JSON(200, awayMode)
+}
+
+func respondReplyError(c *gin.Context, err error) {
+	switch err {
+	case gorm.ErrRecordNotFound:
+		c.JSON(404, gin.H{"message": "존재하지 않는 답장입니다."})
+	case services.ErrInvalidReply, services.ErrTooManyReplyTemplates:
+		c.JSON(400, gin.H{"message": err.Error()})
+	default:
+		c.JSON(400, gin.H{"message": err})
+	}
+}
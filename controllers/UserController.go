@@ -4,43 +4,55 @@ import (
 	"carrot-market-clone-api/models"
 	"carrot-market-clone-api/models/chat"
 	"carrot-market-clone-api/services"
+	"log"
 	"mime/multipart"
+	"strconv"
 
 	"encoding/json"
 
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt"
 	"gorm.io/gorm"
 )
 
 type UserController interface {
 	Login(c *gin.Context)
+	RefreshToken(c *gin.Context)
+	Logout(c *gin.Context)
+	LogoutAll(c *gin.Context)
 	Register(c *gin.Context)
 	UpdateUser(c *gin.Context)
 	DeleteUser(c *gin.Context)
 	GetUserData(c *gin.Context)
+	RegisterDevice(c *gin.Context)
+	GetDevices(c *gin.Context)
+	DeleteDevice(c *gin.Context)
 }
 
 type UserControllerImpl struct {
-	userService services.UserService
-	authService services.AuthService
-	awsService  services.AWSService
-	chatService services.ChatService
-	client      *s3.Client
-	chatHub     chat.ChatHub
+	userService   services.UserService
+	authService   services.AuthService
+	awsService    services.AWSService
+	chatService   services.ChatService
+	deviceService services.DeviceService
+	client        *s3.Client
+	chatHub       *chat.ChatHub
 }
 
 func NewUserControllerImpl(
 	userService services.UserService,
 	authService services.AuthService,
 	awsService services.AWSService,
+	deviceService services.DeviceService,
 	client *s3.Client,
 ) UserController {
 	return &UserControllerImpl{
-		userService: userService,
-		authService: authService,
-		awsService:  awsService,
-		client:      client,
+		userService:   userService,
+		authService:   authService,
+		awsService:    awsService,
+		deviceService: deviceService,
+		client:        client,
 	}
 }
 
@@ -70,16 +82,80 @@ func (u *UserControllerImpl) Login(c *gin.Context) {
 			c.JSON(400, gin.H{"message": err})
 			return
 		}
-		at, err := u.authService.CreateAccessToken(userDetail.ID)
+		rt, sessionId, err := u.authService.CreateRefreshToken(userDetail.ID)
+		if err != nil {
+			c.JSON(400, gin.H{"message": err})
+			return
+		}
+		at, err := u.authService.CreateAccessToken(userDetail.ID, sessionId)
 		if err != nil {
 			c.JSON(400, gin.H{"message": err})
 			return
 		}
 		c.Header("Authorization", at)
+		c.Header("Refresh-Token", rt)
 		c.Status(200)
 	}
 }
 
+// POST /api/v1/users/auth/refresh
+func (u *UserControllerImpl) RefreshToken(c *gin.Context) {
+	rt := c.Request.Header.Get("Refresh-Token")
+	if rt == "" {
+		c.JSON(401, gin.H{"message": "refresh token is empty."})
+		return
+	}
+
+	at, newRt, err := u.authService.RefreshTokens(rt)
+	if err != nil {
+		if v, ok := err.(*jwt.ValidationError); ok && v.Errors == jwt.ValidationErrorExpired {
+			c.JSON(401, gin.H{"message": "refresh token is expired"})
+		} else if err == services.ErrRefreshTokenReused {
+			c.JSON(401, gin.H{"message": "refresh token has already been used"})
+		} else if _, ok := err.(*jwt.ValidationError); ok || err == services.ErrInvalidRefreshToken {
+			c.JSON(401, gin.H{"message": "invalid refresh token"})
+		} else if err == gorm.ErrRecordNotFound {
+			c.Status(404)
+		} else {
+			c.JSON(400, gin.H{"message": err})
+		}
+		return
+	}
+
+	c.Header("Authorization", at)
+	c.Header("Refresh-Token", newRt)
+	c.Status(200)
+}
+
+// POST /api/v1/users/{userId}/auth/logout
+func (u *UserControllerImpl) Logout(c *gin.Context) {
+	claims := c.MustGet("claims").(jwt.MapClaims)
+	rt := c.Request.Header.Get("Refresh-Token")
+
+	err := u.authService.Logout(claims, rt)
+	if err == services.ErrInvalidRefreshToken {
+		c.JSON(401, gin.H{"message": "invalid refresh token"})
+		return
+	} else if err != nil {
+		c.JSON(400, gin.H{"message": err})
+		return
+	}
+
+	c.Status(200)
+}
+
+// POST /api/v1/users/{userId}/auth/logout/all
+func (u *UserControllerImpl) LogoutAll(c *gin.Context) {
+	userId := c.Param("userId")
+
+	if err := u.authService.LogoutAll(userId); err != nil {
+		c.JSON(400, gin.H{"message": err})
+		return
+	}
+
+	c.Status(200)
+}
+
 type UserForm struct {
 	File *multipart.FileHeader `form:"file" binding:"omitempty"`
 	Json string                `form:"json" binding:"required"`
@@ -192,6 +268,10 @@ func (u *UserControllerImpl) DeleteUser(c *gin.Context) {
 		return
 	}
 
+	if err := u.authService.LogoutAll(userId); err != nil {
+		log.Println(err)
+	}
+
 	c.Status(200)
 }
 
@@ -211,3 +291,62 @@ func (u *UserControllerImpl) GetUserData(c *gin.Context) {
 
 	c.IndentedJSON(200, user)
 }
+
+// POST /api/v1/users/{userId}/devices
+// 같은 토큰이 다른 사용자에게 등록되어 있으면 그 기기를 지우고 요청한 사용자의 기기로 등록한다.
+func (u *UserControllerImpl) RegisterDevice(c *gin.Context) {
+	userId := c.Param("userId")
+	claims := c.MustGet("claims").(jwt.MapClaims)
+	sessionId, _ := claims["sid"].(string)
+
+	device := &models.Device{}
+	if err := c.ShouldBindJSON(device); err != nil {
+		c.JSON(400, gin.H{"message": err.Error()})
+		return
+	}
+
+	err := u.deviceService.RegisterDevice(userId, sessionId, device)
+	if err == services.ErrInvalidDevice {
+		c.JSON(400, gin.H{"message": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(400, gin.H{"message": err})
+		return
+	}
+
+	c.JSON(201, device)
+}
+
+// GET /api/v1/users/{userId}/devices
+func (u *UserControllerImpl) GetDevices(c *gin.Context) {
+	userId := c.Param("userId")
+
+	devices, err := u.deviceService.GetDevices(userId)
+	if err != nil {
+		c.JSON(400, gin.H{"message": err})
+		return
+	}
+
+	c.JSON(200, devices)
+}
+
+// DELETE /api/v1/users/{userId}/devices/{deviceId}
+func (u *UserControllerImpl) DeleteDevice(c *gin.Context) {
+	userId := c.Param("userId")
+	deviceId, err := strconv.Atoi(c.Param("deviceId"))
+	if err != nil {
+		c.JSON(400, gin.H{"message": "deviceId가 올바르지 않습니다."})
+		return
+	}
+
+	err = u.deviceService.DeleteDevice(userId, deviceId)
+	if err == gorm.ErrRecordNotFound {
+		c.Status(404)
+		return
+	} else if err != nil {
+		c.JSON(400, gin.H{"message": err})
+		return
+	}
+
+	c.Status(200)
+}
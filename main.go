@@ -2,10 +2,15 @@ package main
 
 import (
 	"carrot-market-clone-api/config"
+	"carrot-market-clone-api/middlewares"
+	"carrot-market-clone-api/models/chat"
 	"carrot-market-clone-api/module"
+	"carrot-market-clone-api/repositories"
+	"carrot-market-clone-api/utils/redis"
 	"io"
 	"log"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/gin-contrib/cors"
@@ -47,23 +52,63 @@ func main() {
 	os.Setenv("REFRESH_SECRET", conf.AuthConfig.RefreshSecret)
 	os.Setenv("AWS_S3_BUCKET", conf.AWSConfig.Bucket)
 	os.Setenv("AWS_S3_DOMAIN", conf.AWSConfig.Domain)
+	os.Setenv("CHAT_ALLOWED_ORIGINS", strings.Join(conf.ChatConfig.AllowedOrigins, ","))
+	os.Setenv("CHAT_EDIT_WINDOW", conf.ChatConfig.EditWindow)
+	os.Setenv("PUSH_COLLAPSE_WINDOW", conf.ChatConfig.Push.CollapseWindow)
 
 	route := gin.New()
 	route.Use(cors.New(cors.Config{
 		AllowAllOrigins:  true,
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE"},
-		AllowHeaders:     []string{"Content-Type", "Authorization"},
-		ExposeHeaders:    []string{"Authorization"},
+		AllowHeaders:     []string{"Content-Type", "Authorization", "Refresh-Token"},
+		ExposeHeaders:    []string{"Authorization", "Refresh-Token"},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}))
-	route.Use(gin.LoggerWithConfig(gin.LoggerConfig{SkipPaths: []string{"/"}}))
+	route.Use(gin.LoggerWithConfig(gin.LoggerConfig{
+		Formatter: middlewares.LogFormatter,
+		SkipPaths: []string{"/"},
+	}))
 	route.Use(gin.Recovery())
 
+	var revocationStore repositories.RevocationStore
+	if conf.AuthConfig.RevocationStore == "memory" {
+		revocationStore = repositories.NewMemoryRevocationStore()
+	} else {
+		revocationStore = repositories.NewRevocationStoreImpl(db)
+	}
+
+	// 여러 인스턴스를 띄울 때는 redis 브로커로 채팅 메시지를 주고받는다.
+	var broker chat.Broker
+	if conf.ChatConfig.Broker == "redis" {
+		client, err := redis.Dial(conf.ChatConfig.Redis.Addr, conf.ChatConfig.Redis.Password)
+		if err != nil {
+			log.Println("Redis 연결에 실패했습니다. 서버를 종료합니다.")
+			log.Println(err)
+			return
+		}
+		broker = chat.NewRedisBroker(client, conf.ChatConfig.Redis.ChannelPrefix)
+	} else {
+		broker = chat.NewLocalBroker()
+	}
+
+	rateLimit := conf.ChatConfig.RateLimit
+	limiter := chat.NewRateLimiter(
+		chat.Rate{PerSecond: rateLimit.UserPerSecond, Burst: rateLimit.UserBurst},
+		chat.Rate{PerSecond: rateLimit.ChatroomPerSecond, Burst: rateLimit.ChatroomBurst},
+	)
+
+	notifiers, err := conf.InitNotifiers()
+	if err != nil {
+		log.Println("푸시 알림 설정을 불러오지 못했습니다. 서버를 종료합니다.")
+		log.Println(err)
+		return
+	}
+
 	productController := module.InitProductController(db, s3)
-	userController := module.InitUserController(db, s3)
-	chatController := module.InitChatController(db)
-	authMiddleware := module.InitAuthMiddleware(db)
+	userController := module.InitUserController(db, s3, revocationStore)
+	chatController := module.InitChatController(db, s3, broker, limiter, notifiers)
+	authMiddleware := module.InitAuthMiddleware(db, revocationStore)
 
 	route.GET("/", func(c *gin.Context) {
 		c.Status(200)
@@ -80,6 +125,7 @@ func main() {
 		v1.PUT("/users/:userId/products/:productId", authMiddleware.UserAuth, productController.UpdateProduct)
 		v1.DELETE("/users/:userId/products/:productId", authMiddleware.UserAuth, productController.DeleteProduct)
 		v1.POST("/users/:userId/products/:productId/chatrooms", authMiddleware.UserAuth, chatController.CreateChatroom)
+		v1.GET("/users/:userId/products/:productId/chatrooms", authMiddleware.UserAuth, chatController.GetProductChatrooms)
 
 		v1.GET("/users/:userId/products_wish", authMiddleware.UserAuth, productController.GetWishProducts)
 
@@ -87,16 +133,41 @@ func main() {
 		v1.DELETE("/users/:userId/products/:productId/wish", authMiddleware.UserAuth, productController.DeleteWish)
 
 		v1.POST("/users/auth/login", userController.Login)
+		v1.POST("/users/auth/refresh", userController.RefreshToken)
+		v1.POST("/users/:userId/auth/logout", authMiddleware.UserAuth, userController.Logout)
+		v1.POST("/users/:userId/auth/logout/all", authMiddleware.UserAuth, userController.LogoutAll)
 		v1.POST("/users", userController.Register)
 		v1.GET("/users/:userId", authMiddleware.UserAuth, userController.GetUserData)
 		v1.PUT("/users/:userId", authMiddleware.UserAuth, userController.UpdateUser)
 		v1.DELETE("/users/:userId", authMiddleware.UserAuth, userController.DeleteUser)
+		v1.POST("/users/:userId/devices", authMiddleware.UserAuth, userController.RegisterDevice)
+		v1.GET("/users/:userId/devices", authMiddleware.UserAuth, userController.GetDevices)
+		v1.DELETE("/users/:userId/devices/:deviceId", authMiddleware.UserAuth, userController.DeleteDevice)
+		v1.GET("/users/:userId/reply_templates", authMiddleware.UserAuth, chatController.GetReplyTemplates)
+		v1.POST("/users/:userId/reply_templates", authMiddleware.UserAuth, chatController.InsertReplyTemplate)
+		v1.PUT("/users/:userId/reply_templates/:templateId", authMiddleware.UserAuth, chatController.UpdateReplyTemplate)
+		v1.DELETE("/users/:userId/reply_templates/:templateId", authMiddleware.UserAuth, chatController.DeleteReplyTemplate)
+		v1.GET("/users/:userId/away", authMiddleware.UserAuth, chatController.GetAwayMode)
+		v1.PUT("/users/:userId/away", authMiddleware.UserAuth, chatController.UpdateAwayMode)
 
 		v1.GET("/users/:userId/chatrooms/:chatroomId", authMiddleware.UserAuth, chatController.GetChatroom)
-		v1.GET("/users/:userId/chat", chatController.CreateConnection)
+		v1.GET("/users/:userId/chat", authMiddleware.SocketAuth, chatController.CreateConnection)
+		v1.GET("/users/:userId/chat/events", authMiddleware.SocketAuth, chatController.CreateEventStream)
 
 		v1.GET("/users/:userId/chatrooms", authMiddleware.UserAuth, chatController.GetChatrooms)
+		v1.GET("/users/:userId/chatrooms/search", authMiddleware.UserAuth, chatController.SearchChats)
+		v1.DELETE("/users/:userId/chatrooms/:chatroomId", authMiddleware.UserAuth, chatController.LeaveChatroom)
+		v1.PUT("/users/:userId/chatrooms/:chatroomId/settings", authMiddleware.UserAuth, chatController.UpdateChatroomSettings)
 		v1.GET("/users/:userId/chatrooms/:chatroomId/chats", authMiddleware.UserAuth, chatController.GetChats)
+		v1.POST("/users/:userId/chatrooms/:chatroomId/chats", authMiddleware.UserAuth, chatController.SendChat)
+		v1.PUT("/users/:userId/chatrooms/:chatroomId/chats/:chatId", authMiddleware.UserAuth, chatController.EditChat)
+		v1.DELETE("/users/:userId/chatrooms/:chatroomId/chats/:chatId", authMiddleware.UserAuth, chatController.UnsendChat)
+		v1.GET("/users/:userId/chats", authMiddleware.UserAuth, chatController.SyncChats)
+		v1.PUT("/users/:userId/chatrooms/:chatroomId/read", authMiddleware.UserAuth, chatController.ReadChats)
+		v1.POST("/users/:userId/chatrooms/:chatroomId/images", authMiddleware.UserAuth, chatController.SendImage)
+		v1.GET("/users/:userId/chatrooms/:chatroomId/transcript", authMiddleware.UserAuth, chatController.ExportChats)
+
+		v1.GET("/admin/chatrooms/:chatroomId/transcript", authMiddleware.AdminAuth, chatController.ExportChatsAdmin)
 	}
 	route.Run(":3000")
 }
@@ -2,14 +2,21 @@ package middlewares
 
 import (
 	"carrot-market-clone-api/services"
+	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt"
 )
 
+// 브라우저는 웹소켓 연결에 Authorization 헤더를 붙일 수 없으므로
+// Sec-WebSocket-Protocol: access_token, <token> 형식으로도 토큰을 받는다.
+const SocketTokenProtocol = "access_token"
 
 type AuthMiddleware interface {
     UserAuth(c *gin.Context)
+    SocketAuth(c *gin.Context)
+    AdminAuth(c *gin.Context)
 }
 
 type AuthMiddlewareImpl struct {
@@ -21,28 +28,90 @@ func NewAuthMiddlewareImpl(authService services.AuthService) AuthMiddleware {
 }
 
 func (a *AuthMiddlewareImpl) UserAuth(c *gin.Context) {
+    token := c.Request.Header.Get("Authorization")
+    a.authenticate(c, token)
+}
 
-    userId := c.Param("userId")
+// 웹소켓 업그레이드와 SSE(EventSource) 요청용. Authorization 헤더가 없으면
+// 쿼리 파라미터 token 또는 Sec-WebSocket-Protocol 헤더에서 토큰을 읽는다.
+func (a *AuthMiddlewareImpl) SocketAuth(c *gin.Context) {
+    token := c.Request.Header.Get("Authorization")
+    if token == "" {
+        token = c.Query("token")
+    }
+    if token == "" {
+        token = socketProtocolToken(c.Request)
+    }
+    a.authenticate(c, token)
+}
 
+// 운영자 API용. 경로의 userId 대신 토큰의 role이 admin인지 확인한다.
+func (a *AuthMiddlewareImpl) AdminAuth(c *gin.Context) {
     token := c.Request.Header.Get("Authorization")
+    claims, ok := a.verify(c, token)
+    if !ok {
+        return
+    }
+
+    tokenRole, _ := claims["role"].(string)
+    if tokenRole != services.RoleAdmin {
+        c.AbortWithStatus(403)
+        return
+    }
+    c.Set("claims", claims)
+}
+
+func (a *AuthMiddlewareImpl) authenticate(c *gin.Context, token string) {
 
+    userId := c.Param("userId")
+
+    claims, ok := a.verify(c, token)
+    if !ok {
+        return
+    }
+
+    tokenUserId, _ := claims["user_id"].(string)
+    tokenRole, _ := claims["role"].(string)
+    if (tokenRole != services.RoleUser && tokenRole != services.RoleAdmin) || tokenUserId != userId {
+        c.AbortWithStatus(403)
+        return
+    }
+    c.Set("claims", claims)
+}
+
+// 토큰이 유효하지 않으면 401로 응답하고 ok는 false이다.
+func (a *AuthMiddlewareImpl) verify(c *gin.Context, token string) (claims jwt.MapClaims, ok bool) {
     if token == "" {
         c.JSON(401, gin.H{"message": "access token is empty."})
         c.Abort()
     } else if claims, err := a.authService.VerifyAccessToken(token); err != nil {
-        if v, _ := err.(*jwt.ValidationError); v.Errors == jwt.ValidationErrorExpired {
+        if v, ok := err.(*jwt.ValidationError); ok && v.Errors == jwt.ValidationErrorExpired {
             c.JSON(401, gin.H{"message": "access token is expired"})
             c.Abort()
+        } else if err == services.ErrTokenRevoked {
+            c.JSON(401, gin.H{"message": "access token is revoked"})
+            c.Abort()
         } else  {
             c.JSON(401, gin.H{"message": "invalid access token"})
             c.Abort()
         }
     } else {
-        tokenUserId := claims["user_id"].(string)
-        tokenRole := claims["role"].(string)
-        if tokenRole != "user" || tokenUserId != userId {
-            c.AbortWithStatus(403)
+        return claims, true
+    }
+    return nil, false
+}
+
+func socketProtocolToken(r *http.Request) string {
+    protocols := []string{}
+    for _, header := range r.Header.Values("Sec-WebSocket-Protocol") {
+        for _, protocol := range strings.Split(header, ",") {
+            protocols = append(protocols, strings.TrimSpace(protocol))
+        }
+    }
+    for i := 0; i < len(protocols)-1; i++ {
+        if protocols[i] == SocketTokenProtocol {
+            return protocols[i+1]
         }
     }
-    
+    return ""
 }
@@ -0,0 +1,54 @@
+package middlewares
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 로그에 남기지 않을 쿼리 파라미터 값을 대신하는 문자열
+const redactedValue = "REDACTED"
+
+// gin의 기본 로그 형식과 같지만, 웹소켓과 이벤트 스트림이 쿼리 파라미터로 받는 액세스 토큰은 가린다.
+func LogFormatter(param gin.LogFormatterParams) string {
+	var statusColor, methodColor, resetColor string
+	if param.IsOutputColor() {
+		statusColor = param.StatusCodeColor()
+		methodColor = param.MethodColor()
+		resetColor = param.ResetColor()
+	}
+
+	if param.Latency > time.Minute {
+		param.Latency = param.Latency.Truncate(time.Second)
+	}
+	return fmt.Sprintf("[GIN] %v |%s %3d %s| %13v | %15s |%s %-7s %s %#v\n%s",
+		param.TimeStamp.Format("2006/01/02 - 15:04:05"),
+		statusColor, param.StatusCode, resetColor,
+		param.Latency,
+		param.ClientIP,
+		methodColor, param.Method, resetColor,
+		redactToken(param.Path),
+		param.ErrorMessage,
+	)
+}
+
+// 쿼리 문자열을 해석하지 못하면 토큰이 어디에 있는지 알 수 없으므로 쿼리 전체를 가린다.
+func redactToken(path string) string {
+	i := strings.IndexByte(path, '?')
+	if i < 0 {
+		return path
+	}
+
+	query, err := url.ParseQuery(path[i+1:])
+	if err != nil {
+		return path[:i+1] + redactedValue
+	}
+	if !query.Has("token") {
+		return path
+	}
+	query.Set("token", redactedValue)
+	return path[:i+1] + query.Encode()
+}
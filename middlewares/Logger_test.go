@@ -0,0 +1,24 @@
+package middlewares
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedactToken(t *testing.T) {
+	tests := []struct {
+		path     string
+		redacted string
+	}{
+		{"/api/v1/users/1/chats", "/api/v1/users/1/chats"},
+		{"/api/v1/users/1/chats?since=3", "/api/v1/users/1/chats?since=3"},
+		{"/api/v1/users/1/chat?token=secret", "/api/v1/users/1/chat?token=REDACTED"},
+		{"/api/v1/users/1/events?since=3&token=secret&token=other", "/api/v1/users/1/events?since=3&token=REDACTED"},
+		{"/api/v1/users/1/events?token=secret;since=3", "/api/v1/users/1/events?REDACTED"},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.redacted, redactToken(test.path))
+	}
+}
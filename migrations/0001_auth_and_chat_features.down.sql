@@ -0,0 +1,44 @@
+CREATE OR REPLACE VIEW v_chats AS
+SELECT
+    chats.id,
+    chats.chat_user_id,
+    chat_users.chatroom_id,
+    chat_users.role,
+    chats.content,
+    chats.send_date
+FROM chats
+JOIN chat_users ON chat_users.id = chats.chat_user_id;
+
+DROP TABLE away_modes;
+DROP TABLE reply_templates;
+DROP TABLE chat_flags;
+DROP TABLE chat_edits;
+
+ALTER TABLE chats
+    DROP INDEX idx_chats_client_msg_id,
+    DROP COLUMN deleted_at,
+    DROP COLUMN edited_at,
+    DROP COLUMN client_msg_id,
+    DROP COLUMN payload,
+    DROP COLUMN type;
+
+ALTER TABLE chat_users
+    DROP COLUMN pinned_at,
+    DROP COLUMN muted,
+    DROP COLUMN archived,
+    DROP COLUMN left_at,
+    DROP COLUMN last_read_chat_id;
+
+ALTER TABLE devices
+    DROP INDEX idx_devices_session_id,
+    DROP INDEX idx_devices_token,
+    DROP COLUMN created_at,
+    DROP COLUMN session_id;
+
+DROP TABLE user_revocations;
+DROP TABLE revoked_tokens;
+DROP TABLE refresh_tokens;
+
+ALTER TABLE users
+    DROP COLUMN admin,
+    DROP COLUMN last_seen_at;
@@ -0,0 +1,113 @@
+-- 기존 users, products, chatrooms, chat_users, chats, devices 스키마 위에 인증과 채팅 기능에 필요한 테이블과 컬럼을 추가한다.
+-- golang-migrate 형식이며 파일 이름 순서대로 적용한다.
+
+-- argon2id 해시는 SHA-256 hex보다 길다.
+ALTER TABLE users
+    MODIFY pw VARCHAR(255) NOT NULL,
+    ADD COLUMN last_seen_at DATETIME NULL,
+    ADD COLUMN admin TINYINT(1) NOT NULL DEFAULT 0;
+
+-- 같은 로그인에서 회전으로 이어진 토큰은 family_id가 같다.
+CREATE TABLE refresh_tokens (
+    id         VARCHAR(36) NOT NULL,
+    family_id  VARCHAR(36) NOT NULL,
+    user_id    VARCHAR(36) NOT NULL,
+    used       TINYINT(1)  NOT NULL DEFAULT 0,
+    revoked    TINYINT(1)  NOT NULL DEFAULT 0,
+    expires_at DATETIME    NOT NULL,
+    created_at DATETIME    NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    INDEX idx_refresh_tokens_family_id (family_id),
+    INDEX idx_refresh_tokens_user_id (user_id)
+);
+
+CREATE TABLE revoked_tokens (
+    id         VARCHAR(36) NOT NULL,
+    expires_at DATETIME    NOT NULL,
+    PRIMARY KEY (id),
+    INDEX idx_revoked_tokens_expires_at (expires_at)
+);
+
+-- 토큰의 iat와 밀리초까지 비교한다.
+CREATE TABLE user_revocations (
+    user_id    VARCHAR(36) NOT NULL,
+    revoked_at DATETIME(3) NOT NULL,
+    PRIMARY KEY (user_id)
+);
+
+-- 같은 토큰이나 같은 로그인의 기기는 하나만 남긴다.
+ALTER TABLE devices
+    MODIFY token VARCHAR(255) NOT NULL,
+    ADD COLUMN session_id VARCHAR(36) NULL,
+    ADD COLUMN created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    ADD UNIQUE INDEX idx_devices_token (token),
+    ADD INDEX idx_devices_session_id (session_id);
+
+ALTER TABLE chat_users
+    ADD COLUMN last_read_chat_id INT NOT NULL DEFAULT 0,
+    ADD COLUMN left_at DATETIME NULL,
+    ADD COLUMN archived TINYINT(1) NOT NULL DEFAULT 0,
+    ADD COLUMN muted TINYINT(1) NOT NULL DEFAULT 0,
+    ADD COLUMN pinned_at DATETIME NULL;
+
+-- 재전송된 메시지가 동시에 들어와도 한 번만 저장되도록 보낸 사람마다 client_msg_id는 유일하다.
+-- client_msg_id가 없는(NULL) 메시지는 여러 개일 수 있다.
+ALTER TABLE chats
+    ADD COLUMN type VARCHAR(16) NOT NULL DEFAULT 'TEXT',
+    ADD COLUMN payload JSON NULL,
+    ADD COLUMN client_msg_id VARCHAR(64) NULL,
+    ADD COLUMN edited_at DATETIME NULL,
+    ADD COLUMN deleted_at DATETIME NULL,
+    ADD UNIQUE INDEX idx_chats_client_msg_id (chat_user_id, client_msg_id);
+
+CREATE TABLE chat_edits (
+    id        INT      NOT NULL AUTO_INCREMENT,
+    chat_id   INT      NOT NULL,
+    content   TEXT     NOT NULL,
+    edited_at DATETIME NOT NULL,
+    PRIMARY KEY (id),
+    CONSTRAINT fk_chat_edits_chat_id FOREIGN KEY (chat_id) REFERENCES chats (id) ON DELETE CASCADE
+);
+
+CREATE TABLE chat_flags (
+    id         INT         NOT NULL AUTO_INCREMENT,
+    chat_id    INT         NOT NULL,
+    reason     VARCHAR(32) NOT NULL,
+    created_at DATETIME    NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    CONSTRAINT fk_chat_flags_chat_id FOREIGN KEY (chat_id) REFERENCES chats (id) ON DELETE CASCADE
+);
+
+CREATE TABLE reply_templates (
+    id         INT         NOT NULL AUTO_INCREMENT,
+    user_id    VARCHAR(36) NOT NULL,
+    content    TEXT        NOT NULL,
+    created_at DATETIME    NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    INDEX idx_reply_templates_user_id (user_id)
+);
+
+CREATE TABLE away_modes (
+    user_id    VARCHAR(36) NOT NULL,
+    enabled    TINYINT(1)  NOT NULL DEFAULT 0,
+    message    TEXT        NOT NULL,
+    updated_at DATETIME    NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id)
+);
+
+-- 메시지와 보낸 참여자의 채팅방, 역할을 함께 조회한다.
+CREATE OR REPLACE VIEW v_chats AS
+SELECT
+    chats.id,
+    chats.chat_user_id,
+    chat_users.chatroom_id,
+    chat_users.role,
+    chats.type,
+    chats.content,
+    chats.payload,
+    chats.client_msg_id,
+    chats.send_date,
+    chats.edited_at,
+    chats.deleted_at
+FROM chats
+JOIN chat_users ON chat_users.id = chats.chat_user_id;
@@ -0,0 +1,2 @@
+ALTER TABLE chats
+    DROP INDEX idx_chats_content;
@@ -0,0 +1,4 @@
+-- 메시지 검색(SearchChats)의 MATCH ... AGAINST가 쓰는 인덱스. 한국어는 띄어쓰기로 나눌 수 없으므로 ngram 파서를 쓴다.
+-- 두 글자 ngram이 불용어에 걸려 빠지지 않도록 서버 설정에서 innodb_ft_enable_stopword를 끈 뒤에 만든다.
+ALTER TABLE chats
+    ADD FULLTEXT INDEX idx_chats_content (content) WITH PARSER ngram;
@@ -0,0 +1,2 @@
+ALTER TABLE chatrooms
+    DROP COLUMN created_at;
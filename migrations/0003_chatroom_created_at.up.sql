@@ -0,0 +1,18 @@
+-- 메시지가 없는 채팅방은 만든 시각으로 채팅방 목록의 순서를 정한다.
+-- 이미 있는 채팅방은 첫 메시지를 보낸 시각으로 채운다.
+ALTER TABLE chatrooms
+    ADD COLUMN created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP;
+
+UPDATE chatrooms
+SET created_at = (
+    SELECT MIN(chats.send_date)
+    FROM chats
+    JOIN chat_users ON chat_users.id = chats.chat_user_id
+    WHERE chat_users.chatroom_id = chatrooms.id
+)
+WHERE EXISTS (
+    SELECT 1
+    FROM chats
+    JOIN chat_users ON chat_users.id = chats.chat_user_id
+    WHERE chat_users.chatroom_id = chatrooms.id
+);
@@ -1,6 +1,9 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 type UserRole string
 
@@ -9,29 +12,159 @@ const (
 	SELLER UserRole = "SELLER"
 )
 
+type ChatType string
+
+const (
+	TEXT     ChatType = "TEXT"
+	IMAGE    ChatType = "IMAGE"
+	LOCATION ChatType = "LOCATION"
+	SYSTEM   ChatType = "SYSTEM"
+)
+
+// Payload는 Type에 따라 ImagePayload, LocationPayload, SystemPayload 중 하나이며 TEXT는 비어 있다.
+// ClientMsgID는 클라이언트가 재전송한 메시지를 구분하기 위한 ID로, 보낸 사람마다 유일하다.
+// 보낸 사람이 취소한 메시지(DeletedAt)도 신고 처리를 위해 내용은 지우지 않는다.
+// 메시지 검색은 chats.content의 FULLTEXT 인덱스(migrations/0002_chat_content_fulltext)를 쓰며,
+// 두 글자 ngram이 불용어에 걸리지 않도록 innodb_ft_enable_stopword는 끈다.
 type Chat struct {
-	ID         int       `json:"id,omitempty"`
-	ChatroomID int       `json:"chatroomId,omitempty" gorm:"->"`
-	ChatUserID int       `json:"chatUserId,omitempty"`
-	Role       UserRole  `json:"role,omitempty" gorm:"->"`
-	Content    string    `json:"content"`
-	SendDate   time.Time `json:"sendDate,omitempty" gorm:"->"`
+	ID          int             `json:"id,omitempty"`
+	ChatroomID  int             `json:"chatroomId,omitempty" gorm:"->"`
+	ChatUserID  int             `json:"chatUserId,omitempty"`
+	UserID      string          `json:"userId,omitempty" gorm:"->"`
+	Role        UserRole        `json:"role,omitempty" gorm:"->"`
+	Type        ChatType        `json:"type" gorm:"default:TEXT"`
+	Content     string          `json:"content"`
+	Payload     json.RawMessage `json:"payload,omitempty"`
+	SendDate    time.Time       `json:"sendDate,omitempty" gorm:"->"`
+	ClientMsgID *string         `json:"clientMsgId,omitempty"`
+	EditedAt    *time.Time      `json:"editedAt,omitempty"`
+	DeletedAt   *time.Time      `json:"deletedAt,omitempty"`
+	Flags       []FlagReason    `json:"flags,omitempty" gorm:"-"`
+}
+
+// 취소된 메시지 대신 보여줄 내용
+const DeletedChatContent = "삭제된 메시지입니다."
+
+// 의심스러운 메시지로 표시한 이유. 메시지는 그대로 전달하며, 받는 사람의 앱이 주의 문구를 보여준다.
+type FlagReason string
+
+const (
+	FlagExternalMessenger FlagReason = "EXTERNAL_MESSENGER"
+	FlagBankAccount       FlagReason = "BANK_ACCOUNT"
+	FlagRepeatedMessage   FlagReason = "REPEATED_MESSAGE"
+)
+
+// 운영자가 검토할 수 있도록 저장하는 의심 메시지 기록
+type ChatFlag struct {
+	ID        int        `json:"id"`
+	ChatID    int        `json:"chatId"`
+	Reason    FlagReason `json:"reason"`
+	CreatedAt time.Time  `json:"createdAt,omitempty" gorm:"->"`
+}
+
+// 메시지를 수정하기 전의 내용
+type ChatEdit struct {
+	ID       int       `json:"id"`
+	ChatID   int       `json:"chatId"`
+	Content  string    `json:"content"`
+	EditedAt time.Time `json:"editedAt"`
+}
+
+type ImagePayload struct {
+	URL string `json:"url"`
+}
+
+type LocationPayload struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Address   string  `json:"address,omitempty"`
+}
+
+// Event는 SYSTEM 메시지의 종류이며, 클라이언트는 Content를 그대로 보여주면 된다.
+type SystemPayload struct {
+	Event string `json:"event"`
 }
 
+const (
+	SystemEventLeave     = "LEAVE"
+	SystemEventAwayReply = "AWAY_REPLY"
+)
+
+// 참여자가 채팅방을 나갔을 때 상대방에게 보내는 내용
+const LeaveChatContent = "상대방이 채팅방을 나갔습니다."
+
+// Archived, Muted, PinnedAt은 채팅방을 조회한 사용자의 설정이다.
+// LastActivityAt은 마지막 메시지를 보낸 시각이며, 메시지가 없으면 채팅방을 만든 시각이다.
 type Chatroom struct {
-	ID        int      `json:"id,omitempty"`
-	ProductID int      `json:"productId,omitempty"`
-	Seller    ChatUser `json:"seller,omitempty" gorm:"foreignKey:ChatroomID"`
-	Buyer     ChatUser `json:"buyer,omitempty" gorm:"foreignKey:ChatroomID"`
-	Product   Product  `json:"product,omitempty" gorm:"foreignKey:ID;references:ProductID"`
-	LastChat  *Chat    `json:"lastChat,omitempty" gorm:"->"`
+	ID             int        `json:"id,omitempty"`
+	ProductID      int        `json:"productId,omitempty"`
+	Seller         ChatUser   `json:"seller,omitempty" gorm:"foreignKey:ChatroomID"`
+	Buyer          ChatUser   `json:"buyer,omitempty" gorm:"foreignKey:ChatroomID"`
+	Product        Product    `json:"product,omitempty" gorm:"foreignKey:ID;references:ProductID"`
+	LastChat       *Chat      `json:"lastChat,omitempty" gorm:"->"`
+	LastChatID     int        `json:"-" gorm:"->"`
+	LastActivityAt time.Time  `json:"-" gorm:"->"`
+	UnreadCount    int        `json:"unreadCount" gorm:"-"`
+	Archived       bool       `json:"archived" gorm:"->"`
+	Muted          bool       `json:"muted" gorm:"->"`
+	PinnedAt       *time.Time `json:"pinnedAt,omitempty" gorm:"->"`
 }
 
+// 채팅방 설정(Archived, Muted, PinnedAt)은 본인에게만 보이도록 Chatroom으로 내려준다.
+// 나간 채팅방(LeftAt)은 목록에 보이지 않고 메시지도 받지 않으며, 남은 상대방도 더 이상 메시지를 보낼 수 없다.
+// 알림을 끈 채팅방(Muted)도 메시지는 그대로 받는다.
 type ChatUser struct {
-	ID           int      `json:"id,omitempty"`
-	UserID       string   `json:"userId,omitempty"`
-	ChatroomID   int      `json:"chatroomId,omitempty"`
-	Role         UserRole `json:"role,omitempty"`
-	Nickname     string   `json:"nickname,omitempty" gorm:"->"`
-	ProfileImage string   `json:"profileImage,omitempty" gorm:"->"`
+	ID             int        `json:"id,omitempty"`
+	UserID         string     `json:"userId,omitempty"`
+	ChatroomID     int        `json:"chatroomId,omitempty"`
+	Role           UserRole   `json:"role,omitempty"`
+	LastReadChatID int        `json:"lastReadChatId"`
+	Nickname       string     `json:"nickname,omitempty" gorm:"->"`
+	ProfileImage   string     `json:"profileImage,omitempty" gorm:"->"`
+	LastSeenAt     *time.Time `json:"lastSeenAt,omitempty" gorm:"->"`
+	LeftAt         *time.Time `json:"leftAt,omitempty"`
+	Archived       bool       `json:"-"`
+	Muted          bool       `json:"-"`
+	PinnedAt       *time.Time `json:"-"`
+}
+
+// 메시지 검색 결과. Highlights의 Text를 차례로 이어 붙이면 메시지 내용(길면 검색어 주변)이 되고,
+// Match가 true인 조각이 검색어와 일치하는 부분이다.
+type ChatSearchResult struct {
+	Chat       Chat        `json:"chat"`
+	Chatroom   *Chatroom   `json:"chatroom"`
+	Highlights []Highlight `json:"highlights"`
+}
+
+type Highlight struct {
+	Text  string `json:"text"`
+	Match bool   `json:"match,omitempty"`
+}
+
+// 분쟁 처리를 위해 내보내는 채팅방의 전체 대화 내용. Chats는 오래된 순서이다.
+type Transcript struct {
+	ChatroomID int       `json:"chatroomId"`
+	Product    Product   `json:"product"`
+	Seller     ChatUser  `json:"seller"`
+	Buyer      ChatUser  `json:"buyer"`
+	Chats      []Chat    `json:"chats"`
+	ExportedAt time.Time `json:"exportedAt"`
+}
+
+// userId의 참여자 별칭. 참여자가 아니면 빈 문자열이다.
+func (t *Transcript) Nickname(userId string) string {
+	switch userId {
+	case t.Seller.UserID:
+		return t.Seller.Nickname
+	case t.Buyer.UserID:
+		return t.Buyer.Nickname
+	}
+	return ""
+}
+
+// 바꿀 채팅방 설정. nil인 항목은 그대로 둔다.
+type ChatroomSettings struct {
+	Archived *bool `json:"archived"`
+	Muted    *bool `json:"muted"`
+	Pinned   *bool `json:"pinned"`
 }
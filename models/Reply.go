@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// 사용자가 자주 보내는 답장. 소켓의 chat 프레임에 templateId를 보내면 이 내용으로 메시지를 보낸다.
+type ReplyTemplate struct {
+	ID        int       `json:"id"`
+	UserID    string    `json:"userId"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"createdAt,omitempty" gorm:"->"`
+}
+
+// 자리 비움 모드. 켜져 있으면 구매자가 판매자와 새 채팅방을 열 때 Message를 자동 응답으로 보낸다.
+type AwayMode struct {
+	UserID    string    `json:"userId" gorm:"primaryKey"`
+	Enabled   bool      `json:"enabled"`
+	Message   string    `json:"message"`
+	UpdatedAt time.Time `json:"updatedAt,omitempty"`
+}
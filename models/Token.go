@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+// RefreshToken은 발급된 리프레시 토큰 한 건을 나타낸다.
+// 같은 로그인에서 회전(rotation)으로 이어진 토큰들은 동일한 FamilyID를 가진다.
+type RefreshToken struct {
+	ID        string    `json:"id" gorm:"primaryKey"`
+	FamilyID  string    `json:"familyId"`
+	UserID    string    `json:"userId"`
+	Used      bool      `json:"used"`
+	Revoked   bool      `json:"revoked"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	CreatedAt time.Time `json:"createdAt,omitempty" gorm:"->"`
+}
+
+// RevokedToken은 만료 전에 폐기된 액세스 토큰이다.
+type RevokedToken struct {
+	ID        string    `json:"id" gorm:"primaryKey"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// UserRevocation은 RevokedAt 이전에 발급된 사용자의 모든 토큰을 폐기한다.
+// 토큰의 iat와 같이 밀리초까지 비교하므로 revoked_at은 DATETIME(3)이어야 한다.
+type UserRevocation struct {
+	UserID    string    `json:"userId" gorm:"primaryKey"`
+	RevokedAt time.Time `json:"revokedAt"`
+}
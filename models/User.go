@@ -1,12 +1,16 @@
 package models
 
+import "time"
+
+// Admin은 운영자 계정이며 API로는 바꿀 수 없다.
 type User struct {
 	ID           string   `json:"id,omitempty" gorm:"primaryKey"`
 	PW           string   `json:"pw,omitempty"`
 	Email        string   `json:"email,omitempty"`
 	Nickname     string   `json:"nickname,omitempty"`
 	ProfileImage string   `json:"profileImage,omitempty"`
-	Devices      []Device `json:"deivce,omitempty" gorm:"foreignKey:UserID"`
+	Admin        bool     `json:"-" gorm:"->"`
+	Devices      []Device `json:"devices,omitempty" gorm:"foreignKey:UserID"`
 }
 
 type DeviceType string
@@ -16,11 +20,15 @@ const (
 	ANDROID DeviceType = "ANDROID"
 )
 
+// 같은 Token은 마지막으로 등록한 사용자의 기기에만 남는다.
+// SessionID는 기기를 등록한 로그인의 리프레시 토큰 패밀리이며, 그 로그인에서 로그아웃하면 기기도 지운다.
 type Device struct {
 	UserID     string     `json:"userId"`
 	ID         int        `json:"id" gorm:"primaryKey"`
 	Token      string     `json:"token"`
 	DeviceType DeviceType `json:"deviceType"`
+	SessionID  string     `json:"-"`
+	CreatedAt  time.Time  `json:"createdAt,omitempty" gorm:"->"`
 }
 
 type UserValidationResult struct {
@@ -0,0 +1,131 @@
+package chat
+
+import (
+	"log"
+	"sync"
+)
+
+// Broker는 채팅방 단위로 메시지를 발행하고 구독한다.
+// 여러 API 인스턴스가 같은 Broker를 공유하면 서로 다른 인스턴스에 접속한 사용자끼리도 대화할 수 있다.
+// Subscribe는 구독이 완료된 뒤에 돌아오므로, 그 뒤에 발행된 메시지는 빠짐없이 handler에 전달된다.
+type Broker interface {
+	Publish(chatroomId int, message []byte) error
+	Subscribe(chatroomId int, handler func(message []byte)) (Subscription, error)
+}
+
+type Subscription interface {
+	Unsubscribe() error
+}
+
+const subscriptionBufferSize = 1024
+
+// subscription은 구독마다 별도의 고루틴에서 순서대로 handler를 호출한다.
+// 발행하는 쪽이 handler 때문에 막히지 않도록, 큐가 가득 차면 메시지를 버린다.
+type subscription struct {
+	chatroomId int
+	queue      chan []byte
+	handler    func(message []byte)
+	cancel     func(s *subscription)
+	once       sync.Once
+}
+
+func newSubscription(chatroomId int, handler func(message []byte), cancel func(s *subscription)) *subscription {
+	s := &subscription{
+		chatroomId: chatroomId,
+		queue:      make(chan []byte, subscriptionBufferSize),
+		handler:    handler,
+		cancel:     cancel,
+	}
+	go s.run()
+	return s
+}
+
+func (s *subscription) run() {
+	for message := range s.queue {
+		s.handler(message)
+	}
+}
+
+// subscriptionSet의 lock을 잡은 상태에서만 호출한다.
+func (s *subscription) enqueue(message []byte) {
+	select {
+	case s.queue <- message:
+	default:
+		log.Printf("chatroom %d subscription is full. message dropped.", s.chatroomId)
+	}
+}
+
+func (s *subscription) Unsubscribe() error {
+	s.once.Do(func() {
+		s.cancel(s)
+	})
+	return nil
+}
+
+// subscriptionSet은 채팅방별 구독을 관리하고 발행된 메시지를 구독마다 나눠 넣는다.
+type subscriptionSet struct {
+	mutex         sync.RWMutex
+	subscriptions map[int]map[*subscription]bool
+}
+
+func newSubscriptionSet() subscriptionSet {
+	return subscriptionSet{subscriptions: make(map[int]map[*subscription]bool)}
+}
+
+// 채팅방의 첫 구독이면 true를 돌려준다.
+func (set *subscriptionSet) add(s *subscription) (first bool) {
+	set.mutex.Lock()
+	defer set.mutex.Unlock()
+
+	if _, ok := set.subscriptions[s.chatroomId]; !ok {
+		set.subscriptions[s.chatroomId] = make(map[*subscription]bool)
+		first = true
+	}
+	set.subscriptions[s.chatroomId][s] = true
+	return
+}
+
+// 구독을 지우고 큐를 닫는다. 채팅방의 마지막 구독이었으면 true를 돌려준다.
+func (set *subscriptionSet) remove(s *subscription) (last bool) {
+	set.mutex.Lock()
+	defer set.mutex.Unlock()
+
+	delete(set.subscriptions[s.chatroomId], s)
+	if len(set.subscriptions[s.chatroomId]) == 0 {
+		delete(set.subscriptions, s.chatroomId)
+		last = true
+	}
+	close(s.queue)
+	return
+}
+
+func (set *subscriptionSet) publish(chatroomId int, message []byte) {
+	set.mutex.RLock()
+	defer set.mutex.RUnlock()
+
+	for s := range set.subscriptions[chatroomId] {
+		s.enqueue(message)
+	}
+}
+
+// LocalBroker는 한 프로세스 안에서만 메시지를 전달한다.
+type LocalBroker struct {
+	subscriptions subscriptionSet
+}
+
+func NewLocalBroker() Broker {
+	return &LocalBroker{subscriptions: newSubscriptionSet()}
+}
+
+func (b *LocalBroker) Publish(chatroomId int, message []byte) error {
+	b.subscriptions.publish(chatroomId, message)
+	return nil
+}
+
+func (b *LocalBroker) Subscribe(chatroomId int, handler func(message []byte)) (Subscription, error) {
+	s := newSubscription(chatroomId, handler, func(s *subscription) {
+		b.subscriptions.remove(s)
+	})
+	b.subscriptions.add(s)
+	return s, nil
+}
@@ -0,0 +1,148 @@
+package chat
+
+import (
+	"carrot-market-clone-api/models"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocalBroker(t *testing.T) {
+	b := NewLocalBroker()
+
+	received := make(chan string, 10)
+	s1, err := b.Subscribe(1, func(message []byte) { received <- "s1 " + string(message) })
+	assert.NoError(t, err)
+	s2, err := b.Subscribe(1, func(message []byte) { received <- "s2 " + string(message) })
+	assert.NoError(t, err)
+
+	assert.NoError(t, b.Publish(1, []byte("hello")))
+	assert.NoError(t, b.Publish(2, []byte("nobody")))
+	assert.ElementsMatch(t, []string{"s1 hello", "s2 hello"}, []string{<-received, <-received})
+
+	assert.NoError(t, s1.Unsubscribe())
+	assert.NoError(t, s1.Unsubscribe())
+	assert.NoError(t, b.Publish(1, []byte("after unsubscribe")))
+	assert.Equal(t, "s2 after unsubscribe", <-received)
+
+	assert.NoError(t, s2.Unsubscribe())
+	assert.Len(t, b.(*LocalBroker).subscriptions.subscriptions, 0)
+}
+
+// 같은 Broker를 쓰는 두 ChatHub는 서로 다른 인스턴스에 접속한 사용자에게도 메시지를 전달한다.
+func TestChatHubAcrossInstances(t *testing.T) {
+	broker := NewLocalBroker()
+	chatroomIds := map[string][]int{"seller": {1}, "buyer": {1}}
+	h1 := newTestHubWithBroker(chatroomIds, broker)
+	h2 := newTestHubWithBroker(chatroomIds, broker)
+
+	seller := NewClient("seller", nil, h1)
+	buyer := NewClient("buyer", nil, h2)
+	assert.NoError(t, h1.Register(seller))
+	assert.NoError(t, h2.Register(buyer))
+
+	assert.NoError(t, h1.Broadcast(1, []byte("from instance 1")))
+	assert.Equal(t, "from instance 1", receive(t, seller))
+	assert.Equal(t, "from instance 1", receive(t, buyer))
+
+	assert.NoError(t, h2.Broadcast(1, []byte("from instance 2")))
+	assert.Equal(t, "from instance 2", receive(t, seller))
+	assert.Equal(t, "from instance 2", receive(t, buyer))
+
+	// 참여자가 모두 나간 인스턴스는 구독을 해제한다.
+	h2.Unregister(buyer)
+	assertClosed(t, buyer)
+	assert.Eventually(t, func() bool {
+		set := &broker.(*LocalBroker).subscriptions
+		set.mutex.RLock()
+		defer set.mutex.RUnlock()
+		return len(set.subscriptions[1]) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	assert.NoError(t, h2.Broadcast(1, []byte("after buyer left")))
+	assert.Equal(t, "after buyer left", receive(t, seller))
+}
+
+func TestChatHubOpenAcrossInstances(t *testing.T) {
+	broker := NewLocalBroker()
+	h1 := newTestHubWithBroker(nil, broker)
+	h2 := newTestHubWithBroker(nil, broker)
+
+	buyer := NewClient("buyer", nil, h1)
+	seller := NewClient("seller", nil, h2)
+	assert.NoError(t, h1.Register(buyer))
+	assert.NoError(t, h2.Register(seller))
+
+	// 구매자가 채팅방을 만든 인스턴스에서 판매자가 접속한 인스턴스로 채팅방을 알린다.
+	chatroom := &models.Chatroom{ID: 1, ProductID: 3}
+	assert.NoError(t, h1.Open(1, []string{"buyer", "seller"}, "seller", chatroom))
+
+	envelope := Envelope{}
+	assert.NoError(t, json.Unmarshal([]byte(receive(t, seller)), &envelope))
+	assert.Equal(t, FrameChatroom, envelope.Type)
+	received := models.Chatroom{}
+	assert.NoError(t, json.Unmarshal(envelope.Payload, &received))
+	assert.Equal(t, 1, received.ID)
+	assert.Equal(t, 3, received.ProductID)
+
+	assert.NoError(t, h1.Broadcast(1, []byte("first message")))
+	assert.Equal(t, "first message", receive(t, buyer))
+	assert.Equal(t, "first message", receive(t, seller))
+
+	// 채팅방 프레임은 상대방에게만 가고, 이벤트를 보낸 인스턴스는 자신의 이벤트를 다시 처리하지 않는다.
+	h1.do(func() {
+		assert.Equal(t, 1, h1.chatrooms[1].size)
+	})
+	h2.do(func() {
+		assert.Equal(t, 1, h2.chatrooms[1].size)
+	})
+	assert.Len(t, buyer.Send, 0)
+}
+
+// failures번까지 hubEvent 채널 구독에 실패하는 Broker
+type flakyBroker struct {
+	Broker
+	mutex    sync.Mutex
+	failures int
+}
+
+func (b *flakyBroker) Subscribe(chatroomId int, handler func(message []byte)) (Subscription, error) {
+	b.mutex.Lock()
+	if chatroomId == hubEventChatroomId && b.failures > 0 {
+		b.failures--
+		b.mutex.Unlock()
+		return nil, errors.New("subscribe failed")
+	}
+	b.mutex.Unlock()
+	return b.Broker.Subscribe(chatroomId, handler)
+}
+
+// hubEvent 채널 구독에 실패한 인스턴스는 구독될 때까지 다시 시도한다.
+func TestChatHubRetrySubscribeEvents(t *testing.T) {
+	backoff := eventSubscribeBackoff
+	eventSubscribeBackoff = 10 * time.Millisecond
+	t.Cleanup(func() { eventSubscribeBackoff = backoff })
+
+	broker := NewLocalBroker()
+	h1 := newTestHubWithBroker(nil, broker)
+	h2 := newTestHubWithBroker(nil, &flakyBroker{Broker: broker, failures: 3})
+
+	seller := NewClient("seller", nil, h2)
+	assert.NoError(t, h2.Register(seller))
+	assert.Eventually(t, func() bool {
+		set := &broker.(*LocalBroker).subscriptions
+		set.mutex.RLock()
+		defer set.mutex.RUnlock()
+		return len(set.subscriptions[hubEventChatroomId]) == 2
+	}, time.Second, 10*time.Millisecond)
+
+	assert.NoError(t, h1.Open(1, []string{"buyer", "seller"}, "seller", &models.Chatroom{ID: 1}))
+	assert.Contains(t, receive(t, seller), FrameChatroom)
+	h2.do(func() {
+		assert.Equal(t, 1, h2.chatrooms[1].size)
+	})
+}
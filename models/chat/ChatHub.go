@@ -1,77 +1,751 @@
 package chat
 
 import (
+	"carrot-market-clone-api/models"
 	"carrot-market-clone-api/services"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
 )
 
+// ChatHub는 접속한 클라이언트와 채팅방을 관리한다.
+// clients, chatrooms와 각 클라이언트의 chatrooms는 Run 고루틴에서만 접근하며,
+// 다른 고루틴은 do를 통해 요청한다.
+// 메시지는 Broker를 거쳐 전달되므로, 같은 Broker를 쓰는 다른 인스턴스의 접속자도 받는다.
+// NotificationService가 있으면 이 인스턴스에 접속하지 않은 참여자에게 푸시 알림을 보낸다.
+// Limiter가 있으면 메시지를 저장하기 전에 보내는 속도를 제한한다.
 type ChatHub struct {
-	ChatService services.ChatService
-	Chatrooms   map[int]*Chatroom
-	Clients     map[string]*Client
-	Register    chan *Client
-	Unregister  chan *Client
+	ChatService         services.ChatService
+	NotificationService services.NotificationService
+	Broker              Broker
+	Limiter             *RateLimiter
+
+	// 인스턴스 사이에 주고받는 hubEvent에서 이 인스턴스를 구분한다.
+	id string
+
+	clients   map[string]map[*Client]bool
+	chatrooms map[int]*Chatroom
+
+	deliver chan broadcast
+	call    chan func()
+}
+
+// chatroom이 있으면 그 채팅방의 구독으로 받은 메시지이며, 채팅방이 닫힌 뒤 같은 ID로 다시 열렸으면 버린다.
+type broadcast struct {
+	chatroomId int
+	chatroom   *Chatroom
+	message    []byte
+}
+
+// 채팅방 ID 0의 Broker 채널은 채팅방 대신 인스턴스 사이의 hubEvent를 전달하는 데 쓴다.
+const hubEventChatroomId = 0
+
+// hubEvent 채널 구독에 실패하면 다시 시도하기 전에 기다리는 시간. 실패할 때마다 두 배로 늘린다.
+var (
+	eventSubscribeBackoff    = time.Second
+	eventSubscribeMaxBackoff = 30 * time.Second
+)
+
+// 새 채팅방에 접속 중인 참여자를 모든 인스턴스에서 참여시키기 위한 이벤트
+// Frame이 있으면 RecipientID의 연결에 그대로 보낸다.
+type hubEvent struct {
+	Origin      string          `json:"origin"`
+	ChatroomID  int             `json:"chatroomId"`
+	UserIDs     []string        `json:"userIds"`
+	RecipientID string          `json:"recipientId,omitempty"`
+	Frame       json.RawMessage `json:"frame,omitempty"`
+}
+
+func NewChatHub(
+	chatService services.ChatService,
+	notificationService services.NotificationService,
+	broker Broker,
+	limiter *RateLimiter,
+) *ChatHub {
+	return &ChatHub{
+		ChatService:         chatService,
+		NotificationService: notificationService,
+		Broker:              broker,
+		Limiter:             limiter,
+		id:                  newHubId(),
+		clients:             make(map[string]map[*Client]bool),
+		chatrooms:           make(map[int]*Chatroom),
+		deliver:             make(chan broadcast),
+		call:                make(chan func()),
+	}
 }
 
-func NewChatHub(chatService services.ChatService) ChatHub {
-	return ChatHub{
-		ChatService: chatService,
-		Chatrooms:   make(map[int]*Chatroom),
-		Clients:     make(map[string]*Client),
-		Register:    make(chan *Client),
-		Unregister:  make(chan *Client),
+func newHubId() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
 	}
+	return hex.EncodeToString(b)
 }
 
 func (h *ChatHub) Run() {
+	if err := h.subscribeEvents(); err != nil {
+		log.Println("hub event subscription failed:", err)
+		go h.retrySubscribeEvents()
+	}
+
 	for {
 		select {
-		case client := <-h.Register:
-			userId := client.UserID
-			if _, ok := h.Clients[userId]; !ok {
-				h.Clients[userId] = client
-
-				chatrooms, _, err := h.ChatService.GetChatrooms(userId, nil, nil)
-				if err != nil {
-					continue
-				}
+		case b := <-h.deliver:
+			if b.chatroomId == hubEventChatroomId {
+				h.handleEvent(b.message)
+			} else if chatroom, ok := h.chatrooms[b.chatroomId]; ok && chatroom == b.chatroom {
+				chatroom.send <- b.message
+			}
+		case f := <-h.call:
+			f()
+		}
+	}
+}
 
-				for _, chatroom := range chatrooms {
-					chatroomId := chatroom.ID
-					if c, ok := h.Chatrooms[chatroomId]; ok {
-						// 채팅방이 존재하는 경우
-						client.Chatrooms[chatroom.ID] = c
-					} else {
-						// 채팅방이 존재하지 않는 경우
-						c := &Chatroom{
-							ChatroomID: chatroomId,
-							Clients: map[*Client]bool{
-								client: true,
-							},
-							Send: make(chan Chat),
-						}
-						client.Chatrooms[chatroom.ID] = c
-						h.Chatrooms[chatroom.ID] = c
-
-						go c.Open()
-					}
-				}
+func (h *ChatHub) subscribeEvents() error {
+	_, err := h.Broker.Subscribe(hubEventChatroomId, func(message []byte) {
+		h.deliver <- broadcast{chatroomId: hubEventChatroomId, message: message}
+	})
+	return err
+}
+
+// hubEvent를 받지 못하면 다른 인스턴스에서 연 채팅방에 참여하지 못하므로, 구독될 때까지 다시 시도한다.
+func (h *ChatHub) retrySubscribeEvents() {
+	backoff := eventSubscribeBackoff
+	for {
+		time.Sleep(backoff)
+		err := h.subscribeEvents()
+		if err == nil {
+			return
+		}
+		log.Println("hub event subscription failed:", err)
+		if backoff *= 2; backoff > eventSubscribeMaxBackoff {
+			backoff = eventSubscribeMaxBackoff
+		}
+	}
+}
+
+// 사용자가 참여 중인 채팅방을 조회해 클라이언트를 등록한다.
+// 한 사용자가 여러 기기에서 접속하면 각 연결을 따로 등록한다.
+// 채팅방 구독까지 마친 뒤에 돌아오므로, 그 뒤에 발행된 메시지는 빠짐없이 받는다.
+func (h *ChatHub) Register(client *Client) error {
+	chatroomIds, err := h.ChatService.GetChatroomIds(client.UserID)
+	if err != nil {
+		return err
+	}
+	var (
+		online bool
+		joined []*Chatroom
+	)
+	h.do(func() {
+		online, joined = h.addClient(client, chatroomIds)
+	})
+	waitSubscribed(joined)
+
+	if online {
+		h.updatePresence(client.UserID, chatroomIds, true)
+	}
+	return nil
+}
+
+// 사용자의 마지막 연결이 끊기면 채팅방에 접속 종료를 알린다.
+func (h *ChatHub) Unregister(client *Client) {
+	var (
+		offline     bool
+		chatroomIds []int
+	)
+	h.do(func() {
+		chatroomIds = make([]int, 0, len(client.chatrooms))
+		for chatroomId := range client.chatrooms {
+			chatroomIds = append(chatroomIds, chatroomId)
+		}
+		offline = h.removeClient(client)
+	})
+
+	if offline {
+		h.updatePresence(client.UserID, chatroomIds, false)
+	}
+}
+
+// 마지막 접속 시간을 저장하고 사용자가 참여 중인 채팅방에 presence 프레임을 보낸다.
+// 인스턴스마다 따로 판단하므로, 여러 인스턴스에 접속한 사용자는 각 인스턴스의 연결이 모두 끊길 때마다 알린다.
+func (h *ChatHub) updatePresence(userId string, chatroomIds []int, online bool) {
+	lastSeenAt := time.Now()
+	if err := h.ChatService.UpdateLastSeen(userId, lastSeenAt); err != nil {
+		log.Println(err)
+	}
+
+	presence := Presence{UserID: userId, Online: online}
+	if !online {
+		presence.LastSeenAt = &lastSeenAt
+	}
+
+	for _, chatroomId := range chatroomIds {
+		presence.ChatroomID = chatroomId
+		frame, err := newFrame(FramePresence, presence)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		if err := h.Broadcast(chatroomId, frame); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// 이 인스턴스에 접속 중인 사용자들을 채팅방에 참여시킨다. 모든 인스턴스에서 참여시키려면 Open을 쓴다.
+func (h *ChatHub) Join(chatroomId int, userIds ...string) {
+	var joined []*Chatroom
+	h.do(func() {
+		for _, userId := range userIds {
+			for client := range h.clients[userId] {
+				joined = append(joined, h.joinChatroom(client, chatroomId))
+			}
+		}
+	})
+	waitSubscribed(joined)
+}
+
+// 새로 만든 채팅방에 접속 중인 참여자들을 모든 인스턴스에서 참여시킨다.
+// chatroom이 있으면 recipientId의 연결에 chatroom 프레임으로 보내 채팅방 목록에 바로 추가되게 한다.
+// 이 인스턴스의 연결은 돌아오기 전에 참여하므로, 그 뒤에 보낸 메시지는 빠짐없이 받는다.
+func (h *ChatHub) Open(chatroomId int, userIds []string, recipientId string, chatroom *models.Chatroom) error {
+	event := hubEvent{
+		Origin:      h.id,
+		ChatroomID:  chatroomId,
+		UserIDs:     userIds,
+		RecipientID: recipientId,
+	}
+	if chatroom != nil {
+		frame, err := newFrame(FrameChatroom, chatroom)
+		if err != nil {
+			return err
+		}
+		event.Frame = frame
+	}
+
+	var joined []*Chatroom
+	h.do(func() {
+		joined = h.openChatroom(event)
+	})
+	waitSubscribed(joined)
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return h.Broker.Publish(hubEventChatroomId, data)
+}
+
+// 다른 인스턴스가 보낸 hubEvent를 처리한다. Run 고루틴에서 호출한다.
+func (h *ChatHub) handleEvent(message []byte) {
+	event := hubEvent{}
+	if err := json.Unmarshal(message, &event); err != nil {
+		log.Println(err)
+		return
+	}
+	if event.Origin == h.id {
+		return
+	}
+	h.openChatroom(event)
+}
 
-				go client.ReadPump()
-				go client.WritePump()
+func (h *ChatHub) openChatroom(event hubEvent) (joined []*Chatroom) {
+	for _, userId := range event.UserIDs {
+		for client := range h.clients[userId] {
+			joined = append(joined, h.joinChatroom(client, event.ChatroomID))
+			if userId == event.RecipientID && len(event.Frame) > 0 {
+				client.send(event.Frame)
 			}
-		case client := <-h.Unregister:
-			for _, chatroom := range client.Chatrooms {
-				if len(chatroom.Clients) <= 1 {
-					delete(h.Clients, client.UserID)
-					delete(h.Chatrooms, chatroom.ChatroomID)
-					close(chatroom.Send)
-					close(client.Send)
-				} else {
-					delete(h.Clients, client.UserID)
-					delete(chatroom.Clients, client)
-					close(client.Send)
+		}
+	}
+	return
+}
+
+// 사용자의 연결을 채팅방에서 뺀다. 사용자가 채팅방을 나갔을 때 호출한다.
+// 다른 인스턴스에 있는 연결은 다시 접속할 때 빠진다.
+func (h *ChatHub) Leave(chatroomId int, userIds ...string) {
+	h.do(func() {
+		for _, userId := range userIds {
+			for client := range h.clients[userId] {
+				if chatroom, ok := client.chatrooms[chatroomId]; ok {
+					h.leaveChatroom(client, chatroom)
 				}
 			}
 		}
+	})
+}
+
+// 채팅방에 접속해 있는 모든 클라이언트에게 메시지를 보낸다.
+// Broker가 구독 중인 모든 인스턴스에 전달하므로 Run 고루틴에서 호출하면 안 된다.
+func (h *ChatHub) Broadcast(chatroomId int, message []byte) error {
+	return h.Broker.Publish(chatroomId, message)
+}
+
+// Run 고루틴에서 f를 실행하고 끝날 때까지 기다린다.
+func (h *ChatHub) do(f func()) {
+	done := make(chan struct{})
+	h.call <- func() {
+		f()
+		close(done)
+	}
+	<-done
+}
+
+// 사용자의 첫 연결이면 true를 돌려준다.
+func (h *ChatHub) addClient(client *Client, chatroomIds []int) (online bool, joined []*Chatroom) {
+	if _, ok := h.clients[client.UserID]; !ok {
+		h.clients[client.UserID] = make(map[*Client]bool)
+		online = true
+	}
+
+	h.clients[client.UserID][client] = true
+	for _, chatroomId := range chatroomIds {
+		joined = append(joined, h.joinChatroom(client, chatroomId))
+	}
+	return
+}
+
+// 사용자의 마지막 연결이었으면 true를 돌려준다.
+func (h *ChatHub) removeClient(client *Client) (offline bool) {
+	devices := h.clients[client.UserID]
+	if !devices[client] {
+		return
+	}
+
+	delete(devices, client)
+	if len(devices) == 0 {
+		delete(h.clients, client.UserID)
+		offline = true
+	}
+	for _, chatroom := range client.chatrooms {
+		h.leaveChatroom(client, chatroom)
+	}
+	client.close()
+	return
+}
+
+// 클라이언트가 들어간 채팅방을 돌려준다. 새로 연 채팅방은 Broker 구독을 다른 고루틴에서 시작하므로,
+// 그 뒤에 발행된 메시지를 빠짐없이 받으려면 Run 고루틴 밖에서 waitSubscribed로 기다린다.
+func (h *ChatHub) joinChatroom(client *Client, chatroomId int) *Chatroom {
+	if chatroom, ok := client.chatrooms[chatroomId]; ok {
+		return chatroom
+	}
+
+	chatroom, ok := h.chatrooms[chatroomId]
+	if !ok {
+		chatroom = newChatroom(chatroomId)
+		h.chatrooms[chatroomId] = chatroom
+		go chatroom.Open()
+		go h.subscribe(chatroom)
+	}
+
+	chatroom.join <- client
+	chatroom.size++
+	client.chatrooms[chatroomId] = chatroom
+	return chatroom
+}
+
+func waitSubscribed(chatrooms []*Chatroom) {
+	for _, chatroom := range chatrooms {
+		<-chatroom.subscribed
+	}
+}
+
+// 마지막 클라이언트가 나가면 채팅방을 닫는다.
+func (h *ChatHub) leaveChatroom(client *Client, chatroom *Chatroom) {
+	chatroom.leave <- client
+	chatroom.size--
+	delete(client.chatrooms, chatroom.ChatroomID)
+
+	if chatroom.size == 0 {
+		delete(h.chatrooms, chatroom.ChatroomID)
+		close(chatroom.send)
+		if chatroom.subscription != nil {
+			go unsubscribe(chatroom.subscription)
+		}
+	}
+}
+
+// 이 인스턴스에 채팅방 참여자가 있는 동안만 Broker의 메시지를 받는다.
+// Broker가 네트워크를 거칠 수 있으므로 Run 고루틴이 아닌 곳에서 구독하고, 끝나면 subscribed를 닫는다.
+// 구독하지 못하면 다른 인스턴스의 메시지만 받지 못하므로 채팅방은 그대로 연다.
+func (h *ChatHub) subscribe(chatroom *Chatroom) {
+	defer close(chatroom.subscribed)
+
+	chatroomId := chatroom.ChatroomID
+	subscription, err := h.Broker.Subscribe(chatroomId, func(message []byte) {
+		h.deliver <- broadcast{chatroomId: chatroomId, chatroom: chatroom, message: message}
+	})
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	// 구독하는 동안 채팅방이 닫혔으면 바로 해제한다.
+	h.do(func() {
+		if h.chatrooms[chatroomId] == chatroom {
+			chatroom.subscription = subscription
+		} else {
+			go unsubscribe(subscription)
+		}
+	})
+}
+
+func unsubscribe(subscription Subscription) {
+	if err := subscription.Unsubscribe(); err != nil {
+		log.Println(err)
+	}
+}
+
+// 클라이언트가 보낸 메시지를 저장하고 채팅방에 전달한다.
+// 보낸 사람은 페이로드가 아니라 인증된 연결의 사용자로 정한다.
+// clientMsgId가 있으면 처리 결과를 ack로 알리고, 재전송된 메시지는 다시 저장하거나 전달하지 않는다.
+func (h *ChatHub) HandleChat(client *Client, clientMsgId string, chat Chat) {
+	chat.UserID = client.UserID
+	if chat.Type == "" {
+		chat.Type = models.TEXT
+	}
+
+	if chat.Type != models.TEXT && chat.Type != models.LOCATION {
+		client.rejectChat(clientMsgId, ErrInvalidFrame, "소켓으로 보낼 수 없는 메시지 종류입니다.", chat.ChatroomID)
+		return
+	}
+
+	if !h.AllowChat(client.UserID, chat.ChatroomID) {
+		client.rejectChat(clientMsgId, ErrRateLimited, RateLimitedMessage, chat.ChatroomID)
+		return
+	}
+
+	if !h.ChatService.CheckCorrectUser(client.UserID, chat.ChatroomID) {
+		client.rejectChat(clientMsgId, ErrForbidden, "참여하지 않은 채팅방입니다.", chat.ChatroomID)
+		return
+	}
+
+	if chat.TemplateID != 0 {
+		if chat.Type != models.TEXT {
+			client.rejectChat(clientMsgId, ErrInvalidFrame, "답장 템플릿은 TEXT 메시지로만 보낼 수 있습니다.", chat.ChatroomID)
+			return
+		}
+		template, err := h.ChatService.GetReplyTemplate(client.UserID, chat.TemplateID)
+		if err == gorm.ErrRecordNotFound {
+			client.rejectChat(clientMsgId, ErrInvalidFrame, "존재하지 않는 답장 템플릿입니다.", chat.ChatroomID)
+			return
+		}
+		if err != nil {
+			log.Println(err)
+			client.rejectChat(clientMsgId, ErrInternal, "답장 템플릿을 불러오지 못했습니다.", chat.ChatroomID)
+			return
+		}
+		chat.Message = template.Content
+	}
+
+	record := &models.Chat{
+		ChatroomID: chat.ChatroomID,
+		Type:       chat.Type,
+		Content:    chat.Message,
+		Payload:    chat.Payload,
+	}
+	if clientMsgId != "" {
+		record.ClientMsgID = &clientMsgId
+	}
+
+	duplicate, err := h.ChatService.InsertChat(client.UserID, record)
+	if err == services.ErrInvalidChat || err == services.ErrChatTooLong {
+		client.rejectChat(clientMsgId, ErrInvalidFrame, err.Error(), chat.ChatroomID)
+		return
+	}
+	if err == services.ErrCounterpartLeft {
+		client.rejectChat(clientMsgId, ErrForbidden, err.Error(), chat.ChatroomID)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		client.rejectChat(clientMsgId, ErrInternal, "메시지를 저장하지 못했습니다.", chat.ChatroomID)
+		return
+	}
+
+	if !duplicate {
+		if err := h.PublishChat(client.UserID, record); err != nil {
+			log.Println(err)
+			client.rejectChat(clientMsgId, ErrInternal, "메시지를 전달하지 못했습니다.", chat.ChatroomID)
+			return
+		}
+	}
+
+	if clientMsgId != "" {
+		client.sendAck(clientMsgId, Ack{
+			ChatroomID: chat.ChatroomID,
+			ChatID:     record.ID,
+			SendDate:   newChat(client.UserID, record).SendDate,
+			Duplicate:  duplicate,
+		})
+	}
+}
+
+// 메시지를 보내는 속도 제한을 넘지 않았으면 true를 돌려준다. REST로 보내는 메시지도 같은 제한을 받는다.
+func (h *ChatHub) AllowChat(userId string, chatroomId int) bool {
+	return h.Limiter == nil || h.Limiter.Allow(userId, chatroomId)
+}
+
+// 저장된 메시지를 채팅방에 전달한다. 업로드 API로 보낸 이미지나 서버가 만든 SYSTEM 메시지도 이것으로 보낸다.
+func (h *ChatHub) PublishChat(userId string, chat *models.Chat) error {
+	clientMsgId := ""
+	if chat.ClientMsgID != nil {
+		clientMsgId = *chat.ClientMsgID
+	}
+
+	message, err := newReplyFrame(FrameChat, clientMsgId, newChat(userId, chat))
+	if err != nil {
+		return err
+	}
+	if err := h.Broadcast(chat.ChatroomID, message); err != nil {
+		return err
+	}
+
+	if h.NotificationService != nil {
+		go h.notifyOffline(userId, chat)
+	}
+	return nil
+}
+
+// buyerId가 새로 만든 채팅방의 판매자가 자리 비움 모드이면 자동 응답을 판매자의 SYSTEM 메시지로 보낸다.
+// 첫 메시지를 보낸 뒤에 호출해야 자동 응답이 그 뒤에 온다.
+func (h *ChatHub) SendAwayReply(chatroomId int, buyerId string) {
+	chat, err := h.ChatService.CreateAwayReply(chatroomId, buyerId)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	if chat == nil {
+		return
+	}
+	if err := h.PublishChat(chat.UserID, chat); err != nil {
+		log.Println(err)
+	}
+}
+
+// 보낸 사람을 뺀 참여자 중 이 인스턴스에 연결이 하나도 없는 사용자에게 푸시 알림을 보낸다.
+// 다른 인스턴스의 연결은 알 수 없으므로, 그곳에만 접속한 사용자도 알림을 받는다.
+func (h *ChatHub) notifyOffline(senderId string, chat *models.Chat) {
+	userIds, err := h.ChatService.GetChatroomUserIds(chat.ChatroomID)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	offline := []string{}
+	h.do(func() {
+		for _, userId := range userIds {
+			if userId != senderId && len(h.clients[userId]) == 0 {
+				offline = append(offline, userId)
+			}
+		}
+	})
+
+	if len(offline) > 0 {
+		h.NotificationService.NotifyChat(senderId, offline, chat)
+	}
+}
+
+// 읽은 위치를 저장하고 채팅방의 다른 참여자에게 알린다.
+func (h *ChatHub) HandleRead(client *Client, read Read) {
+	if !h.ChatService.CheckCorrectUser(client.UserID, read.ChatroomID) {
+		client.sendError(ErrForbidden, "참여하지 않은 채팅방입니다.", read.ChatroomID)
+		return
+	}
+
+	lastReadChatId, err := h.ChatService.ReadChats(read.ChatroomID, client.UserID, read.LastReadChatID)
+	if err == gorm.ErrRecordNotFound {
+		client.sendError(ErrInvalidFrame, "채팅방에 없는 메시지입니다.", read.ChatroomID)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		client.sendError(ErrInternal, "읽음 상태를 저장하지 못했습니다.", read.ChatroomID)
+		return
+	}
+
+	if err := h.NotifyRead(read.ChatroomID, client.UserID, lastReadChatId); err != nil {
+		log.Println(err)
+	}
+}
+
+// 읽음 이벤트는 채팅방 전체에 보내므로 상대방과 같은 사용자의 다른 기기가 함께 받는다.
+func (h *ChatHub) NotifyRead(chatroomId int, userId string, lastReadChatId int) error {
+	message, err := newFrame(FrameRead, Read{
+		ChatroomID:     chatroomId,
+		UserID:         userId,
+		LastReadChatID: lastReadChatId,
+	})
+	if err != nil {
+		return err
+	}
+	return h.Broadcast(chatroomId, message)
+}
+
+// 보낸 메시지를 수정하거나 취소하고 채팅방에 알린다.
+func (h *ChatHub) HandleChatUpdate(client *Client, clientMsgId string, frameType string, update ChatUpdate) {
+	if !h.AllowChat(client.UserID, update.ChatroomID) {
+		client.rejectChat(clientMsgId, ErrRateLimited, RateLimitedMessage, update.ChatroomID)
+		return
+	}
+
+	var (
+		chat *models.Chat
+		err  error
+	)
+	if frameType == FrameEdit {
+		chat, err = h.ChatService.EditChat(client.UserID, update.ChatroomID, update.ChatID, update.Message)
+	} else {
+		chat, err = h.ChatService.UnsendChat(client.UserID, update.ChatroomID, update.ChatID)
+	}
+
+	if err != nil {
+		code, message := updateError(err)
+		client.rejectChat(clientMsgId, code, message, update.ChatroomID)
+		return
+	}
+
+	if err := h.PublishChatUpdate(client.UserID, chat); err != nil {
+		log.Println(err)
+	}
+
+	if clientMsgId != "" {
+		client.sendAck(clientMsgId, Ack{ChatroomID: chat.ChatroomID, ChatID: chat.ID})
+	}
+}
+
+func updateError(err error) (ErrorCode, string) {
+	switch err {
+	case services.ErrNotChatSender:
+		return ErrForbidden, err.Error()
+	case services.ErrEditWindowExpired:
+		return ErrExpired, err.Error()
+	case services.ErrChatDeleted, services.ErrInvalidChat, services.ErrChatTooLong:
+		return ErrInvalidFrame, err.Error()
+	case gorm.ErrRecordNotFound:
+		return ErrInvalidFrame, "존재하지 않는 메시지입니다."
+	}
+	log.Println(err)
+	return ErrInternal, "메시지를 수정하지 못했습니다."
+}
+
+// 수정되거나 취소된 메시지를 채팅방에 알린다.
+func (h *ChatHub) PublishChatUpdate(userId string, chat *models.Chat) error {
+	frameType := FrameEdited
+	if chat.DeletedAt != nil {
+		frameType = FrameDeleted
+	}
+
+	message, err := newFrame(frameType, newChat(userId, chat))
+	if err != nil {
+		return err
+	}
+	return h.Broadcast(chat.ChatroomID, message)
+}
+
+// 사용자의 모든 채팅방에서 since 이후의 메시지를 요청한 연결에만 보낸다.
+func (h *ChatHub) HandleSync(client *Client, clientMsgId string, request SyncRequest) {
+	chats, hasMore, err := h.ChatService.SyncChats(client.UserID, request.Since, request.Size)
+	if err != nil {
+		log.Println(err)
+		client.sendError(ErrInternal, "메시지를 불러오지 못했습니다.", 0)
+		return
+	}
+
+	sync := Sync{Chats: make([]Chat, len(chats)), HasMore: hasMore}
+	for i := range chats {
+		sync.Chats[i] = newChat(chats[i].UserID, &chats[i])
+	}
+
+	frame, err := newReplyFrame(FrameSync, clientMsgId, sync)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	client.send(frame)
+}
+
+// 입력 중 상태는 저장하지 않고 채팅방에 바로 전달한다.
+func (h *ChatHub) HandleTyping(client *Client, frameType string, typing Typing) {
+	typing.UserID = client.UserID
+
+	var joined bool
+	h.do(func() {
+		_, joined = client.chatrooms[typing.ChatroomID]
+	})
+	if !joined {
+		client.sendError(ErrForbidden, "참여하지 않은 채팅방입니다.", typing.ChatroomID)
+		return
+	}
+
+	message, err := newFrame(frameType, typing)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	if err := h.Broadcast(typing.ChatroomID, message); err != nil {
+		log.Println(err)
+	}
+}
+
+// 클라이언트가 보낸 프레임을 종류에 맞게 처리한다.
+// 버전이 없는 프레임은 envelope 도입 전의 채팅 메시지 형식으로 본다.
+func (h *ChatHub) HandleFrame(client *Client, data []byte) {
+	envelope := Envelope{}
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		client.sendError(ErrInvalidFrame, "메시지 형식이 올바르지 않습니다.", 0)
+		return
+	}
+
+	if envelope.Version == 0 && envelope.Type == "" {
+		envelope = Envelope{Version: ProtocolVersion, Type: FrameChat, Payload: data}
+	}
+	if envelope.Version != ProtocolVersion {
+		client.sendError(ErrInvalidFrame, "지원하지 않는 프로토콜 버전입니다.", 0)
+		return
+	}
+
+	var err error
+	switch envelope.Type {
+	case FrameChat:
+		chat := Chat{}
+		if err = json.Unmarshal(envelope.Payload, &chat); err == nil {
+			h.HandleChat(client, envelope.ClientMsgID, chat)
+		}
+	case FrameRead:
+		read := Read{}
+		if err = json.Unmarshal(envelope.Payload, &read); err == nil {
+			h.HandleRead(client, read)
+		}
+	case FrameSync:
+		request := SyncRequest{}
+		if err = json.Unmarshal(envelope.Payload, &request); err == nil {
+			h.HandleSync(client, envelope.ClientMsgID, request)
+		}
+	case FrameEdit, FrameDelete:
+		update := ChatUpdate{}
+		if err = json.Unmarshal(envelope.Payload, &update); err == nil {
+			h.HandleChatUpdate(client, envelope.ClientMsgID, envelope.Type, update)
+		}
+	case FrameTyping, FrameStoppedTyping:
+		typing := Typing{}
+		if err = json.Unmarshal(envelope.Payload, &typing); err == nil {
+			h.HandleTyping(client, envelope.Type, typing)
+		}
+	default:
+		client.sendError(ErrInvalidFrame, "지원하지 않는 메시지 종류입니다.", 0)
+	}
+
+	if err != nil {
+		client.sendError(ErrInvalidFrame, "메시지 형식이 올바르지 않습니다.", 0)
 	}
 }
@@ -0,0 +1,800 @@
+package chat
+
+import (
+	"carrot-market-clone-api/models"
+	"carrot-market-clone-api/services"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+type stubChatService struct {
+	services.ChatService
+	chatroomIds map[string][]int
+
+	mutex      sync.Mutex
+	lastChatId int
+	saved      map[string]models.Chat
+}
+
+func (s *stubChatService) GetChatroomIds(userId string) ([]int, error) {
+	return s.chatroomIds[userId], nil
+}
+
+func (s *stubChatService) GetChatroomUserIds(chatroomId int) ([]string, error) {
+	userIds := []string{}
+	for userId := range s.chatroomIds {
+		if s.CheckCorrectUser(userId, chatroomId) {
+			userIds = append(userIds, userId)
+		}
+	}
+	return userIds, nil
+}
+
+func (s *stubChatService) CheckCorrectUser(userId string, chatroomId int) bool {
+	for _, id := range s.chatroomIds[userId] {
+		if id == chatroomId {
+			return true
+		}
+	}
+	return false
+}
+
+// 채팅방마다 마지막 메시지의 ID는 10이라고 가정한다.
+func (s *stubChatService) ReadChats(chatroomId int, userId string, chatId int) (int, error) {
+	if chatId == 0 {
+		return 10, nil
+	}
+	if chatId > 10 {
+		return 0, gorm.ErrRecordNotFound
+	}
+	return chatId, nil
+}
+
+func (s *stubChatService) UpdateLastSeen(userId string, lastSeenAt time.Time) error {
+	return nil
+}
+
+func (s *stubChatService) InsertChat(userId string, chat *models.Chat) (bool, error) {
+	if chat.Type == models.TEXT && chat.Content == "" {
+		return false, services.ErrInvalidChat
+	}
+	if utf8.RuneCountInString(chat.Content) > services.MaxChatLength {
+		return false, services.ErrChatTooLong
+	}
+	if chat.Content == "fail" {
+		return false, gorm.ErrInvalidDB
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if chat.ClientMsgID != nil {
+		if saved, ok := s.saved[userId+*chat.ClientMsgID]; ok {
+			*chat = saved
+			return true, nil
+		}
+	}
+
+	s.lastChatId++
+	chat.ID = s.lastChatId
+	if chat.ClientMsgID != nil {
+		chat.SendDate = time.Date(2022, 1, 1, 12, 0, 0, 0, time.UTC)
+		if s.saved == nil {
+			s.saved = make(map[string]models.Chat)
+		}
+		s.saved[userId+*chat.ClientMsgID] = *chat
+	}
+	return false, nil
+}
+
+// since 이후의 메시지 ID를 차례로 만들어 돌려준다.
+func (s *stubChatService) SyncChats(userId string, since int, size int) ([]models.Chat, bool, error) {
+	chats := []models.Chat{}
+	for id := since + 1; id <= since+size; id++ {
+		chats = append(chats, models.Chat{ID: id, ChatroomID: 1, Type: models.TEXT, Content: "missed", UserID: "seller"})
+	}
+	return chats, true, nil
+}
+
+// buyer가 보낸 1번 메시지만 수정하거나 취소할 수 있다고 가정한다.
+func (s *stubChatService) EditChat(userId string, chatroomId, chatId int, content string) (*models.Chat, error) {
+	if err := s.checkEditable(userId, chatId); err != nil {
+		return nil, err
+	}
+	editedAt := time.Date(2022, 1, 1, 12, 1, 0, 0, time.UTC)
+	return &models.Chat{ID: chatId, ChatroomID: chatroomId, Type: models.TEXT, Content: content, EditedAt: &editedAt}, nil
+}
+
+func (s *stubChatService) UnsendChat(userId string, chatroomId, chatId int) (*models.Chat, error) {
+	if err := s.checkEditable(userId, chatId); err != nil {
+		return nil, err
+	}
+	deletedAt := time.Date(2022, 1, 1, 12, 2, 0, 0, time.UTC)
+	return &models.Chat{ID: chatId, ChatroomID: chatroomId, Type: models.TEXT, Content: models.DeletedChatContent, DeletedAt: &deletedAt}, nil
+}
+
+func (s *stubChatService) checkEditable(userId string, chatId int) error {
+	if chatId != 1 {
+		return gorm.ErrRecordNotFound
+	}
+	if userId != "buyer" {
+		return services.ErrNotChatSender
+	}
+	return nil
+}
+
+// seller만 1번 답장 템플릿을 가지고 있다고 가정한다.
+func (s *stubChatService) GetReplyTemplate(userId string, templateId int) (*models.ReplyTemplate, error) {
+	if userId != "seller" || templateId != 1 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &models.ReplyTemplate{ID: 1, UserID: userId, Content: "아직 판매 중입니다."}, nil
+}
+
+// 1번 채팅방의 seller만 자리 비움 모드라고 가정한다.
+func (s *stubChatService) CreateAwayReply(chatroomId int, buyerId string) (*models.Chat, error) {
+	if chatroomId != 1 {
+		return nil, nil
+	}
+	return &models.Chat{
+		ID:         20,
+		ChatroomID: chatroomId,
+		Type:       models.SYSTEM,
+		Content:    "휴가 중입니다.",
+		Payload:    []byte(`{"event":"AWAY_REPLY"}`),
+		UserID:     "seller",
+	}, nil
+}
+
+// 알림을 보낼 사용자를 채널로 전달한다.
+type stubNotificationService struct {
+	notified chan []string
+}
+
+func (s *stubNotificationService) NotifyChat(senderId string, userIds []string, chat *models.Chat) {
+	s.notified <- userIds
+}
+
+func newTestHub(chatroomIds map[string][]int) *ChatHub {
+	return newTestHubWithBroker(chatroomIds, NewLocalBroker())
+}
+
+func newTestHubWithBroker(chatroomIds map[string][]int, broker Broker) *ChatHub {
+	h := NewChatHub(&stubChatService{chatroomIds: chatroomIds}, nil, broker, nil)
+	go h.Run()
+	return h
+}
+
+// presence 프레임은 건너뛰고 다음 메시지를 돌려준다.
+func receive(t *testing.T, client *Client) string {
+	t.Helper()
+	for {
+		message := receiveFrame(t, client)
+		if !strings.Contains(message, `"type":"presence"`) {
+			return message
+		}
+	}
+}
+
+func receiveFrame(t *testing.T, client *Client) string {
+	t.Helper()
+	select {
+	case message, ok := <-client.Send:
+		if !ok {
+			t.Fatalf("send channel of %s is closed", client.UserID)
+		}
+		return string(message)
+	case <-time.After(time.Second):
+		t.Fatalf("%s did not receive a message", client.UserID)
+	}
+	return ""
+}
+
+func assertClosed(t *testing.T, client *Client) {
+	t.Helper()
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case _, ok := <-client.Send:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("send channel of %s is not closed", client.UserID)
+		}
+	}
+}
+
+func TestChatHubBroadcast(t *testing.T) {
+	h := newTestHub(map[string][]int{
+		"seller": {1, 2},
+		"buyer":  {1},
+	})
+
+	seller := NewClient("seller", nil, h)
+	buyer := NewClient("buyer", nil, h)
+	assert.NoError(t, h.Register(seller))
+	assert.NoError(t, h.Register(buyer))
+
+	h.Broadcast(1, []byte("hello"))
+	assert.Equal(t, "hello", receive(t, seller))
+	assert.Equal(t, "hello", receive(t, buyer))
+
+	h.Broadcast(2, []byte("only seller"))
+	assert.Equal(t, "only seller", receive(t, seller))
+
+	// 참여자가 없는 채팅방은 무시된다.
+	h.Broadcast(3, []byte("nobody"))
+	h.do(func() {
+		assert.Len(t, h.chatrooms, 2)
+	})
+	assert.Len(t, buyer.Send, 0)
+}
+
+func TestChatHubJoin(t *testing.T) {
+	h := newTestHub(nil)
+
+	seller := NewClient("seller", nil, h)
+	buyer := NewClient("buyer", nil, h)
+	assert.NoError(t, h.Register(seller))
+	assert.NoError(t, h.Register(buyer))
+
+	// 두 사용자가 접속해 있는 동안 만들어진 채팅방
+	h.Join(1, "seller", "buyer", "offline")
+	h.Join(1, "seller")
+
+	h.Broadcast(1, []byte("new chatroom"))
+	assert.Equal(t, "new chatroom", receive(t, seller))
+	assert.Equal(t, "new chatroom", receive(t, buyer))
+
+	h.do(func() {
+		assert.Equal(t, 2, h.chatrooms[1].size)
+	})
+}
+
+func TestChatHubLeave(t *testing.T) {
+	h := newTestHub(map[string][]int{"seller": {1, 2}, "buyer": {1}})
+
+	phone := NewClient("seller", nil, h)
+	web := NewClient("seller", nil, h)
+	buyer := NewClient("buyer", nil, h)
+	assert.NoError(t, h.Register(phone))
+	assert.NoError(t, h.Register(web))
+	assert.NoError(t, h.Register(buyer))
+
+	// 나간 사용자의 모든 연결이 채팅방에서 빠지고, 다른 채팅방은 그대로 받는다.
+	h.Leave(1, "seller")
+	h.Leave(1, "seller")
+
+	h.Broadcast(1, []byte("after leave"))
+	assert.Equal(t, "after leave", receive(t, buyer))
+	h.Broadcast(2, []byte("still joined"))
+	assert.Equal(t, "still joined", receive(t, phone))
+	assert.Equal(t, "still joined", receive(t, web))
+
+	h.Leave(1, "buyer")
+	h.do(func() {
+		_, ok := h.chatrooms[1]
+		assert.False(t, ok)
+		assert.Equal(t, 2, h.chatrooms[2].size)
+	})
+}
+
+func TestChatHubUnregister(t *testing.T) {
+	h := newTestHub(map[string][]int{
+		"seller": {1, 2},
+		"buyer":  {1, 2},
+	})
+
+	seller := NewClient("seller", nil, h)
+	buyer := NewClient("buyer", nil, h)
+	assert.NoError(t, h.Register(seller))
+	assert.NoError(t, h.Register(buyer))
+
+	var chatrooms []*Chatroom
+	h.do(func() {
+		chatrooms = []*Chatroom{h.chatrooms[1], h.chatrooms[2]}
+	})
+
+	// 여러 채팅방에 참여 중이어도 Send는 한 번만 닫힌다.
+	h.Unregister(seller)
+	h.Unregister(seller)
+	assertClosed(t, seller)
+
+	h.Broadcast(1, []byte("after seller left"))
+	assert.Equal(t, "after seller left", receive(t, buyer))
+
+	h.Unregister(buyer)
+	assertClosed(t, buyer)
+
+	for _, chatroom := range chatrooms {
+		select {
+		case <-chatroom.done:
+		case <-time.After(time.Second):
+			t.Fatalf("chatroom %d is still open", chatroom.ChatroomID)
+		}
+	}
+
+	h.do(func() {
+		assert.Len(t, h.clients, 0)
+		assert.Len(t, h.chatrooms, 0)
+	})
+}
+
+func TestChatHubMultipleDevices(t *testing.T) {
+	h := newTestHub(map[string][]int{"seller": {1}, "buyer": {1}})
+
+	phone := NewClient("seller", nil, h)
+	tablet := NewClient("seller", nil, h)
+	buyer := NewClient("buyer", nil, h)
+	assert.NoError(t, h.Register(phone))
+	assert.NoError(t, h.Register(tablet))
+	assert.NoError(t, h.Register(buyer))
+
+	h.Broadcast(1, []byte("hello"))
+	assert.Equal(t, "hello", receive(t, phone))
+	assert.Equal(t, "hello", receive(t, tablet))
+	assert.Equal(t, "hello", receive(t, buyer))
+
+	// 새로 만들어진 채팅방에는 모든 기기가 참여한다.
+	h.Join(2, "seller")
+	h.Broadcast(2, []byte("new chatroom"))
+	assert.Equal(t, "new chatroom", receive(t, phone))
+	assert.Equal(t, "new chatroom", receive(t, tablet))
+
+	// 한 기기의 연결이 끊겨도 다른 기기는 계속 받는다.
+	h.Unregister(phone)
+	assertClosed(t, phone)
+
+	h.Broadcast(1, []byte("after phone left"))
+	assert.Equal(t, "after phone left", receive(t, tablet))
+	assert.Equal(t, "after phone left", receive(t, buyer))
+
+	h.do(func() {
+		assert.Len(t, h.clients["seller"], 1)
+		assert.Equal(t, 2, h.chatrooms[1].size)
+	})
+
+	h.Unregister(tablet)
+	assertClosed(t, tablet)
+	h.do(func() {
+		_, ok := h.clients["seller"]
+		assert.False(t, ok)
+		_, ok = h.chatrooms[2]
+		assert.False(t, ok)
+	})
+}
+
+func TestChatHubHandleRead(t *testing.T) {
+	h := newTestHub(map[string][]int{"seller": {1}, "buyer": {1}, "stranger": {2}})
+
+	seller := NewClient("seller", nil, h)
+	buyer := NewClient("buyer", nil, h)
+	stranger := NewClient("stranger", nil, h)
+	assert.NoError(t, h.Register(seller))
+	assert.NoError(t, h.Register(buyer))
+	assert.NoError(t, h.Register(stranger))
+
+	// 보낸 사람은 페이로드가 아니라 연결의 사용자로 정한다.
+	h.HandleRead(buyer, Read{ChatroomID: 1, UserID: "seller", LastReadChatID: 5})
+	expected := `{"v":1,"type":"read","payload":{"chatroomId":1,"userId":"buyer","lastReadChatId":5}}`
+	assert.Equal(t, expected, receive(t, seller))
+	assert.Equal(t, expected, receive(t, buyer))
+
+	h.HandleRead(buyer, Read{ChatroomID: 1})
+	assert.Contains(t, receive(t, seller), `"lastReadChatId":10`)
+	receive(t, buyer)
+
+	h.HandleRead(buyer, Read{ChatroomID: 1, LastReadChatID: 11})
+	assert.Contains(t, receive(t, buyer), string(ErrInvalidFrame))
+
+	h.HandleRead(stranger, Read{ChatroomID: 1})
+	assert.Contains(t, receive(t, stranger), string(ErrForbidden))
+	assert.Len(t, seller.Send, 0)
+}
+
+func TestChatHubHandleFrame(t *testing.T) {
+	h := newTestHub(map[string][]int{"seller": {1}, "buyer": {1}})
+
+	seller := NewClient("seller", nil, h)
+	buyer := NewClient("buyer", nil, h)
+	assert.NoError(t, h.Register(seller))
+	assert.NoError(t, h.Register(buyer))
+
+	h.HandleFrame(buyer, []byte(`{"v":1,"type":"chat","payload":{"chatroomId":1,"message":"hello"}}`))
+	expected := `{"v":1,"type":"chat","payload":{"id":1,"type":"TEXT","message":"hello","userId":"buyer","chatroomId":1}}`
+	assert.Equal(t, expected, receive(t, seller))
+	assert.Equal(t, expected, receive(t, buyer))
+
+	// 버전이 없는 이전 형식의 채팅 메시지
+	h.HandleFrame(buyer, []byte(`{"chatroomId":1,"message":"legacy"}`))
+	assert.Contains(t, receive(t, seller), `"message":"legacy"`)
+	receive(t, buyer)
+
+	h.HandleFrame(buyer, []byte(`{"v":1,"type":"chat","payload":{"chatroomId":1,"type":"LOCATION","message":"여기서 봬요","payload":{"latitude":37.5,"longitude":127}}}`))
+	assert.Equal(t,
+		`{"v":1,"type":"chat","payload":{"id":3,"type":"LOCATION","message":"여기서 봬요","payload":{"latitude":37.5,"longitude":127},"userId":"buyer","chatroomId":1}}`,
+		receive(t, seller))
+	receive(t, buyer)
+
+	// IMAGE는 업로드 API로, SYSTEM은 서버만 보낼 수 있다.
+	h.HandleFrame(buyer, []byte(`{"v":1,"type":"chat","payload":{"chatroomId":1,"type":"IMAGE","payload":{"url":"https://example.com/a.png"}}}`))
+	assert.Contains(t, receive(t, buyer), string(ErrInvalidFrame))
+	h.HandleFrame(buyer, []byte(`{"v":1,"type":"chat","payload":{"chatroomId":1,"type":"SYSTEM","message":"판매 완료"}}`))
+	assert.Contains(t, receive(t, buyer), string(ErrInvalidFrame))
+	h.HandleFrame(buyer, []byte(`{"v":1,"type":"chat","payload":{"chatroomId":1,"message":""}}`))
+	assert.Contains(t, receive(t, buyer), string(ErrInvalidFrame))
+
+	h.HandleFrame(buyer, []byte(`{"v":1,"type":"typing","payload":{"chatroomId":1}}`))
+	assert.Equal(t, `{"v":1,"type":"typing","payload":{"chatroomId":1,"userId":"buyer"}}`, receive(t, seller))
+	receive(t, buyer)
+
+	h.HandleFrame(buyer, []byte(`{"v":1,"type":"stopped_typing","payload":{"chatroomId":1}}`))
+	assert.Equal(t, `{"v":1,"type":"stopped_typing","payload":{"chatroomId":1,"userId":"buyer"}}`, receive(t, seller))
+	receive(t, buyer)
+
+	h.HandleFrame(buyer, []byte(`{"v":1,"type":"typing","payload":{"chatroomId":2}}`))
+	assert.Contains(t, receive(t, buyer), string(ErrForbidden))
+
+	for _, data := range []string{
+		`not json`,
+		`{"v":2,"type":"chat","payload":{}}`,
+		`{"v":1,"type":"unknown"}`,
+		`{"v":1,"type":"chat","payload":"not an object"}`,
+	} {
+		h.HandleFrame(buyer, []byte(data))
+		assert.Contains(t, receive(t, buyer), string(ErrInvalidFrame), data)
+	}
+	assert.Len(t, seller.Send, 0)
+}
+
+func TestChatHubAck(t *testing.T) {
+	h := newTestHub(map[string][]int{"seller": {1}, "buyer": {1}})
+
+	seller := NewClient("seller", nil, h)
+	buyer := NewClient("buyer", nil, h)
+	assert.NoError(t, h.Register(seller))
+	assert.NoError(t, h.Register(buyer))
+
+	frame := []byte(`{"v":1,"type":"chat","clientMsgId":"m1","payload":{"chatroomId":1,"message":"hello"}}`)
+	h.HandleFrame(buyer, frame)
+	expected := `{"v":1,"type":"chat","clientMsgId":"m1","payload":{"id":1,"type":"TEXT","message":"hello","userId":"buyer","chatroomId":1,"sendDate":"2022-01-01T12:00:00Z"}}`
+	assert.Equal(t, expected, receive(t, seller))
+	// ack는 보낸 연결에 바로 보내므로 채팅방으로 전달된 메시지보다 먼저 올 수 있다.
+	assert.ElementsMatch(t, []string{
+		expected,
+		`{"v":1,"type":"ack","clientMsgId":"m1","payload":{"chatroomId":1,"chatId":1,"sendDate":"2022-01-01T12:00:00Z"}}`,
+	}, []string{receive(t, buyer), receive(t, buyer)})
+
+	// 다시 연결한 뒤 재전송한 메시지는 저장하거나 전달하지 않고 같은 ID로 ack한다.
+	reconnected := NewClient("buyer", nil, h)
+	assert.NoError(t, h.Register(reconnected))
+	h.HandleFrame(reconnected, frame)
+	assert.Equal(t,
+		`{"v":1,"type":"ack","clientMsgId":"m1","payload":{"chatroomId":1,"chatId":1,"sendDate":"2022-01-01T12:00:00Z","duplicate":true}}`,
+		receive(t, reconnected))
+	assert.Len(t, seller.Send, 0)
+
+	// 실패도 ack로 알린다.
+	h.HandleFrame(buyer, []byte(`{"v":1,"type":"chat","clientMsgId":"m2","payload":{"chatroomId":1,"message":"fail"}}`))
+	assert.Equal(t,
+		`{"v":1,"type":"ack","clientMsgId":"m2","payload":{"chatroomId":1,"error":{"code":"INTERNAL","message":"메시지를 저장하지 못했습니다.","chatroomId":1}}}`,
+		receive(t, buyer))
+	h.HandleFrame(buyer, []byte(`{"v":1,"type":"chat","clientMsgId":"m3","payload":{"chatroomId":2,"message":"hello"}}`))
+	assert.Contains(t, receive(t, buyer), `"clientMsgId":"m3","payload":{"chatroomId":2,"error":{"code":"FORBIDDEN"`)
+	assert.Len(t, seller.Send, 0)
+
+	// 너무 긴 메시지도 연결을 끊지 않고 ack로 거절한다.
+	long := strings.Repeat("가", services.MaxChatLength+1)
+	h.HandleFrame(buyer, []byte(`{"v":1,"type":"chat","clientMsgId":"m4","payload":{"chatroomId":1,"message":"`+long+`"}}`))
+	assert.Equal(t,
+		`{"v":1,"type":"ack","clientMsgId":"m4","payload":{"chatroomId":1,"error":{"code":"INVALID_FRAME","message":"`+services.ErrChatTooLong.Error()+`","chatroomId":1}}}`,
+		receive(t, buyer))
+	assert.Len(t, seller.Send, 0)
+}
+
+// 가장 긴 메시지를 모두 \uXXXX로 이스케이프해도 소켓의 읽기 제한 안에 들어간다.
+func TestMaxMessageSize(t *testing.T) {
+	message := strings.Repeat(`\uac00`, services.MaxChatLength)
+	frame := `{"v":1,"type":"edit","clientMsgId":"` + strings.Repeat("m", 64) + `","payload":{"chatroomId":2147483647,"chatId":2147483647,"message":"` + message + `"}}`
+	assert.LessOrEqual(t, len(frame), maxMessageSize)
+}
+
+// 너무 빠르게 보낸 메시지는 저장하지 않고 RATE_LIMITED로 거절한다.
+func TestChatHubRateLimit(t *testing.T) {
+	h := newTestHub(map[string][]int{"seller": {1}, "buyer": {1}})
+	h.Limiter = NewRateLimiter(Rate{PerSecond: 0.001, Burst: 10}, Rate{PerSecond: 0.001, Burst: 2})
+
+	seller := NewClient("seller", nil, h)
+	buyer := NewClient("buyer", nil, h)
+	assert.NoError(t, h.Register(seller))
+	assert.NoError(t, h.Register(buyer))
+
+	for i := 1; i <= 2; i++ {
+		h.HandleFrame(buyer, []byte(fmt.Sprintf(`{"v":1,"type":"chat","payload":{"chatroomId":1,"message":"hello %d"}}`, i)))
+		assert.Contains(t, receive(t, seller), fmt.Sprintf(`"message":"hello %d"`, i))
+		receive(t, buyer)
+	}
+
+	h.HandleFrame(buyer, []byte(`{"v":1,"type":"chat","clientMsgId":"m3","payload":{"chatroomId":1,"message":"hello 3"}}`))
+	assert.Equal(t,
+		`{"v":1,"type":"ack","clientMsgId":"m3","payload":{"chatroomId":1,"error":{"code":"RATE_LIMITED","message":"`+RateLimitedMessage+`","chatroomId":1}}}`,
+		receive(t, buyer))
+
+	h.HandleFrame(buyer, []byte(`{"v":1,"type":"edit","payload":{"chatroomId":1,"chatId":1,"message":"edited"}}`))
+	assert.Contains(t, receive(t, buyer), `"type":"error","payload":{"code":"RATE_LIMITED"`)
+	assert.Len(t, seller.Send, 0)
+
+	// 상대방은 따로 제한한다.
+	h.HandleFrame(seller, []byte(`{"v":1,"type":"chat","payload":{"chatroomId":1,"message":"reply"}}`))
+	assert.Contains(t, receive(t, buyer), `"message":"reply"`)
+}
+
+func TestChatHubSync(t *testing.T) {
+	h := newTestHub(map[string][]int{"seller": {1}, "buyer": {1}})
+
+	seller := NewClient("seller", nil, h)
+	buyer := NewClient("buyer", nil, h)
+	assert.NoError(t, h.Register(seller))
+	assert.NoError(t, h.Register(buyer))
+
+	h.HandleFrame(buyer, []byte(`{"v":1,"type":"sync","clientMsgId":"s1","payload":{"since":10,"size":2}}`))
+	assert.Equal(t,
+		`{"v":1,"type":"sync","clientMsgId":"s1","payload":{"chats":[`+
+			`{"id":11,"type":"TEXT","message":"missed","userId":"seller","chatroomId":1},`+
+			`{"id":12,"type":"TEXT","message":"missed","userId":"seller","chatroomId":1}],"hasMore":true}}`,
+		receive(t, buyer))
+
+	// 요청한 연결에만 보낸다.
+	assert.NoError(t, h.Broadcast(1, []byte("next")))
+	assert.Equal(t, "next", receive(t, seller))
+}
+
+func TestChatHubChatUpdate(t *testing.T) {
+	h := newTestHub(map[string][]int{"seller": {1}, "buyer": {1}})
+
+	seller := NewClient("seller", nil, h)
+	buyer := NewClient("buyer", nil, h)
+	assert.NoError(t, h.Register(seller))
+	assert.NoError(t, h.Register(buyer))
+
+	h.HandleFrame(buyer, []byte(`{"v":1,"type":"edit","payload":{"chatroomId":1,"chatId":1,"message":"edited"}}`))
+	expected := `{"v":1,"type":"edited","payload":{"id":1,"type":"TEXT","message":"edited","userId":"buyer","chatroomId":1,"editedAt":"2022-01-01T12:01:00Z"}}`
+	assert.Equal(t, expected, receive(t, seller))
+	assert.Equal(t, expected, receive(t, buyer))
+
+	h.HandleFrame(buyer, []byte(`{"v":1,"type":"delete","payload":{"chatroomId":1,"chatId":1}}`))
+	expected = `{"v":1,"type":"deleted","payload":{"id":1,"type":"TEXT","message":"삭제된 메시지입니다.","userId":"buyer","chatroomId":1,"deletedAt":"2022-01-01T12:02:00Z"}}`
+	assert.Equal(t, expected, receive(t, seller))
+	assert.Equal(t, expected, receive(t, buyer))
+
+	h.HandleFrame(seller, []byte(`{"v":1,"type":"delete","clientMsgId":"d1","payload":{"chatroomId":1,"chatId":1}}`))
+	assert.Contains(t, receive(t, seller), `"clientMsgId":"d1","payload":{"chatroomId":1,"error":{"code":"FORBIDDEN"`)
+
+	h.HandleFrame(buyer, []byte(`{"v":1,"type":"edit","payload":{"chatroomId":1,"chatId":2,"message":"edited"}}`))
+	assert.Contains(t, receive(t, buyer), string(ErrInvalidFrame))
+}
+
+func TestChatHubPublishChat(t *testing.T) {
+	h := newTestHub(map[string][]int{"seller": {1}, "buyer": {1}})
+
+	buyer := NewClient("buyer", nil, h)
+	assert.NoError(t, h.Register(buyer))
+
+	assert.NoError(t, h.PublishChat("seller", &models.Chat{
+		ID:         7,
+		ChatroomID: 1,
+		Type:       models.SYSTEM,
+		Content:    "판매자가 예약 중으로 변경했습니다.",
+		Payload:    []byte(`{"event":"PRODUCT_RESERVED"}`),
+	}))
+	assert.Equal(t,
+		`{"v":1,"type":"chat","payload":{"id":7,"type":"SYSTEM","message":"판매자가 예약 중으로 변경했습니다.","payload":{"event":"PRODUCT_RESERVED"},"userId":"seller","chatroomId":1}}`,
+		receive(t, buyer))
+}
+
+// templateId로 보낸 메시지는 보낸 사람의 답장 템플릿 내용으로 저장한다.
+func TestChatHubReplyTemplate(t *testing.T) {
+	h := newTestHub(map[string][]int{"seller": {1}, "buyer": {1}})
+
+	seller := NewClient("seller", nil, h)
+	buyer := NewClient("buyer", nil, h)
+	assert.NoError(t, h.Register(seller))
+	assert.NoError(t, h.Register(buyer))
+
+	h.HandleFrame(seller, []byte(`{"v":1,"type":"chat","payload":{"chatroomId":1,"message":"","templateId":1}}`))
+	expected := `{"v":1,"type":"chat","payload":{"id":1,"type":"TEXT","message":"아직 판매 중입니다.","userId":"seller","chatroomId":1}}`
+	assert.Equal(t, expected, receive(t, buyer))
+	assert.Equal(t, expected, receive(t, seller))
+
+	// 다른 사용자의 템플릿은 쓸 수 없다.
+	h.HandleFrame(buyer, []byte(`{"v":1,"type":"chat","clientMsgId":"t1","payload":{"chatroomId":1,"message":"","templateId":1}}`))
+	assert.Contains(t, receive(t, buyer), `"clientMsgId":"t1","payload":{"chatroomId":1,"error":{"code":"INVALID_FRAME"`)
+
+	h.HandleFrame(seller, []byte(`{"v":1,"type":"chat","payload":{"chatroomId":1,"type":"LOCATION","message":"","templateId":1}}`))
+	assert.Contains(t, receive(t, seller), `"type":"error","payload":{"code":"INVALID_FRAME"`)
+	assert.Len(t, buyer.Send, 0)
+}
+
+func TestChatHubSendAwayReply(t *testing.T) {
+	h := newTestHub(map[string][]int{"seller": {1, 2}, "buyer": {1, 2}})
+
+	buyer := NewClient("buyer", nil, h)
+	assert.NoError(t, h.Register(buyer))
+
+	h.SendAwayReply(1, "buyer")
+	assert.Equal(t,
+		`{"v":1,"type":"chat","payload":{"id":20,"type":"SYSTEM","message":"휴가 중입니다.","payload":{"event":"AWAY_REPLY"},"userId":"seller","chatroomId":1}}`,
+		receive(t, buyer))
+
+	// 자리 비움 모드가 아니면 보내지 않는다.
+	h.SendAwayReply(2, "buyer")
+	assert.NoError(t, h.Broadcast(2, []byte("next")))
+	assert.Equal(t, "next", receive(t, buyer))
+}
+
+// 접속하지 않은 참여자에게만 알림을 보낸다.
+func TestChatHubNotifyOffline(t *testing.T) {
+	h := newTestHub(map[string][]int{"seller": {1}, "buyer": {1}, "other": {2}})
+	notifications := &stubNotificationService{notified: make(chan []string, 1)}
+	h.NotificationService = notifications
+
+	seller := NewClient("seller", nil, h)
+	assert.NoError(t, h.Register(seller))
+
+	notified := func() []string {
+		select {
+		case userIds := <-notifications.notified:
+			return userIds
+		case <-time.After(time.Second):
+			t.Fatal("nobody was notified")
+			return nil
+		}
+	}
+
+	assert.NoError(t, h.PublishChat("seller", &models.Chat{ID: 1, ChatroomID: 1, Type: models.TEXT, Content: "hello"}))
+	assert.Equal(t, []string{"buyer"}, notified())
+
+	assert.NoError(t, h.PublishChat("buyer", &models.Chat{ID: 2, ChatroomID: 1, Type: models.TEXT, Content: "hi"}))
+	assert.NoError(t, h.PublishChat("seller", &models.Chat{ID: 3, ChatroomID: 1, Type: models.TEXT, Content: "again"}))
+	assert.Equal(t, []string{"buyer"}, notified())
+
+	buyer := NewClient("buyer", nil, h)
+	assert.NoError(t, h.Register(buyer))
+	assert.NoError(t, h.PublishChat("seller", &models.Chat{ID: 4, ChatroomID: 1, Type: models.TEXT, Content: "online"}))
+	select {
+	case userIds := <-notifications.notified:
+		t.Fatalf("unexpected notification to %v", userIds)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// gate가 닫혀 있는 동안 채팅방 1의 구독을 끝내지 않는 Broker
+type slowBroker struct {
+	Broker
+	gate chan struct{}
+}
+
+func (b *slowBroker) Subscribe(chatroomId int, handler func(message []byte)) (Subscription, error) {
+	if chatroomId == 1 {
+		<-b.gate
+	}
+	return b.Broker.Subscribe(chatroomId, handler)
+}
+
+// 구독이 느린 채팅방이 있어도 다른 채팅방은 막히지 않고, Register는 구독이 끝난 뒤에 돌아온다.
+func TestChatHubSlowSubscribe(t *testing.T) {
+	broker := &slowBroker{Broker: NewLocalBroker(), gate: make(chan struct{})}
+	h := newTestHubWithBroker(map[string][]int{"seller": {2}, "buyer": {1}}, broker)
+
+	seller := NewClient("seller", nil, h)
+	assert.NoError(t, h.Register(seller))
+
+	buyer := NewClient("buyer", nil, h)
+	registered := make(chan struct{})
+	go func() {
+		assert.NoError(t, h.Register(buyer))
+		close(registered)
+	}()
+
+	assert.NoError(t, h.Broadcast(2, []byte("not blocked")))
+	assert.Equal(t, "not blocked", receive(t, seller))
+	select {
+	case <-registered:
+		t.Fatal("Register returned before the subscription")
+	default:
+	}
+
+	close(broker.gate)
+	<-registered
+	assert.NoError(t, h.Broadcast(1, []byte("after register")))
+	assert.Equal(t, "after register", receive(t, buyer))
+}
+
+func TestChatHubPresence(t *testing.T) {
+	h := newTestHub(map[string][]int{"seller": {1}, "buyer": {1}})
+
+	seller := NewClient("seller", nil, h)
+	assert.NoError(t, h.Register(seller))
+	assert.Equal(t, `{"v":1,"type":"presence","payload":{"chatroomId":1,"userId":"seller","online":true}}`, receiveFrame(t, seller))
+
+	phone := NewClient("buyer", nil, h)
+	assert.NoError(t, h.Register(phone))
+	assert.Equal(t, `{"v":1,"type":"presence","payload":{"chatroomId":1,"userId":"buyer","online":true}}`, receiveFrame(t, seller))
+
+	// 이미 접속 중인 사용자의 다른 기기는 알리지 않는다.
+	tablet := NewClient("buyer", nil, h)
+	assert.NoError(t, h.Register(tablet))
+	h.Unregister(phone)
+	assert.Len(t, seller.Send, 0)
+
+	h.Unregister(tablet)
+	presence := receiveFrame(t, seller)
+	assert.Contains(t, presence, `"userId":"buyer","online":false,"lastSeenAt":`)
+}
+
+func TestChatHubSlowClient(t *testing.T) {
+	h := newTestHub(map[string][]int{"seller": {1}, "buyer": {1}})
+
+	seller := NewClient("seller", nil, h)
+	buyer := NewClient("buyer", nil, h)
+	assert.NoError(t, h.Register(seller))
+	assert.NoError(t, h.Register(buyer))
+
+	// buyer는 메시지를 읽지 않는다.
+	go func() {
+		for range seller.Send {
+		}
+	}()
+	for i := 0; i <= sendBufferSize; i++ {
+		h.Broadcast(1, []byte(fmt.Sprintf("message %d", i)))
+	}
+
+	assert.Eventually(t, func() bool {
+		buyer.mutex.Lock()
+		defer buyer.mutex.Unlock()
+		return buyer.closed
+	}, time.Second, 10*time.Millisecond)
+	assert.Len(t, buyer.Send, sendBufferSize)
+}
+
+func TestChatHubConcurrency(t *testing.T) {
+	chatroomIds := map[string][]int{}
+	for i := 0; i < 10; i++ {
+		chatroomIds[fmt.Sprintf("user %d", i%5)] = []int{i % 3, 3}
+	}
+	h := newTestHub(chatroomIds)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			userId := fmt.Sprintf("user %d", i%5)
+			for j := 0; j < 20; j++ {
+				client := NewClient(userId, nil, h)
+				go func() {
+					for range client.Send {
+					}
+				}()
+				assert.NoError(t, h.Register(client))
+				h.Join(4, userId)
+				h.Broadcast(j%5, []byte("message"))
+				client.sendError(ErrInternal, "error", 0)
+				h.Unregister(client)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	h.do(func() {
+		assert.Len(t, h.clients, 0)
+		assert.Len(t, h.chatrooms, 0)
+	})
+}
@@ -1,17 +1,47 @@
 package chat
 
+// Chatroom은 채팅방에 접속한 클라이언트들에게 메시지를 나눠 보낸다.
+// clients는 Open 고루틴만 접근하고, size는 ChatHub의 Run 고루틴만 접근한다.
+// join, leave, send는 ChatHub만 보내며, 방이 비면 ChatHub가 send를 닫아 Open을 끝낸다.
+// subscribed는 Broker 구독을 시도한 뒤에 닫힌다.
 type Chatroom struct {
-	ChatroomID int
-	Clients    map[*Client]bool
-	Send       chan Chat
+	ChatroomID   int
+	clients      map[*Client]bool
+	size         int
+	subscription Subscription
+	subscribed   chan struct{}
+	join         chan *Client
+	leave        chan *Client
+	send         chan []byte
+	done         chan struct{}
+}
+
+func newChatroom(chatroomId int) *Chatroom {
+	return &Chatroom{
+		ChatroomID: chatroomId,
+		clients:    make(map[*Client]bool),
+		subscribed: make(chan struct{}),
+		join:       make(chan *Client),
+		leave:      make(chan *Client),
+		send:       make(chan []byte, sendBufferSize),
+		done:       make(chan struct{}),
+	}
 }
 
 func (c *Chatroom) Open() {
+	defer close(c.done)
 	for {
 		select {
-		case message, _ := <-c.Send:
-			for client := range c.Clients {
-				client.Send <- message
+		case client := <-c.join:
+			c.clients[client] = true
+		case client := <-c.leave:
+			delete(c.clients, client)
+		case message, ok := <-c.send:
+			if !ok {
+				return
+			}
+			for client := range c.clients {
+				client.send(message)
 			}
 		}
 	}
@@ -1,8 +1,11 @@
 package chat
 
 import (
-	"encoding/json"
 	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -18,8 +21,14 @@ const (
 	// Send pings to peer with this period. Must be less than pongWait.
 	pingPeriod = (pongWait * 9) / 10
 
-	// Maximum message size allowed from peer.
-	maxMessageSize = 512
+	// Maximum message size allowed from peer. A frame carrying a chat of
+	// services.MaxChatLength characters, even with every character escaped
+	// as \uXXXX, must fit so that long chats get an error frame instead of
+	// closing the connection.
+	maxMessageSize = 8192
+
+	// Maximum number of outgoing messages buffered per client.
+	sendBufferSize = 256
 )
 
 var (
@@ -27,23 +36,101 @@ var (
 	space   = []byte{' '}
 )
 
+// Server-Sent Events로 접속한 클라이언트는 Conn 없이 EventPump로 Send를 내보낸다.
+// Send는 send와 close를 통해서만 쓰고 닫는다. 여러 채팅방과 ChatHub가
+// 동시에 보내더라도 닫힌 채널에 보내거나 두 번 닫지 않도록 mutex로 보호한다.
 type Client struct {
-	UserID    string
-	Chatrooms map[int]*Chatroom
-	Send      chan Chat
-	Conn      *websocket.Conn
-	Hub       *ChatHub
+	UserID string
+	Send   chan []byte
+	Conn   *websocket.Conn
+	Hub    *ChatHub
+
+	// ChatHub의 Run 고루틴만 접근한다.
+	chatrooms map[int]*Chatroom
+
+	mutex  sync.Mutex
+	closed bool
+}
+
+func NewClient(userId string, conn *websocket.Conn, hub *ChatHub) *Client {
+	return &Client{
+		UserID:    userId,
+		Send:      make(chan []byte, sendBufferSize),
+		Conn:      conn,
+		Hub:       hub,
+		chatrooms: make(map[int]*Chatroom),
+	}
+}
+
+// 버퍼가 가득 찰 만큼 느린 클라이언트는 연결을 끊는다.
+func (c *Client) send(message []byte) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.closed {
+		return false
+	}
+
+	select {
+	case c.Send <- message:
+		return true
+	default:
+		c.closed = true
+		close(c.Send)
+		return false
+	}
 }
 
-type Chat struct {
-	Message    string `json:"message"`
-	UserID     string `json:"userId"`
-	ChatroomID int    `json:"chatroomId"`
+func (c *Client) close() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if !c.closed {
+		c.closed = true
+		close(c.Send)
+	}
+}
+
+func (c *Client) sendError(code ErrorCode, message string, chatroomId int) {
+	frame, err := newFrame(FrameError, Error{
+		Code:       code,
+		Message:    message,
+		ChatroomID: chatroomId,
+	})
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	c.send(frame)
+}
+
+func (c *Client) sendAck(clientMsgId string, ack Ack) {
+	frame, err := newReplyFrame(FrameAck, clientMsgId, ack)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	c.send(frame)
+}
+
+// clientMsgId가 있으면 실패한 ack로, 없으면 error 프레임으로 알린다.
+func (c *Client) rejectChat(clientMsgId string, code ErrorCode, message string, chatroomId int) {
+	if clientMsgId == "" {
+		c.sendError(code, message, chatroomId)
+		return
+	}
+
+	c.sendAck(clientMsgId, Ack{
+		ChatroomID: chatroomId,
+		Error:      &Error{Code: code, Message: message, ChatroomID: chatroomId},
+	})
 }
 
 func (c *Client) ReadPump() {
 	defer func() {
-		c.Hub.Unregister <- c
+		c.Hub.Unregister(c)
 		c.Conn.Close()
 	}()
 
@@ -55,21 +142,15 @@ func (c *Client) ReadPump() {
 	})
 
 	for {
-		chat := Chat{}
-		err := c.Conn.ReadJSON(&chat)
-		if err != nil {
-			fmt.Println(err)
-			break
-		}
-		err = c.Hub.ChatService.InsertChat(chat.ChatroomID, chat.UserID, chat.Message)
+		_, data, err := c.Conn.ReadMessage()
 		if err != nil {
-			fmt.Println(err)
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				log.Println(err)
+			}
 			break
 		}
 
-		if chatroom, ok := c.Chatrooms[chat.ChatroomID]; ok {
-			chatroom.Send <- chat
-		}
+		c.Hub.HandleFrame(c, data)
 	}
 }
 
@@ -92,20 +173,16 @@ func (c *Client) WritePump() {
 			if err != nil {
 				return
 			}
-			jsonString, err := json.Marshal(message)
-			if err != nil {
-				return
-			}
-			w.Write(jsonString)
+			w.Write(message)
 
 			n := len(c.Send)
 			for i := 0; i < n; i++ {
-				w.Write(newline)
-				msg, err := json.Marshal(<-c.Send)
-				if err != nil {
-					return
+				next, ok := <-c.Send
+				if !ok {
+					break
 				}
-				w.Write(msg)
+				w.Write(newline)
+				w.Write(next)
 			}
 
 			if err := w.Close(); err != nil {
@@ -119,3 +196,40 @@ func (c *Client) WritePump() {
 		}
 	}
 }
+
+// EventPump는 WebSocket을 쓸 수 없는 클라이언트에게 Send의 프레임을 Server-Sent Events로 보낸다.
+// 프레임 하나를 data 한 줄짜리 이벤트로 보내며, 중간의 프록시가 연결을 끊지 않도록 주기적으로 주석을 보낸다.
+// done이 닫히거나 쓰기에 실패하면 ChatHub에서 등록을 해제하고 돌아온다.
+func (c *Client) EventPump(w http.ResponseWriter, done <-chan struct{}) {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.Hub.Unregister(c)
+	}()
+
+	flush := func() {
+		if flusher, ok := w.(http.Flusher); ok {
+			flusher.Flush()
+		}
+	}
+
+	for {
+		select {
+		case message, ok := <-c.Send:
+			if !ok {
+				return
+			}
+			if _, err := fmt.Fprintf(w, "data: %s\n\n", message); err != nil {
+				return
+			}
+			flush()
+		case <-ticker.C:
+			if _, err := io.WriteString(w, ": ping\n\n"); err != nil {
+				return
+			}
+			flush()
+		case <-done:
+			return
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package chat
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientEventPump(t *testing.T) {
+	h := newTestHub(map[string][]int{"seller": {1}, "buyer": {1}})
+
+	buyer := NewClient("buyer", nil, h)
+	assert.NoError(t, h.Register(buyer))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client := NewClient("seller", nil, h)
+		if err := h.Register(client); err != nil {
+			w.WriteHeader(500)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(200)
+		client.EventPump(w, r.Context().Done())
+	}))
+	defer server.Close()
+
+	res, err := http.Get(server.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, "text/event-stream", res.Header.Get("Content-Type"))
+
+	// 웹소켓으로 접속한 사용자가 보낸 메시지를 SSE로 받는다.
+	events := make(chan string, 10)
+	go func() {
+		scanner := bufio.NewScanner(res.Body)
+		for scanner.Scan() {
+			if line := scanner.Text(); strings.HasPrefix(line, "data: ") {
+				events <- strings.TrimPrefix(line, "data: ")
+			}
+		}
+		close(events)
+	}()
+
+	assert.NoError(t, h.Broadcast(1, []byte("over sse")))
+	timeout := time.After(2 * time.Second)
+	for received := false; !received; {
+		select {
+		case event := <-events:
+			received = event == "over sse"
+		case <-timeout:
+			t.Fatal("event not received")
+		}
+	}
+
+	// 연결을 끊으면 ChatHub에서 빠진다.
+	res.Body.Close()
+	assert.Eventually(t, func() bool {
+		var connected bool
+		h.do(func() {
+			_, connected = h.clients["seller"]
+		})
+		return !connected
+	}, 2*time.Second, 10*time.Millisecond)
+}
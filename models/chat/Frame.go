@@ -0,0 +1,167 @@
+package chat
+
+import (
+	"carrot-market-clone-api/models"
+	"encoding/json"
+	"time"
+)
+
+// 소켓 프로토콜 버전. 페이로드 형식이 호환되지 않게 바뀌면 올린다.
+const ProtocolVersion = 1
+
+const (
+	FrameChat          = "chat"
+	FrameRead          = "read"
+	FrameTyping        = "typing"
+	FrameStoppedTyping = "stopped_typing"
+	FramePresence      = "presence"
+	FrameAck           = "ack"
+	FrameSync          = "sync"
+	FrameEdit          = "edit"
+	FrameEdited        = "edited"
+	FrameDelete        = "delete"
+	FrameDeleted       = "deleted"
+	FrameChatroom      = "chatroom"
+	FrameError         = "error"
+)
+
+// Envelope는 소켓으로 주고받는 모든 프레임의 공통 형식이다.
+// payload의 형식은 type에 따라 정해진다.
+// clientMsgId는 클라이언트가 보낸 프레임을 구분하며, 서버는 그 프레임에 대한 ack와 채팅 메시지에 같은 값을 담아 보낸다.
+type Envelope struct {
+	Version     int             `json:"v"`
+	Type        string          `json:"type"`
+	ClientMsgID string          `json:"clientMsgId,omitempty"`
+	Payload     json.RawMessage `json:"payload,omitempty"`
+}
+
+func newFrame(frameType string, payload interface{}) ([]byte, error) {
+	return newReplyFrame(frameType, "", payload)
+}
+
+func newReplyFrame(frameType, clientMsgId string, payload interface{}) ([]byte, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(Envelope{
+		Version:     ProtocolVersion,
+		Type:        frameType,
+		ClientMsgID: clientMsgId,
+		Payload:     data,
+	})
+}
+
+// 채팅 메시지 프레임. type이 없으면 TEXT이며, payload의 형식은 models.Chat과 같다.
+// 클라이언트는 TEXT와 LOCATION만 보낼 수 있고, IMAGE는 업로드 API로 보낸다.
+// flags가 있으면 의심스러운 메시지이므로 받는 사람에게 주의 문구를 보여준다.
+// templateId를 보내면 message 대신 보낸 사람의 답장 템플릿 내용으로 보낸다.
+type Chat struct {
+	ID         int                 `json:"id,omitempty"`
+	Type       models.ChatType     `json:"type,omitempty"`
+	Message    string              `json:"message"`
+	Payload    json.RawMessage     `json:"payload,omitempty"`
+	UserID     string              `json:"userId"`
+	ChatroomID int                 `json:"chatroomId"`
+	SendDate   *time.Time          `json:"sendDate,omitempty"`
+	EditedAt   *time.Time          `json:"editedAt,omitempty"`
+	DeletedAt  *time.Time          `json:"deletedAt,omitempty"`
+	Flags      []models.FlagReason `json:"flags,omitempty"`
+	TemplateID int                 `json:"templateId,omitempty"`
+}
+
+func newChat(userId string, chat *models.Chat) Chat {
+	frame := Chat{
+		ID:         chat.ID,
+		Type:       chat.Type,
+		Message:    chat.Content,
+		Payload:    chat.Payload,
+		UserID:     userId,
+		ChatroomID: chat.ChatroomID,
+		EditedAt:   chat.EditedAt,
+		DeletedAt:  chat.DeletedAt,
+		Flags:      chat.Flags,
+	}
+	if !chat.SendDate.IsZero() {
+		sendDate := chat.SendDate
+		frame.SendDate = &sendDate
+	}
+	return frame
+}
+
+// 새 채팅방이 만들어졌을 때 상대방에게 보내는 chatroom 프레임의 payload는 models.Chatroom이며,
+// 채팅방 조회 API의 응답과 같다. 첫 메시지는 lastChat에 들어 있다.
+
+// 보낸 메시지를 수정(edit)하거나 취소(delete)하는 프레임. delete는 message를 쓰지 않는다.
+// 처리되면 채팅방에 바뀐 메시지를 edited, deleted 프레임으로 보낸다.
+type ChatUpdate struct {
+	ChatroomID int    `json:"chatroomId"`
+	ChatID     int    `json:"chatId"`
+	Message    string `json:"message,omitempty"`
+}
+
+// 접속이 끊긴 동안 놓친 메시지를 요청하는 프레임
+// 다시 연결하면 구독이 끝난 뒤에 요청을 처리하므로, 마지막으로 받은 메시지의 ID를 since로 보내면 빠지는 메시지가 없다.
+// 응답과 실시간 메시지에 같은 메시지가 함께 올 수 있으므로 클라이언트는 ID로 중복을 거른다.
+type SyncRequest struct {
+	Since int `json:"since"`
+	Size  int `json:"size,omitempty"`
+}
+
+// sync 요청에 대해 요청한 연결에만 보내는 프레임. hasMore가 true이면 마지막 메시지의 ID로 다시 요청한다.
+type Sync struct {
+	Chats   []Chat `json:"chats"`
+	HasMore bool   `json:"hasMore"`
+}
+
+// clientMsgId가 있는 채팅 메시지를 처리한 결과로 보낸 사람에게만 보내는 프레임
+// 저장에 실패하면 error가 채워지고, 이미 저장된 메시지를 다시 보낸 경우 duplicate가 true이다.
+type Ack struct {
+	ChatroomID int        `json:"chatroomId"`
+	ChatID     int        `json:"chatId,omitempty"`
+	SendDate   *time.Time `json:"sendDate,omitempty"`
+	Duplicate  bool       `json:"duplicate,omitempty"`
+	Error      *Error     `json:"error,omitempty"`
+}
+
+// 메시지를 어디까지 읽었는지 알리는 프레임
+// 클라이언트가 보낼 때 lastReadChatId가 0이면 채팅방의 마지막 메시지까지 읽은 것으로 본다.
+type Read struct {
+	ChatroomID     int    `json:"chatroomId"`
+	UserID         string `json:"userId"`
+	LastReadChatID int    `json:"lastReadChatId"`
+}
+
+// typing, stopped_typing 프레임. 저장하지 않고 채팅방에 바로 전달한다.
+type Typing struct {
+	ChatroomID int    `json:"chatroomId"`
+	UserID     string `json:"userId"`
+}
+
+// 참여자가 접속하거나 접속을 끊었을 때 채팅방에 보내는 프레임
+type Presence struct {
+	ChatroomID int        `json:"chatroomId"`
+	UserID     string     `json:"userId"`
+	Online     bool       `json:"online"`
+	LastSeenAt *time.Time `json:"lastSeenAt,omitempty"`
+}
+
+type ErrorCode string
+
+const (
+	ErrInvalidFrame ErrorCode = "INVALID_FRAME"
+	ErrForbidden    ErrorCode = "FORBIDDEN"
+	ErrInternal     ErrorCode = "INTERNAL"
+	ErrExpired      ErrorCode = "EXPIRED"
+	ErrRateLimited  ErrorCode = "RATE_LIMITED"
+)
+
+// 메시지를 너무 빠르게 보내 RATE_LIMITED로 거절할 때의 안내
+const RateLimitedMessage = "메시지를 너무 빠르게 보내고 있습니다. 잠시 후 다시 보내주세요."
+
+// 처리하지 못한 메시지에 대해 보낸 사람에게만 전달하는 프레임
+type Error struct {
+	Code       ErrorCode `json:"code"`
+	Message    string    `json:"message"`
+	ChatroomID int       `json:"chatroomId,omitempty"`
+}
@@ -0,0 +1,119 @@
+package chat
+
+import (
+	"sync"
+	"time"
+)
+
+// Rate는 토큰 버킷의 설정이다. 초마다 PerSecond개씩, 최대 Burst개까지 채워진다.
+type Rate struct {
+	PerSecond float64
+	Burst     int
+}
+
+var (
+	DefaultUserRate     = Rate{PerSecond: 3, Burst: 10}
+	DefaultChatroomRate = Rate{PerSecond: 1, Burst: 5}
+)
+
+// 이 시간마다 가득 찬 버킷을 지운다.
+const sweepInterval = time.Minute
+
+// RateLimiter는 사용자가 보내는 메시지를 사용자별, 사용자가 보내는 채팅방별 토큰 버킷으로 제한한다.
+// 사용자의 모든 연결이 같은 버킷을 쓰지만 인스턴스마다 따로 센다.
+type RateLimiter struct {
+	user     Rate
+	chatroom Rate
+	now      func() time.Time
+
+	mutex   sync.Mutex
+	buckets map[bucketKey]*bucket
+	sweptAt time.Time
+}
+
+// chatroomId가 0이면 사용자 전체의 버킷이다.
+type bucketKey struct {
+	userId     string
+	chatroomId int
+}
+
+type bucket struct {
+	tokens    float64
+	updatedAt time.Time
+}
+
+// 0으로 둔 설정은 기본값을 쓴다.
+func NewRateLimiter(user, chatroom Rate) *RateLimiter {
+	if user.PerSecond <= 0 || user.Burst <= 0 {
+		user = DefaultUserRate
+	}
+	if chatroom.PerSecond <= 0 || chatroom.Burst <= 0 {
+		chatroom = DefaultChatroomRate
+	}
+	return &RateLimiter{
+		user:     user,
+		chatroom: chatroom,
+		now:      time.Now,
+		buckets:  make(map[bucketKey]*bucket),
+	}
+}
+
+// 두 버킷에 모두 토큰이 있을 때만 하나씩 쓰고 true를 돌려준다.
+// 아직 없는 채팅방에 보내는 첫 메시지처럼 chatroomId가 0이면 사용자 버킷만 쓴다.
+func (l *RateLimiter) Allow(userId string, chatroomId int) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := l.now()
+	if now.Sub(l.sweptAt) >= sweepInterval {
+		l.sweep(now)
+	}
+
+	user := l.refill(bucketKey{userId: userId}, l.user, now)
+	if chatroomId == 0 {
+		if user.tokens < 1 {
+			return false
+		}
+		user.tokens--
+		return true
+	}
+
+	chatroom := l.refill(bucketKey{userId: userId, chatroomId: chatroomId}, l.chatroom, now)
+	if user.tokens < 1 || chatroom.tokens < 1 {
+		return false
+	}
+
+	user.tokens--
+	chatroom.tokens--
+	return true
+}
+
+func (l *RateLimiter) refill(key bucketKey, rate Rate, now time.Time) *bucket {
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(rate.Burst), updatedAt: now}
+		l.buckets[key] = b
+		return b
+	}
+
+	b.tokens += now.Sub(b.updatedAt).Seconds() * rate.PerSecond
+	if b.tokens > float64(rate.Burst) {
+		b.tokens = float64(rate.Burst)
+	}
+	b.updatedAt = now
+	return b
+}
+
+// 다시 가득 찼을 버킷은 처음 만드는 것과 같으므로 지운다.
+func (l *RateLimiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		rate := l.user
+		if key.chatroomId != 0 {
+			rate = l.chatroom
+		}
+		if b.tokens+now.Sub(b.updatedAt).Seconds()*rate.PerSecond >= float64(rate.Burst) {
+			delete(l.buckets, key)
+		}
+	}
+	l.sweptAt = now
+}
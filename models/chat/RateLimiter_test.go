@@ -0,0 +1,79 @@
+package chat
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestRateLimiter(user, chatroom Rate) (*RateLimiter, *time.Time) {
+	now := time.Date(2022, 1, 1, 12, 0, 0, 0, time.UTC)
+	l := NewRateLimiter(user, chatroom)
+	l.now = func() time.Time { return now }
+	return l, &now
+}
+
+func TestRateLimiterChatroom(t *testing.T) {
+	l, now := newTestRateLimiter(Rate{PerSecond: 10, Burst: 10}, Rate{PerSecond: 1, Burst: 2})
+
+	assert.True(t, l.Allow("buyer", 1))
+	assert.True(t, l.Allow("buyer", 1))
+	assert.False(t, l.Allow("buyer", 1))
+
+	// 다른 채팅방과 다른 사용자는 따로 센다.
+	assert.True(t, l.Allow("buyer", 2))
+	assert.True(t, l.Allow("seller", 1))
+
+	*now = now.Add(500 * time.Millisecond)
+	assert.False(t, l.Allow("buyer", 1))
+	*now = now.Add(500 * time.Millisecond)
+	assert.True(t, l.Allow("buyer", 1))
+	assert.False(t, l.Allow("buyer", 1))
+}
+
+func TestRateLimiterUser(t *testing.T) {
+	l, now := newTestRateLimiter(Rate{PerSecond: 1, Burst: 3}, Rate{PerSecond: 10, Burst: 10})
+
+	assert.True(t, l.Allow("buyer", 1))
+	assert.True(t, l.Allow("buyer", 2))
+	assert.True(t, l.Allow("buyer", 3))
+	assert.False(t, l.Allow("buyer", 4))
+
+	// 사용자 버킷이 비어 거절되면 채팅방 버킷의 토큰도 쓰지 않는다.
+	l.mutex.Lock()
+	assert.Equal(t, 10.0, l.buckets[bucketKey{userId: "buyer", chatroomId: 4}].tokens)
+	l.mutex.Unlock()
+
+	*now = now.Add(time.Second)
+	assert.True(t, l.Allow("buyer", 4))
+}
+
+func TestRateLimiterNewChatroom(t *testing.T) {
+	l, _ := newTestRateLimiter(Rate{PerSecond: 1, Burst: 2}, Rate{PerSecond: 1, Burst: 1})
+
+	// 채팅방이 없는 메시지는 사용자 버킷에서 한 번만 뺀다.
+	assert.True(t, l.Allow("buyer", 0))
+	assert.True(t, l.Allow("buyer", 0))
+	assert.False(t, l.Allow("buyer", 0))
+	assert.False(t, l.Allow("buyer", 1))
+}
+
+func TestRateLimiterSweep(t *testing.T) {
+	l, now := newTestRateLimiter(Rate{PerSecond: 1, Burst: 2}, Rate{PerSecond: 1, Burst: 2})
+
+	assert.True(t, l.Allow("buyer", 1))
+	*now = now.Add(sweepInterval)
+	assert.True(t, l.Allow("seller", 1))
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	assert.Len(t, l.buckets, 2)
+	assert.Contains(t, l.buckets, bucketKey{userId: "seller"})
+}
+
+func TestRateLimiterDefaults(t *testing.T) {
+	l := NewRateLimiter(Rate{}, Rate{PerSecond: 2})
+	assert.Equal(t, DefaultUserRate, l.user)
+	assert.Equal(t, DefaultChatroomRate, l.chatroom)
+}
@@ -0,0 +1,112 @@
+package chat
+
+import (
+	"carrot-market-clone-api/utils/redis"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const DefaultChannelPrefix = "chat:chatroom:"
+
+// RedisBroker는 채팅방마다 Redis 채널 하나를 구독해 여러 API 인스턴스 사이에 메시지를 전달한다.
+// 한 인스턴스 안에서는 채팅방당 한 번만 SUBSCRIBE하고, 받은 메시지를 로컬 구독들에 나눠 준다.
+// 채팅방의 첫 구독은 Redis가 SUBSCRIBE를 확인할 때까지 기다리며, 그동안 같은 채팅방의 다른 구독도 기다린다.
+// 확인을 기다리는 동안에는 mutex를 잡지 않으므로 다른 채팅방의 구독과 구독 해제는 막히지 않는다.
+type RedisBroker struct {
+	client        *redis.Client
+	prefix        string
+	mutex         sync.Mutex
+	subscriptions subscriptionSet
+	channels      map[int]*redisChannel
+}
+
+// redisChannel은 채팅방 채널의 SUBSCRIBE 결과이다. 확인되면 ready가 닫히고 err가 nil이다.
+// 구독이 실패하면 channels에서 지우므로, 다음 구독은 SUBSCRIBE를 다시 보낸다.
+type redisChannel struct {
+	ready chan struct{}
+	err   error
+}
+
+func NewRedisBroker(client *redis.Client, prefix string) Broker {
+	if prefix == "" {
+		prefix = DefaultChannelPrefix
+	}
+	b := &RedisBroker{
+		client:        client,
+		prefix:        prefix,
+		subscriptions: newSubscriptionSet(),
+		channels:      make(map[int]*redisChannel),
+	}
+	go b.dispatch()
+	return b
+}
+
+func (b *RedisBroker) Publish(chatroomId int, message []byte) error {
+	return b.client.Publish(b.channel(chatroomId), message)
+}
+
+func (b *RedisBroker) Subscribe(chatroomId int, handler func(message []byte)) (Subscription, error) {
+	b.mutex.Lock()
+	s := newSubscription(chatroomId, handler, b.unsubscribe)
+	b.subscriptions.add(s)
+	channel, ok := b.channels[chatroomId]
+	if !ok {
+		channel = &redisChannel{ready: make(chan struct{})}
+		b.channels[chatroomId] = channel
+	}
+	b.mutex.Unlock()
+
+	if !ok {
+		// 이전 구독의 UNSUBSCRIBE는 channels에서 지울 때 이미 보냈으므로 SUBSCRIBE보다 앞선다.
+		err := b.client.Subscribe(b.channel(chatroomId))
+
+		b.mutex.Lock()
+		channel.err = err
+		if err != nil {
+			delete(b.channels, chatroomId)
+		}
+		close(channel.ready)
+		b.mutex.Unlock()
+	}
+
+	<-channel.ready
+	if channel.err != nil {
+		// 확인되지 않은 SUBSCRIBE는 redis.Client가 취소하므로 UNSUBSCRIBE를 보내지 않는다.
+		b.mutex.Lock()
+		b.subscriptions.remove(s)
+		b.mutex.Unlock()
+		return nil, channel.err
+	}
+	return s, nil
+}
+
+func (b *RedisBroker) unsubscribe(s *subscription) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.subscriptions.remove(s) {
+		delete(b.channels, s.chatroomId)
+		if err := b.client.Unsubscribe(b.channel(s.chatroomId)); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+func (b *RedisBroker) channel(chatroomId int) string {
+	return b.prefix + strconv.Itoa(chatroomId)
+}
+
+func (b *RedisBroker) dispatch() {
+	for message := range b.client.Messages() {
+		if !strings.HasPrefix(message.Channel, b.prefix) {
+			continue
+		}
+		chatroomId, err := strconv.Atoi(strings.TrimPrefix(message.Channel, b.prefix))
+		if err != nil {
+			continue
+		}
+		b.subscriptions.publish(chatroomId, message.Payload)
+	}
+}
@@ -0,0 +1,102 @@
+package chat
+
+import (
+	"bufio"
+	"carrot-market-clone-api/utils/redis"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// SUBSCRIBE와 UNSUBSCRIBE에 확인 응답만 보내는 Redis 서버. silent 채널의 SUBSCRIBE에는 응답하지 않는다.
+func newSubscribeServer(t *testing.T, silent string) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			t.Cleanup(func() { conn.Close() })
+			go serveSubscribe(conn, silent)
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func serveSubscribe(conn net.Conn, silent string) {
+	reader := bufio.NewReader(conn)
+	for {
+		args, err := readArgs(reader)
+		if err != nil {
+			return
+		}
+		command, channel := strings.ToLower(args[0]), args[1]
+		if command == "subscribe" && channel == silent {
+			continue
+		}
+		fmt.Fprintf(conn, "*3\r\n$%d\r\n%s\r\n$%d\r\n%s\r\n:0\r\n", len(command), command, len(channel), channel)
+	}
+}
+
+func readArgs(reader *bufio.Reader) ([]string, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+	args := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		if _, err := reader.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		arg, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, strings.TrimSpace(arg))
+	}
+	return args, nil
+}
+
+// 확인되지 않은 SUBSCRIBE를 기다리는 동안에도 다른 채팅방의 구독과 구독 해제는 막히지 않는다.
+func TestRedisBrokerSlowSubscribe(t *testing.T) {
+	client, err := redis.Dial(newSubscribeServer(t, DefaultChannelPrefix+"1"), "")
+	assert.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+	b := NewRedisBroker(client, "")
+
+	go b.Subscribe(1, func(message []byte) {})
+	assert.Eventually(t, func() bool {
+		broker := b.(*RedisBroker)
+		broker.mutex.Lock()
+		defer broker.mutex.Unlock()
+		_, ok := broker.channels[1]
+		return ok
+	}, time.Second, 10*time.Millisecond)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s, err := b.Subscribe(2, func(message []byte) {})
+		if assert.NoError(t, err) {
+			assert.NoError(t, s.Unsubscribe())
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("subscribe to chatroom 2 is blocked by chatroom 1")
+	}
+}
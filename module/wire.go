@@ -9,6 +9,8 @@ import (
 	"carrot-market-clone-api/models/chat"
 	"carrot-market-clone-api/repositories"
 	"carrot-market-clone-api/services"
+	"carrot-market-clone-api/utils/encryption"
+	"carrot-market-clone-api/utils/push"
 	"gorm.io/gorm"
 
 	"github.com/aws/aws-sdk-go-v2/service/s3"
@@ -26,31 +28,57 @@ func InitProductController(db *gorm.DB, s3 *s3.Client) (c controllers.ProductCon
 	return
 }
 
-func InitAuthMiddleware(db *gorm.DB) (m middlewares.AuthMiddleware) {
+func InitAuthMiddleware(
+	db *gorm.DB,
+	revocationStore repositories.RevocationStore,
+) (m middlewares.AuthMiddleware) {
 	wire.Build(
 		repositories.NewUserRepositoryImpl,
+		repositories.NewTokenRepositoryImpl,
+		repositories.NewDeviceRepositoryImpl,
 		services.NewAuthServiceImpl,
 		middlewares.NewAuthMiddlewareImpl,
 	)
 	return
 }
 
-func InitUserController(db *gorm.DB, s3 *s3.Client) (c controllers.UserController) {
+func InitUserController(
+	db *gorm.DB,
+	s3 *s3.Client,
+	revocationStore repositories.RevocationStore,
+) (c controllers.UserController) {
 	wire.Build(
 		repositories.NewUserRepositoryImpl,
+		repositories.NewTokenRepositoryImpl,
+		repositories.NewDeviceRepositoryImpl,
 		services.NewAWSServiceImpl,
 		services.NewAuthServiceImpl,
+		services.NewDeviceServiceImpl,
+		encryption.NewPasswordHasher,
 		services.NewUserServiceImpl,
 		controllers.NewUserControllerImpl,
 	)
 	return
 }
 
-func InitChatController(db *gorm.DB) (c controllers.ChatController) {
+func InitChatController(
+	db *gorm.DB,
+	s3 *s3.Client,
+	broker chat.Broker,
+	limiter *chat.RateLimiter,
+	notifiers push.Notifiers,
+) (c controllers.ChatController) {
 	wire.Build(
 		repositories.NewProductRepositoryImpl,
 		repositories.NewChatRepositoryImpl,
+		repositories.NewUserRepositoryImpl,
+		repositories.NewDeviceRepositoryImpl,
+		repositories.NewReplyRepositoryImpl,
+		services.NewAWSServiceImpl,
+		services.NewContentChecker,
 		services.NewChatServiceImpl,
+		services.NewNotificationServiceImpl,
+		services.NewReplyServiceImpl,
 		chat.NewChatHub,
 		controllers.NewChatControllerImpl,
 	)
@@ -12,6 +12,8 @@ import (
 	"carrot-market-clone-api/models/chat"
 	"carrot-market-clone-api/repositories"
 	"carrot-market-clone-api/services"
+	"carrot-market-clone-api/utils/encryption"
+	"carrot-market-clone-api/utils/push"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"gorm.io/gorm"
 )
@@ -27,27 +29,40 @@ func InitProductController(db *gorm.DB, s3_2 *s3.Client) controllers.ProductCont
 	return productController
 }
 
-func InitAuthMiddleware(db *gorm.DB) middlewares.AuthMiddleware {
+func InitAuthMiddleware(db *gorm.DB, revocationStore repositories.RevocationStore) middlewares.AuthMiddleware {
 	userRepository := repositories.NewUserRepositoryImpl(db)
-	authService := services.NewAuthServiceImpl(userRepository)
+	tokenRepository := repositories.NewTokenRepositoryImpl(db)
+	deviceRepository := repositories.NewDeviceRepositoryImpl(db)
+	authService := services.NewAuthServiceImpl(userRepository, tokenRepository, deviceRepository, revocationStore)
 	authMiddleware := middlewares.NewAuthMiddlewareImpl(authService)
 	return authMiddleware
 }
 
-func InitUserController(db *gorm.DB, s3_2 *s3.Client) controllers.UserController {
+func InitUserController(db *gorm.DB, s3_2 *s3.Client, revocationStore repositories.RevocationStore) controllers.UserController {
 	userRepository := repositories.NewUserRepositoryImpl(db)
 	awsService := services.NewAWSServiceImpl(s3_2)
-	userService := services.NewUserServiceImpl(userRepository, awsService, s3_2)
-	authService := services.NewAuthServiceImpl(userRepository)
-	userController := controllers.NewUserControllerImpl(userService, authService, awsService, s3_2)
+	passwordHasher := encryption.NewPasswordHasher()
+	userService := services.NewUserServiceImpl(userRepository, awsService, passwordHasher, s3_2)
+	tokenRepository := repositories.NewTokenRepositoryImpl(db)
+	deviceRepository := repositories.NewDeviceRepositoryImpl(db)
+	authService := services.NewAuthServiceImpl(userRepository, tokenRepository, deviceRepository, revocationStore)
+	deviceService := services.NewDeviceServiceImpl(deviceRepository)
+	userController := controllers.NewUserControllerImpl(userService, authService, awsService, deviceService, s3_2)
 	return userController
 }
 
-func InitChatController(db *gorm.DB) controllers.ChatController {
+func InitChatController(db *gorm.DB, s3_2 *s3.Client, broker chat.Broker, limiter *chat.RateLimiter, notifiers push.Notifiers) controllers.ChatController {
 	productRepository := repositories.NewProductRepositoryImpl(db)
 	chatRepository := repositories.NewChatRepositoryImpl(db, productRepository)
-	chatService := services.NewChatServiceImpl(chatRepository)
-	chatHub := chat.NewChatHub(chatService)
-	chatController := controllers.NewChatControllerImpl(chatService, chatHub)
+	replyRepository := repositories.NewReplyRepositoryImpl(db)
+	awsService := services.NewAWSServiceImpl(s3_2)
+	contentChecker := services.NewContentChecker(chatRepository)
+	chatService := services.NewChatServiceImpl(chatRepository, replyRepository, awsService, contentChecker)
+	replyService := services.NewReplyServiceImpl(replyRepository)
+	userRepository := repositories.NewUserRepositoryImpl(db)
+	deviceRepository := repositories.NewDeviceRepositoryImpl(db)
+	notificationService := services.NewNotificationServiceImpl(chatRepository, userRepository, deviceRepository, notifiers)
+	chatHub := chat.NewChatHub(chatService, notificationService, broker, limiter)
+	chatController := controllers.NewChatControllerImpl(chatService, replyService, chatHub)
 	return chatController
 }
@@ -2,20 +2,55 @@ package repositories
 
 import (
 	"carrot-market-clone-api/models"
+	"strings"
+	"time"
 
 	"gorm.io/gorm"
 )
 
+// 최근 대화 순서로 정렬한 채팅방 목록에서 한 채팅방의 위치
+type ChatroomCursor struct {
+	LastActivityAt time.Time
+	ChatroomID     int
+}
+
+// GetChatrooms에서 조회한 사용자의 채팅방 설정으로 거르는 조건
+// Pinned가 nil이면 고정 여부와 상관없이 가져온다.
+type ChatroomFilter struct {
+	Archived bool
+	Pinned   *bool
+}
+
 type ChatRepository interface {
 	GetChat(chatId int) (chat *models.Chat, err error)
 
+	GetChatByClientMsgId(chatUserId int, clientMsgId string) (chat *models.Chat, err error)
+
 	GetChatrooms(
 		userId string,
-		last *int,
+		after *ChatroomCursor,
 		size *int,
+		filter ChatroomFilter,
 	) (chatrooms []models.Chatroom, count int, err error)
 
-	GetChatroom(chatroomId int) (chatroom *models.Chatroom, err error)
+	GetProductChatrooms(
+		productId int,
+		sellerId string,
+		after *ChatroomCursor,
+		size *int,
+	) (chatrooms []models.Chatroom, count int, err error)
+
+	GetProductOwnerId(productId int) (userId string)
+
+	GetChatroom(chatroomId int, userId string) (chatroom *models.Chatroom, err error)
+
+	GetChatroomsByIds(chatroomIds []int, userId string) (chatrooms []models.Chatroom, err error)
+
+	GetChatroomIds(userId string) (chatroomIds []int, err error)
+
+	GetChatroomUserIds(chatroomId int) (userIds []string, err error)
+
+	GetUnmutedUserIds(chatroomId int, userIds []string) (unmutedUserIds []string, err error)
 
 	GetChats(
 		chatroomId int,
@@ -23,12 +58,44 @@ type ChatRepository interface {
 		size int,
 	) (chats []models.Chat, count int, err error)
 
+	GetChatsSince(userId string, since int, size int) (chats []models.Chat, err error)
+
+	SearchChats(userId string, keyword string, before int, size int) (chats []models.Chat, err error)
+
+	GetTranscriptChatroom(chatroomId int) (chatroom *models.Chatroom, err error)
+
+	GetTranscriptChats(chatroomId int) (chats []models.Chat, err error)
+
+	GetChatroomId(productId int, buyerId string) (chatroomId int)
+
 	GetChatUserId(chatroomId int, userId string) (chatUserId int)
 
-	InsertChatroom(productId int, buyerId string) (chatroom *models.Chatroom, err error)
+	GetLastChatId(chatroomId int) (chatId int, err error)
+
+	GetLastReadChatId(chatroomId int, userId string) (chatId int, err error)
+
+	GetUnreadCounts(userId string, chatroomIds []int) (unreadCounts map[int]int, err error)
+
+	UpdateLastReadChatId(chatroomId int, userId string, chatId int) (err error)
+
+	UpdateLastSeen(userId string, lastSeenAt time.Time) (err error)
+
+	InsertChatroom(productId int, buyerId string, chat *models.Chat) (chatroom *models.Chatroom, err error)
 
 	InsertChat(chat *models.Chat) (err error)
 
+	InsertChatFlags(chatId int, reasons []models.FlagReason) (err error)
+
+	CountSellersWithContent(buyerId string, content string, since time.Time) (count int, err error)
+
+	LeaveChatroom(chatroomId int, userId string, chat *models.Chat, leftAt time.Time) (err error)
+
+	UpdateChatroomSettings(chatroomId int, userId string, settings models.ChatroomSettings, updatedAt time.Time) (err error)
+
+	UpdateChatContent(chatId int, content string, editedAt time.Time) (err error)
+
+	UnsendChat(chatId int, deletedAt time.Time) (err error)
+
 	DeleteChatroom(chatroomId int) (err error)
 
 	DeleteChat(chatId int) (err error)
@@ -36,6 +103,8 @@ type ChatRepository interface {
 	CheckChatroomExists(chatroomId int) (exists bool)
 
 	CheckCorrectUser(userId string, chatroomId int) (isCorrect bool)
+
+	CheckCounterpartLeft(userId string, chatroomId int) (left bool)
 }
 
 type ChatRepositoryImpl struct {
@@ -56,6 +125,15 @@ func (r *ChatRepositoryImpl) GetChat(chatId int) (chat *models.Chat, err error)
 	return
 }
 
+func (r *ChatRepositoryImpl) GetChatByClientMsgId(chatUserId int, clientMsgId string) (chat *models.Chat, err error) {
+	chat = &models.Chat{}
+	err = r.db.Table("v_chats").
+		Where("chat_user_id = ? AND client_msg_id = ?", chatUserId, clientMsgId).
+		First(chat).
+		Error
+	return
+}
+
 func (r *ChatRepositoryImpl) GetChats(
 	chatroomId int,
 	last *int,
@@ -76,97 +154,303 @@ func (r *ChatRepositoryImpl) GetChats(
 	return
 }
 
+// 사용자가 참여 중인 모든 채팅방에서 since보다 뒤에 저장된 메시지를 오래된 순서로 가져온다.
+// 나간 채팅방의 메시지는 가져오지 않는다.
+func (r *ChatRepositoryImpl) GetChatsSince(
+	userId string,
+	since int,
+	size int,
+) (chats []models.Chat, err error) {
+	chats = []models.Chat{}
+	err = r.db.Table("v_chats").
+		Select("v_chats.*", "sender.user_id").
+		Joins("JOIN chat_users AS sender ON sender.id = v_chats.chat_user_id").
+		Joins("JOIN chat_users AS me ON me.chatroom_id = v_chats.chatroom_id").
+		Where("me.user_id = ? AND me.left_at IS NULL AND v_chats.id > ?", userId, since).
+		Order("v_chats.id").
+		Limit(size).
+		Find(&chats).
+		Error
+	return
+}
+
+// 대화 내용을 내보낼 채팅방과 판매자, 구매자, 상품을 조회한 사용자와 상관없이 가져온다.
+func (r *ChatRepositoryImpl) GetTranscriptChatroom(chatroomId int) (chatroom *models.Chatroom, err error) {
+	chatroom = &models.Chatroom{}
+	err = preloadChatroom(r.db.Table("chatrooms").Where("chatrooms.id = ?", chatroomId)).
+		First(chatroom).
+		Error
+	return
+}
+
+// 채팅방의 모든 메시지를 보낸 사용자와 함께 오래된 순서로 가져온다. 취소된 메시지도 내용 그대로 가져온다.
+func (r *ChatRepositoryImpl) GetTranscriptChats(chatroomId int) (chats []models.Chat, err error) {
+	chats = []models.Chat{}
+	err = r.db.Table("v_chats").
+		Select("v_chats.*", "sender.user_id").
+		Joins("JOIN chat_users AS sender ON sender.id = v_chats.chat_user_id").
+		Where("v_chats.chatroom_id = ?", chatroomId).
+		Order("v_chats.id").
+		Find(&chats).
+		Error
+	return
+}
+
+// 나간 채팅방은 가져오지 않는다.
+// 마지막 메시지가 최근인 채팅방부터 가져오며, 메시지가 없는 채팅방은 맨 뒤에 온다.
+// after가 있으면 그 채팅방 다음부터 가져온다. 고정한 채팅방만 가져올 때는 최근에 고정한 순서가 우선이다.
 func (r *ChatRepositoryImpl) GetChatrooms(
 	userId string,
-	last *int,
+	after *ChatroomCursor,
 	size *int,
+	filter ChatroomFilter,
 ) (chatrooms []models.Chatroom, count int, err error) {
-	chatrooms = []models.Chatroom{}
-	query := r.db.Table("chatrooms").
-		Select("chatrooms.*").
-		Joins("inner join chat_users on chat_users.chatroom_id = chatrooms.id").
-		Where("chat_users.user_id = ?", userId)
+	userChatrooms := r.chatroomQuery().
+		Where("chat_users.user_id = ? AND chat_users.left_at IS NULL", userId).
+		Where("chat_users.archived = ?", filter.Archived)
 
-	if last != nil {
-		query = query.Where("chatrooms.id < ?", last)
+	if filter.Pinned != nil {
+		if *filter.Pinned {
+			userChatrooms = userChatrooms.Where("chat_users.pinned_at IS NOT NULL")
+		} else {
+			userChatrooms = userChatrooms.Where("chat_users.pinned_at IS NULL")
+		}
 	}
 
-	query = query.Preload("Product", func(db *gorm.DB) *gorm.DB {
-		return db.Table("v_products").Select("content", "id", "price", "regdate", "title", "thumbnail")
-	}).Preload("LastChat", func(db *gorm.DB) *gorm.DB {
-		return db.Table("v_chats").Select("chatroom_id", "content", "send_date").Order("send_date desc")
-	}).Preload("Seller", func(db *gorm.DB) *gorm.DB {
-		return db.Select("chat_users.user_id", "chat_users.chatroom_id", "users.nickname", "users.profile_image").
-			Joins("JOIN users ON users.id = chat_users.user_id").
-			Where("chat_users.role = ?", models.SELLER)
-	}).Preload("Buyer", func(db *gorm.DB) *gorm.DB {
-		return db.Select("chat_users.user_id", "chat_users.chatroom_id", "users.nickname", "users.profile_image").
-			Joins("JOIN users ON users.id = chat_users.user_id").
-			Where("chat_users.role = ?", models.BUYER)
-	})
+	return r.findChatrooms(userChatrooms, after, size, filter.Pinned != nil && *filter.Pinned)
+}
+
+// 판매자가 나가지 않은 상품의 채팅방을 GetChatrooms와 같은 순서로 가져온다.
+func (r *ChatRepositoryImpl) GetProductChatrooms(
+	productId int,
+	sellerId string,
+	after *ChatroomCursor,
+	size *int,
+) (chatrooms []models.Chatroom, count int, err error) {
+	productChatrooms := r.chatroomQuery().
+		Where("chatrooms.product_id = ? AND chat_users.user_id = ?", productId, sellerId).
+		Where("chat_users.role = ? AND chat_users.left_at IS NULL", models.SELLER)
+
+	return r.findChatrooms(productChatrooms, after, size, false)
+}
+
+func (r *ChatRepositoryImpl) GetProductOwnerId(productId int) (userId string) {
+	return r.productRepo.GetOwnerId(productId)
+}
+
+// chatroomQuery로 만든 chatrooms를 최근 대화 순서로 정렬해 after 다음부터 size개 가져온다.
+// count는 after, size와 상관없이 조건에 맞는 채팅방 수이다.
+func (r *ChatRepositoryImpl) findChatrooms(
+	chatrooms *gorm.DB,
+	after *ChatroomCursor,
+	size *int,
+	pinnedFirst bool,
+) (result []models.Chatroom, count int, err error) {
+	result = []models.Chatroom{}
+	r.db.Table("(?) AS chatrooms", chatrooms).Select("count(*)").Find(&count)
+
+	query := r.db.Table("(?) AS chatrooms", chatrooms)
+
+	if after != nil {
+		query = query.Where(
+			"(chatrooms.last_activity_at < ? OR (chatrooms.last_activity_at = ? AND chatrooms.id < ?))",
+			after.LastActivityAt, after.LastActivityAt, after.ChatroomID,
+		)
+	}
+
+	if pinnedFirst {
+		query = query.Order("chatrooms.pinned_at desc")
+	}
+	query = preloadChatroom(query.Order("chatrooms.last_activity_at desc").Order("chatrooms.id desc"))
 
 	if size != nil {
 		query = query.Limit(*size)
 	}
 
-	r.db.Table("(?) as a", query).Select("count(*)").Find(&count)
-
-	err = query.Find(&chatrooms).Error
+	if err = query.Find(&result).Error; err != nil {
+		return
+	}
 
+	err = r.loadLastChats(result)
 	return
 }
 
-func (r *ChatRepositoryImpl) GetChatroom(chatroomId int) (chatroom *models.Chatroom, err error) {
+func (r *ChatRepositoryImpl) GetChatroom(chatroomId int, userId string) (chatroom *models.Chatroom, err error) {
 	chatroom = &models.Chatroom{}
-	query := r.db.Table("chatrooms").
-		Select("chatrooms.*").
-		Joins("inner join chat_users on chat_users.chatroom_id = chatrooms.id").
-		Where("chatrooms.id = ?", chatroomId)
+	query := r.chatroomQuery().
+		Where("chatrooms.id = ? AND chat_users.user_id = ?", chatroomId, userId)
+
+	if err = preloadChatroom(query).First(chatroom).Error; err != nil {
+		return
+	}
+
+	chatrooms := []models.Chatroom{*chatroom}
+	err = r.loadLastChats(chatrooms)
+	chatroom.LastChat = chatrooms[0].LastChat
+	return
+}
+
+func (r *ChatRepositoryImpl) GetChatroomsByIds(chatroomIds []int, userId string) (chatrooms []models.Chatroom, err error) {
+	chatrooms = []models.Chatroom{}
+	if len(chatroomIds) == 0 {
+		return
+	}
 
-	err = query.Preload("Product", func(db *gorm.DB) *gorm.DB {
+	query := r.chatroomQuery().
+		Where("chatrooms.id IN ? AND chat_users.user_id = ?", chatroomIds, userId)
+
+	if err = preloadChatroom(query).Find(&chatrooms).Error; err != nil {
+		return
+	}
+
+	err = r.loadLastChats(chatrooms)
+	return
+}
+
+// 채팅방과 조회한 사용자의 설정, 마지막 메시지의 ID(last_chat_id)와 마지막 대화 시각(last_activity_at)을 가져오는 쿼리
+// 메시지 ID는 보낸 순서대로 커지므로 가장 큰 ID의 메시지가 마지막 메시지이다.
+// 참여자마다 chats의 chat_user_id 인덱스에서 가장 큰 ID만 찾으므로 대화 내용 전체를 읽지 않는다.
+// 메시지가 없는 채팅방은 만든 시각을 마지막 대화 시각으로 보므로, 새로 만든 채팅방이 목록의 맨 앞에 온다.
+func (r *ChatRepositoryImpl) chatroomQuery() *gorm.DB {
+	lastChatId := r.db.Table("chats").
+		Select("MAX(chats.id)").
+		Joins("JOIN chat_users AS sender ON sender.id = chats.chat_user_id").
+		Where("sender.chatroom_id = chatrooms.id")
+	lastSendDate := r.db.Table("chats").
+		Select("chats.send_date").
+		Joins("JOIN chat_users AS sender ON sender.id = chats.chat_user_id").
+		Where("sender.chatroom_id = chatrooms.id").
+		Order("chats.id desc").
+		Limit(1)
+
+	return r.db.Table("chatrooms").
+		Select(
+			"chatrooms.*, chat_users.archived, chat_users.muted, chat_users.pinned_at, "+
+				"coalesce((?), 0) AS last_chat_id, coalesce((?), chatrooms.created_at) AS last_activity_at",
+			lastChatId, lastSendDate,
+		).
+		Joins("inner join chat_users on chat_users.chatroom_id = chatrooms.id")
+}
+
+func preloadChatroom(query *gorm.DB) *gorm.DB {
+	return query.Preload("Product", func(db *gorm.DB) *gorm.DB {
 		return db.Table("v_products").Select("content", "id", "price", "regdate", "title", "thumbnail")
-	}).Preload("LastChat", func(db *gorm.DB) *gorm.DB {
-		return db.Table("v_chats").Select("chatroom_id", "content", "send_date").Order("send_date desc")
 	}).Preload("Seller", func(db *gorm.DB) *gorm.DB {
-		return db.Select("chat_users.user_id", "chat_users.chatroom_id", "users.nickname", "users.profile_image").
+		return db.Select("chat_users.user_id", "chat_users.chatroom_id", "chat_users.last_read_chat_id", "users.nickname", "users.profile_image", "users.last_seen_at").
 			Joins("JOIN users ON users.id = chat_users.user_id").
 			Where("chat_users.role = ?", models.SELLER)
 	}).Preload("Buyer", func(db *gorm.DB) *gorm.DB {
-		return db.Select("chat_users.user_id", "chat_users.chatroom_id", "users.nickname", "users.profile_image").
+		return db.Select("chat_users.user_id", "chat_users.chatroom_id", "chat_users.last_read_chat_id", "users.nickname", "users.profile_image", "users.last_seen_at").
 			Joins("JOIN users ON users.id = chat_users.user_id").
 			Where("chat_users.role = ?", models.BUYER)
-	}).First(chatroom).Error
+	})
+}
+
+// 채팅방마다 last_chat_id의 메시지 하나씩만 가져와 LastChat을 채운다.
+func (r *ChatRepositoryImpl) loadLastChats(chatrooms []models.Chatroom) (err error) {
+	chatIds := []int{}
+	for _, chatroom := range chatrooms {
+		if chatroom.LastChatID != 0 {
+			chatIds = append(chatIds, chatroom.LastChatID)
+		}
+	}
+	if len(chatIds) == 0 {
+		return
+	}
 
+	lastChats := []models.Chat{}
+	err = r.db.Table("v_chats").
+		Select("id", "chatroom_id", "type", "content", "send_date", "deleted_at").
+		Where("id IN ?", chatIds).
+		Find(&lastChats).
+		Error
+	if err != nil {
+		return
+	}
+
+	byId := make(map[int]*models.Chat, len(lastChats))
+	for i := range lastChats {
+		byId[lastChats[i].ID] = &lastChats[i]
+	}
+	for i := range chatrooms {
+		chatrooms[i].LastChat = byId[chatrooms[i].LastChatID]
+	}
+	return
+}
+
+func (r *ChatRepositoryImpl) GetChatroomIds(userId string) (chatroomIds []int, err error) {
+	chatroomIds = []int{}
+	err = r.db.Table("chat_users").
+		Select("chatroom_id").
+		Where("user_id = ? AND left_at IS NULL", userId).
+		Find(&chatroomIds).
+		Error
+	return
+}
+
+// 채팅방을 나간 사용자는 포함하지 않는다.
+func (r *ChatRepositoryImpl) GetChatroomUserIds(chatroomId int) (userIds []string, err error) {
+	userIds = []string{}
+	err = r.db.Table("chat_users").
+		Select("user_id").
+		Where("chatroom_id = ? AND left_at IS NULL", chatroomId).
+		Find(&userIds).
+		Error
+	return
+}
+
+// userIds 중 채팅방 알림을 끄지 않은 참여자만 돌려준다. 채팅방을 나간 사용자는 포함하지 않는다.
+func (r *ChatRepositoryImpl) GetUnmutedUserIds(chatroomId int, userIds []string) (unmutedUserIds []string, err error) {
+	unmutedUserIds = []string{}
+	if len(userIds) == 0 {
+		return
+	}
+	err = r.db.Table("chat_users").
+		Select("user_id").
+		Where("chatroom_id = ? AND user_id IN ? AND muted = false AND left_at IS NULL", chatroomId, userIds).
+		Find(&unmutedUserIds).
+		Error
 	return
 }
 
-func (r *ChatRepositoryImpl) InsertChatroom(productId int, buyerId string) (chatroom *models.Chatroom, err error) {
+// 구매자가 이미 나간 채팅방이 있으면 새로 만들지 않고 다시 참여시킨다.
+// chat이 있으면 같은 트랜잭션에서 구매자가 보낸 첫 메시지로 저장하므로, 메시지를 저장하지 못하면 채팅방도 만들어지지 않는다.
+// 상품의 판매자가 요청하면 다른 구매자의 채팅방을 쓰지 않도록 gorm.ErrInvalidValue를 돌려준다.
+func (r *ChatRepositoryImpl) InsertChatroom(
+	productId int,
+	buyerId string,
+	chat *models.Chat,
+) (chatroom *models.Chatroom, err error) {
 
 	err = r.db.Transaction(func(tx *gorm.DB) error {
-		err := r.db.
+		var sellerId string
+		err := tx.Model(&models.Product{}).
+			Select("user_id").
+			Where("id = ?", productId).
+			Find(&sellerId).
+			Error
+
+		if err != nil {
+			return err
+		}
+
+		if sellerId == "" {
+			return gorm.ErrRecordNotFound
+		}
+
+		if sellerId == buyerId {
+			return gorm.ErrInvalidValue
+		}
+
+		err = tx.
 			Table("chatrooms").
 			Select("chatrooms.*").
 			Joins("INNER JOIN chat_users ON chat_users.chatroom_id = chatrooms.id").
-			Where("chatrooms.product_id = ? AND chat_users.user_id = ?", productId, buyerId).
+			Where("chatrooms.product_id = ? AND chat_users.user_id = ? AND chat_users.role = ?", productId, buyerId, models.BUYER).
 			First(&chatroom).
 			Error
 
 		if err == gorm.ErrRecordNotFound {
-			var sellerId string
-			err := tx.Model(&models.Product{}).
-				Select("user_id").
-				Where("id = ?", productId).
-				Find(&sellerId).
-				Error
-
-			if err != nil {
-				return err
-			}
-
-			if sellerId == buyerId {
-				return gorm.ErrInvalidValue
-			}
-
 			chatroom = &models.Chatroom{
 				ProductID: productId,
 				Seller: models.ChatUser{
@@ -179,18 +463,89 @@ func (r *ChatRepositoryImpl) InsertChatroom(productId int, buyerId string) (chat
 				},
 			}
 
-			err = tx.Create(chatroom).Error
-			return err
+			if err := tx.Create(chatroom).Error; err != nil {
+				return err
+			}
 		} else if err != nil {
 			return err
 		} else {
+			err := tx.Model(&models.ChatUser{}).
+				Where("chatroom_id = ? AND user_id = ?", chatroom.ID, buyerId).
+				Update("left_at", nil).
+				Error
+			if err != nil {
+				return err
+			}
+		}
+
+		if chat == nil {
 			return nil
 		}
+
+		err = tx.Table("chat_users").
+			Select("id").
+			Where("chatroom_id = ? AND user_id = ?", chatroom.ID, buyerId).
+			Find(&chat.ChatUserID).
+			Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(chat).Error
 	})
 
 	return
 }
 
+// 구매자 buyerId가 상품에 대해 만든 채팅방 ID를 돌려준다. 판매자 본인이면 0이다.
+func (r *ChatRepositoryImpl) GetChatroomId(productId int, buyerId string) (chatroomId int) {
+	r.db.Table("chatrooms").
+		Select("chatrooms.id").
+		Joins("INNER JOIN chat_users ON chat_users.chatroom_id = chatrooms.id").
+		Where("chatrooms.product_id = ? AND chat_users.user_id = ? AND chat_users.role = ?", productId, buyerId, models.BUYER).
+		Find(&chatroomId)
+	return
+}
+
+// 사용자가 참여 중인 채팅방에서 내용에 keyword가 들어간 메시지를 최근 순서로 찾는다.
+// 취소한 메시지와 SYSTEM 메시지는 찾지 않는다. before가 0보다 크면 그보다 앞의 메시지만 찾는다.
+// chats.content의 FULLTEXT 인덱스로 후보를 고르고, ngram으로 나뉜 검색어가 떨어져 있는 메시지는 LIKE로 걸러낸다.
+// 인덱스에는 ngram_token_size(기본값 2)보다 짧은 단어가 없으므로 keyword는 그보다 길어야 한다.
+func (r *ChatRepositoryImpl) SearchChats(
+	userId string,
+	keyword string,
+	before int,
+	size int,
+) (chats []models.Chat, err error) {
+	chats = []models.Chat{}
+	query := r.db.Table("v_chats").
+		Select("v_chats.*", "sender.user_id").
+		Joins("JOIN chats AS matched ON matched.id = v_chats.id").
+		Joins("JOIN chat_users AS sender ON sender.id = v_chats.chat_user_id").
+		Joins("JOIN chat_users AS me ON me.chatroom_id = v_chats.chatroom_id").
+		Where("me.user_id = ? AND me.left_at IS NULL", userId).
+		Where("MATCH (matched.content) AGAINST (? IN BOOLEAN MODE)", fulltextQuery(keyword)).
+		Where("v_chats.deleted_at IS NULL AND v_chats.type <> ?", models.SYSTEM).
+		Where("v_chats.content LIKE ?", "%"+likeEscaper.Replace(keyword)+"%")
+
+	if before > 0 {
+		query = query.Where("v_chats.id < ?", before)
+	}
+
+	err = query.Order("v_chats.id desc").
+		Limit(size).
+		Find(&chats).
+		Error
+	return
+}
+
+// LIKE 패턴에서 검색어의 %, _를 글자 그대로 찾도록 한다.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// 검색어를 BOOLEAN MODE의 구(phrase)로 만들어 +, -, * 같은 글자가 연산자로 해석되지 않게 한다.
+func fulltextQuery(keyword string) string {
+	return `"` + strings.ReplaceAll(keyword, `"`, " ") + `"`
+}
+
 func (r *ChatRepositoryImpl) GetChatUserId(chatroomId int, userId string) (chatUserId int) {
 	r.db.Table("chat_users").
 		Select("id").
@@ -199,11 +554,193 @@ func (r *ChatRepositoryImpl) GetChatUserId(chatroomId int, userId string) (chatU
 	return
 }
 
+func (r *ChatRepositoryImpl) GetLastChatId(chatroomId int) (chatId int, err error) {
+	err = r.db.Table("v_chats").
+		Select("coalesce(max(id), 0)").
+		Where("chatroom_id = ?", chatroomId).
+		Find(&chatId).
+		Error
+	return
+}
+
+func (r *ChatRepositoryImpl) GetLastReadChatId(chatroomId int, userId string) (chatId int, err error) {
+	err = r.db.Table("chat_users").
+		Select("last_read_chat_id").
+		Where("chatroom_id = ? AND user_id = ?", chatroomId, userId).
+		Find(&chatId).
+		Error
+	return
+}
+
+// 채팅방별로 사용자가 마지막으로 읽은 메시지 이후에 상대방이 보낸 메시지 수를 센다.
+// 읽지 않은 메시지가 없는 채팅방은 결과에 포함되지 않는다.
+func (r *ChatRepositoryImpl) GetUnreadCounts(
+	userId string,
+	chatroomIds []int,
+) (unreadCounts map[int]int, err error) {
+	unreadCounts = map[int]int{}
+	if len(chatroomIds) == 0 {
+		return
+	}
+
+	rows := []struct {
+		ChatroomID int
+		Count      int
+	}{}
+	err = r.db.Table("chat_users AS me").
+		Select("me.chatroom_id, count(chats.id) AS count").
+		Joins("JOIN chat_users AS other ON other.chatroom_id = me.chatroom_id AND other.id <> me.id").
+		Joins("JOIN chats ON chats.chat_user_id = other.id AND chats.id > me.last_read_chat_id").
+		Where("me.user_id = ? AND me.chatroom_id IN ?", userId, chatroomIds).
+		Group("me.chatroom_id").
+		Find(&rows).
+		Error
+
+	for _, row := range rows {
+		unreadCounts[row.ChatroomID] = row.Count
+	}
+	return
+}
+
+// 읽은 위치는 앞으로만 옮긴다.
+func (r *ChatRepositoryImpl) UpdateLastReadChatId(chatroomId int, userId string, chatId int) (err error) {
+	err = r.db.Model(&models.ChatUser{}).
+		Where("chatroom_id = ? AND user_id = ? AND last_read_chat_id < ?", chatroomId, userId, chatId).
+		Update("last_read_chat_id", chatId).
+		Error
+	return
+}
+
+func (r *ChatRepositoryImpl) UpdateLastSeen(userId string, lastSeenAt time.Time) (err error) {
+	err = r.db.Table("users").
+		Where("id = ?", userId).
+		Update("last_seen_at", lastSeenAt).
+		Error
+	return
+}
+
 func (r *ChatRepositoryImpl) InsertChat(chat *models.Chat) (err error) {
 	err = r.db.Create(chat).Error
 	return
 }
 
+// 메시지를 의심스럽다고 판단한 이유를 저장한다.
+func (r *ChatRepositoryImpl) InsertChatFlags(chatId int, reasons []models.FlagReason) (err error) {
+	flags := make([]models.ChatFlag, len(reasons))
+	for i, reason := range reasons {
+		flags[i] = models.ChatFlag{ChatID: chatId, Reason: reason}
+	}
+	err = r.db.Create(&flags).Error
+	return
+}
+
+// 구매자가 since 이후에 content와 똑같은 메시지를 보낸 판매자가 몇 명인지 센다.
+func (r *ChatRepositoryImpl) CountSellersWithContent(
+	buyerId string,
+	content string,
+	since time.Time,
+) (count int, err error) {
+	err = r.db.Table("v_chats").
+		Select("COUNT(DISTINCT seller.user_id)").
+		Joins("JOIN chat_users AS sender ON sender.id = v_chats.chat_user_id").
+		Joins("JOIN chat_users AS seller ON seller.chatroom_id = v_chats.chatroom_id AND seller.role = ?", models.SELLER).
+		Where("sender.user_id = ? AND sender.role = ?", buyerId, models.BUYER).
+		Where("v_chats.content = ? AND v_chats.send_date >= ?", content, since).
+		Find(&count).
+		Error
+	return
+}
+
+// 상대방에게 보낼 chat을 저장하고 사용자를 채팅방에서 내보낸다. 채팅방 설정은 초기화한다.
+func (r *ChatRepositoryImpl) LeaveChatroom(
+	chatroomId int,
+	userId string,
+	chat *models.Chat,
+	leftAt time.Time,
+) (err error) {
+	err = r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(chat).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&models.ChatUser{}).
+			Where("chatroom_id = ? AND user_id = ? AND left_at IS NULL", chatroomId, userId).
+			Updates(map[string]interface{}{
+				"left_at":   leftAt,
+				"archived":  false,
+				"muted":     false,
+				"pinned_at": nil,
+			}).
+			Error
+	})
+	return
+}
+
+// 고정하면 고정한 시간을 기록해 최근에 고정한 채팅방이 먼저 보이게 한다.
+func (r *ChatRepositoryImpl) UpdateChatroomSettings(
+	chatroomId int,
+	userId string,
+	settings models.ChatroomSettings,
+	updatedAt time.Time,
+) (err error) {
+	values := map[string]interface{}{}
+	if settings.Archived != nil {
+		values["archived"] = *settings.Archived
+	}
+	if settings.Muted != nil {
+		values["muted"] = *settings.Muted
+	}
+	if settings.Pinned != nil {
+		if *settings.Pinned {
+			values["pinned_at"] = updatedAt
+		} else {
+			values["pinned_at"] = nil
+		}
+	}
+	if len(values) == 0 {
+		return
+	}
+
+	err = r.db.Model(&models.ChatUser{}).
+		Where("chatroom_id = ? AND user_id = ? AND left_at IS NULL", chatroomId, userId).
+		Updates(values).
+		Error
+	return
+}
+
+// 수정하기 전의 내용은 chat_edits에 남긴다.
+func (r *ChatRepositoryImpl) UpdateChatContent(chatId int, content string, editedAt time.Time) (err error) {
+	err = r.db.Transaction(func(tx *gorm.DB) error {
+		chat := &models.Chat{}
+		if err := tx.Table("chats").Where("id = ?", chatId).First(chat).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Create(&models.ChatEdit{
+			ChatID:   chatId,
+			Content:  chat.Content,
+			EditedAt: editedAt,
+		}).Error; err != nil {
+			return err
+		}
+
+		return tx.Table("chats").Where("id = ?", chatId).Updates(map[string]interface{}{
+			"content":   content,
+			"edited_at": editedAt,
+		}).Error
+	})
+	return
+}
+
+// 내용은 남겨두고 취소한 시간만 기록한다.
+func (r *ChatRepositoryImpl) UnsendChat(chatId int, deletedAt time.Time) (err error) {
+	err = r.db.Table("chats").
+		Where("id = ? AND deleted_at IS NULL", chatId).
+		Update("deleted_at", deletedAt).
+		Error
+	return
+}
+
 func (r *ChatRepositoryImpl) DeleteChatroom(chatroomId int) (err error) {
 	err = r.db.Delete(&models.Chatroom{}, "id = ?", chatroomId).Error
 	return
@@ -224,7 +761,18 @@ func (r *ChatRepositoryImpl) CheckCorrectUser(
 	chatroomId int,
 ) (isCorrect bool) {
 	r.db.Model(&models.ChatUser{}).Select("count(*) > 0").
-		Where("user_id = ? AND chatroom_id = ?", userId, chatroomId).
+		Where("user_id = ? AND chatroom_id = ? AND left_at IS NULL", userId, chatroomId).
 		Find(&isCorrect)
 	return
 }
+
+// userId의 상대방이 채팅방을 나갔으면 true를 돌려준다.
+func (r *ChatRepositoryImpl) CheckCounterpartLeft(
+	userId string,
+	chatroomId int,
+) (left bool) {
+	r.db.Model(&models.ChatUser{}).Select("count(*) > 0").
+		Where("user_id <> ? AND chatroom_id = ? AND left_at IS NOT NULL", userId, chatroomId).
+		Find(&left)
+	return
+}
@@ -6,8 +6,10 @@ import (
 	"carrot-market-clone-api/repositories"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
 )
 
 func TestChatRepository(t *testing.T) {
@@ -26,10 +28,11 @@ func TestChatRepository(t *testing.T) {
 	r := repositories.NewChatRepositoryImpl(db, productRepo)
 
 	// insert test product
+	price := 30000
 	product := &models.Product{
 		Title:      "test title",
 		Content:    "test content",
-		Price:      30000,
+		Price:      &price,
 		CategoryID: 1,
 		UserID:     "517ff837-98ef-4851-b87a-c8199a8d465c",
 		Images: []models.ProductImage{
@@ -41,7 +44,7 @@ func TestChatRepository(t *testing.T) {
 
 	// insert chatroom
 	buyerId := "7e2cfeea-1e1f-4fd0-9542-0f802e1dd954"
-	chatroom, err := r.InsertChatroom(product.ID, buyerId)
+	chatroom, err := r.InsertChatroom(product.ID, buyerId, nil)
 	if err != nil {
 		assert.Error(t, err)
 	}
@@ -70,6 +73,46 @@ func TestChatRepository(t *testing.T) {
 	assert.Equal(t, "test content 1", testChat.Content)
 	assert.Equal(t, chatroom.Seller.ID, testChat.ChatUserID)
 	assert.Equal(t, models.SELLER, testChat.Role)
+	assert.Equal(t, models.TEXT, testChat.Type)
+
+	// insert location chat
+	clientMsgId := "test client message"
+	locationChat := &models.Chat{
+		ClientMsgID: &clientMsgId,
+		ChatUserID:  chatroom.Buyer.ID,
+		Type:        models.LOCATION,
+		Content:     "test location",
+		Payload:     []byte(`{"latitude":37.5,"longitude":127}`),
+	}
+	if err := r.InsertChat(locationChat); err != nil {
+		assert.Error(t, err)
+	}
+
+	testChat, err = r.GetChat(locationChat.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.LOCATION, testChat.Type)
+	assert.JSONEq(t, `{"latitude":37.5,"longitude":127}`, string(testChat.Payload))
+
+	testChat, err = r.GetChatByClientMsgId(chatroom.Buyer.ID, clientMsgId)
+	assert.NoError(t, err)
+	assert.Equal(t, locationChat.ID, testChat.ID)
+
+	// edit and unsend chat
+	assert.NoError(t, r.UpdateChatContent(chats[0].ID, "edited content", time.Now()))
+	testChat, err = r.GetChat(chats[0].ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "edited content", testChat.Content)
+	assert.NotNil(t, testChat.EditedAt)
+
+	assert.NoError(t, r.UnsendChat(locationChat.ID, time.Now()))
+	testChat, err = r.GetChat(locationChat.ID)
+	assert.NoError(t, err)
+	assert.NotNil(t, testChat.DeletedAt)
+	assert.Equal(t, "test location", testChat.Content)
+
+	if err := r.DeleteChat(locationChat.ID); err != nil {
+		assert.Error(t, err)
+	}
 
 	// get chats
 	testChats, count, err := r.GetChats(chatroom.ID, nil, 3)
@@ -77,11 +120,219 @@ func TestChatRepository(t *testing.T) {
 	assert.Equal(t, 3, len(testChats))
 
 	// get chatrooms
-	testChatrooms, count, err := r.GetChatrooms(chatroom.Seller.UserID, nil, 5)
+	size := 5
+	testChatrooms, count, err := r.GetChatrooms(chatroom.Seller.UserID, nil, &size, repositories.ChatroomFilter{})
 	assert.Equal(t, 1, count)
 	assert.Equal(t, 1, len(testChatrooms))
 	assert.Equal(t, "test content 10", testChatrooms[0].LastChat.Content)
 	assert.Equal(t, buyerId, testChatrooms[0].Buyer.UserID)
+	assert.Equal(t, chats[9].ID, testChatrooms[0].LastChatID)
+
+	after := &repositories.ChatroomCursor{LastActivityAt: testChatrooms[0].LastActivityAt, ChatroomID: chatroom.ID}
+	testChatrooms, count, err = r.GetChatrooms(chatroom.Seller.UserID, after, &size, repositories.ChatroomFilter{})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+	assert.Equal(t, 0, len(testChatrooms))
+
+	// 메시지가 없는 새 채팅방은 만든 시각으로 정렬되어 맨 앞에 온다.
+	newProduct := &models.Product{
+		Title:      "test new title",
+		Content:    "test content",
+		Price:      &price,
+		CategoryID: 1,
+		UserID:     product.UserID,
+	}
+	productRepo.InsertProduct(newProduct)
+	newChatroom, err := r.InsertChatroom(newProduct.ID, buyerId, nil)
+	assert.NoError(t, err)
+
+	one := 1
+	testChatrooms, count, err = r.GetChatrooms(chatroom.Seller.UserID, nil, &one, repositories.ChatroomFilter{})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+	assert.Equal(t, 1, len(testChatrooms))
+	assert.Equal(t, newChatroom.ID, testChatrooms[0].ID)
+	assert.Nil(t, testChatrooms[0].LastChat)
+
+	assert.NoError(t, r.DeleteChatroom(newChatroom.ID))
+	assert.NoError(t, productRepo.DeleteProduct(newProduct.ID))
+
+	// get product chatrooms
+	assert.Equal(t, product.UserID, r.GetProductOwnerId(product.ID))
+
+	testChatrooms, count, err = r.GetProductChatrooms(product.ID, product.UserID, nil, &size)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+	assert.Equal(t, buyerId, testChatrooms[0].Buyer.UserID)
+	assert.Equal(t, chats[9].ID, testChatrooms[0].LastChat.ID)
+
+	testChatrooms, count, err = r.GetProductChatrooms(product.ID, buyerId, nil, &size)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count)
+
+	// search chats
+	testChats, err = r.SearchChats(buyerId, "CONTENT", 0, 20)
+	assert.NoError(t, err)
+	assert.Equal(t, 10, len(testChats))
+	assert.Equal(t, chats[9].ID, testChats[0].ID)
+	assert.Equal(t, chatroom.Seller.UserID, testChats[0].UserID)
+
+	testChats, err = r.SearchChats(buyerId, "content", chats[5].ID, 20)
+	assert.NoError(t, err)
+	assert.Equal(t, 5, len(testChats))
+
+	testChats, err = r.SearchChats(buyerId, "content 1", 0, 20)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(testChats))
+	assert.Equal(t, "test content 10", testChats[0].Content)
+
+	testChats, err = r.SearchChats(buyerId, "%", 0, 20)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(testChats))
+
+	testChatrooms, err = r.GetChatroomsByIds([]int{chatroom.ID}, buyerId)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(testChatrooms))
+	assert.Equal(t, chats[9].ID, testChatrooms[0].LastChat.ID)
+
+	// get chats since
+	testChats, err = r.GetChatsSince(buyerId, chats[6].ID, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(testChats))
+	assert.Equal(t, chats[7].ID, testChats[0].ID)
+	assert.Equal(t, chats[8].ID, testChats[1].ID)
+	assert.Equal(t, chatroom.Seller.UserID, testChats[0].UserID)
+
+	// unread counts
+	unreadCounts, err := r.GetUnreadCounts(buyerId, []int{chatroom.ID})
+	assert.NoError(t, err)
+	assert.Equal(t, 10, unreadCounts[chatroom.ID])
+
+	unreadCounts, err = r.GetUnreadCounts(chatroom.Seller.UserID, []int{chatroom.ID})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, unreadCounts[chatroom.ID])
+
+	// read chats
+	assert.NoError(t, r.UpdateLastReadChatId(chatroom.ID, buyerId, chats[4].ID))
+	assert.NoError(t, r.UpdateLastReadChatId(chatroom.ID, buyerId, chats[2].ID))
+	lastReadChatId, err := r.GetLastReadChatId(chatroom.ID, buyerId)
+	assert.NoError(t, err)
+	assert.Equal(t, chats[4].ID, lastReadChatId)
+
+	unreadCounts, err = r.GetUnreadCounts(buyerId, []int{chatroom.ID})
+	assert.NoError(t, err)
+	assert.Equal(t, 5, unreadCounts[chatroom.ID])
+
+	lastChatId, err := r.GetLastChatId(chatroom.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, chats[9].ID, lastChatId)
+
+	// chatroom settings
+	pinned, archived := true, true
+	assert.NoError(t, r.UpdateChatroomSettings(chatroom.ID, buyerId, models.ChatroomSettings{Pinned: &pinned}, time.Now()))
+	testChatrooms, _, err = r.GetChatrooms(buyerId, nil, &size, repositories.ChatroomFilter{Pinned: &pinned})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(testChatrooms))
+	assert.NotNil(t, testChatrooms[0].PinnedAt)
+
+	assert.NoError(t, r.UpdateChatroomSettings(chatroom.ID, buyerId, models.ChatroomSettings{Archived: &archived}, time.Now()))
+	testChatrooms, _, err = r.GetChatrooms(buyerId, nil, &size, repositories.ChatroomFilter{})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(testChatrooms))
+
+	testChatroom, err := r.GetChatroom(chatroom.ID, buyerId)
+	assert.NoError(t, err)
+	assert.True(t, testChatroom.Archived)
+	assert.False(t, testChatroom.Muted)
+
+	participantIds := []string{chatroom.Seller.UserID, buyerId}
+	userIds, err := r.GetUnmutedUserIds(chatroom.ID, participantIds)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, participantIds, userIds)
+
+	muted := true
+	assert.NoError(t, r.UpdateChatroomSettings(chatroom.ID, buyerId, models.ChatroomSettings{Muted: &muted}, time.Now()))
+	userIds, err = r.GetUnmutedUserIds(chatroom.ID, participantIds)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{chatroom.Seller.UserID}, userIds)
+
+	// leave chatroom
+	leaveChat := &models.Chat{
+		ChatUserID: chatroom.Buyer.ID,
+		Type:       models.SYSTEM,
+		Content:    models.LeaveChatContent,
+		Payload:    []byte(`{"event":"LEAVE"}`),
+	}
+	assert.NoError(t, r.LeaveChatroom(chatroom.ID, buyerId, leaveChat, time.Now()))
+	assert.False(t, r.CheckCorrectUser(buyerId, chatroom.ID))
+	assert.True(t, r.CheckCounterpartLeft(chatroom.Seller.UserID, chatroom.ID))
+	assert.False(t, r.CheckCounterpartLeft(buyerId, chatroom.ID))
+
+	chatroomIds, err := r.GetChatroomIds(buyerId)
+	assert.NoError(t, err)
+	assert.NotContains(t, chatroomIds, chatroom.ID)
+
+	userIds, err = r.GetChatroomUserIds(chatroom.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{chatroom.Seller.UserID}, userIds)
+
+	// 나간 채팅방의 새 메시지는 동기화하지 않는다.
+	afterLeave := &models.Chat{ChatUserID: chatroom.Seller.ID, Content: "test after leave"}
+	assert.NoError(t, r.InsertChat(afterLeave))
+	testChats, err = r.GetChatsSince(buyerId, chats[9].ID, 20)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(testChats))
+
+	testChats, err = r.GetChatsSince(chatroom.Seller.UserID, leaveChat.ID, 20)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(testChats))
+	assert.Equal(t, afterLeave.ID, testChats[0].ID)
+
+	// 나간 채팅방에 첫 메시지와 함께 다시 참여
+	rejoinChat := &models.Chat{Content: "test rejoin"}
+	testChatroom, err = r.InsertChatroom(product.ID, buyerId, rejoinChat)
+	assert.NoError(t, err)
+	assert.Equal(t, chatroom.ID, testChatroom.ID)
+	assert.Equal(t, chatroom.Buyer.ID, rejoinChat.ChatUserID)
+	assert.True(t, r.CheckCorrectUser(buyerId, chatroom.ID))
+	assert.False(t, r.CheckCounterpartLeft(chatroom.Seller.UserID, chatroom.ID))
+	assert.Equal(t, chatroom.ID, r.GetChatroomId(product.ID, buyerId))
+
+	// flag chats
+	sellers, err := r.CountSellersWithContent(buyerId, "test rejoin", time.Now().Add(-time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, sellers)
+
+	sellers, err = r.CountSellersWithContent(chatroom.Seller.UserID, "test content 10", time.Now().Add(-time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, sellers)
+
+	assert.NoError(t, r.InsertChatFlags(rejoinChat.ID, []models.FlagReason{models.FlagRepeatedMessage}))
+
+	// transcript
+	testChatroom, err = r.GetTranscriptChatroom(chatroom.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "test title", testChatroom.Product.Title)
+	assert.Equal(t, buyerId, testChatroom.Buyer.UserID)
+	assert.Equal(t, chatroom.Seller.UserID, testChatroom.Seller.UserID)
+
+	testChats, err = r.GetTranscriptChats(chatroom.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, 13, len(testChats))
+	assert.Equal(t, chats[0].ID, testChats[0].ID)
+	assert.Equal(t, chatroom.Seller.UserID, testChats[0].UserID)
+	assert.Equal(t, rejoinChat.ID, testChats[12].ID)
+
+	_, err = r.GetTranscriptChatroom(-1)
+	assert.Equal(t, gorm.ErrRecordNotFound, err)
+
+	_, err = r.InsertChatroom(-1, buyerId, &models.Chat{Content: "test content"})
+	assert.Equal(t, gorm.ErrRecordNotFound, err)
+
+	// 판매자는 구매자의 채팅방에 첫 메시지를 보낼 수 없다.
+	assert.Equal(t, 0, r.GetChatroomId(product.ID, chatroom.Seller.UserID))
+	_, err = r.InsertChatroom(product.ID, chatroom.Seller.UserID, &models.Chat{Content: "test seller"})
+	assert.Equal(t, gorm.ErrInvalidValue, err)
 
 	// delete chatroom
 	if err := r.DeleteChatroom(chatroom.ID); err != nil {
@@ -0,0 +1,86 @@
+package repositories
+
+import (
+	"carrot-market-clone-api/models"
+
+	"gorm.io/gorm"
+)
+
+type DeviceRepository interface {
+	GetDevices(userIds []string) (devices []models.Device, err error)
+
+	InsertDevice(device *models.Device) (err error)
+
+	DeleteDevice(deviceId int, userId string) (err error)
+
+	DeleteDeviceByToken(token string) (err error)
+
+	DeleteSessionDevices(sessionId string) (err error)
+
+	DeleteUserDevices(userId string) (err error)
+}
+
+type DeviceRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func NewDeviceRepositoryImpl(db *gorm.DB) DeviceRepository {
+	return &DeviceRepositoryImpl{db: db}
+}
+
+func (r *DeviceRepositoryImpl) GetDevices(userIds []string) (devices []models.Device, err error) {
+	devices = []models.Device{}
+	if len(userIds) == 0 {
+		return
+	}
+	err = r.db.Where("user_id IN ?", userIds).Order("id").Find(&devices).Error
+	return
+}
+
+// 같은 토큰이나 같은 로그인으로 등록된 기기는 다른 사용자의 것이라도 지우고 새로 등록한다.
+// 한 기기에서 다른 계정으로 로그인하거나 푸시 토큰이 바뀌면 마지막으로 등록한 기기만 알림을 받는다.
+func (r *DeviceRepositoryImpl) InsertDevice(device *models.Device) (err error) {
+	err = r.db.Transaction(func(tx *gorm.DB) error {
+		query := tx.Where("token = ?", device.Token)
+		if device.SessionID != "" {
+			query = query.Or("session_id = ?", device.SessionID)
+		}
+		if err := query.Delete(&models.Device{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Create(device).Error; err != nil {
+			return err
+		}
+		return tx.First(device, device.ID).Error
+	})
+	return
+}
+
+// 사용자의 기기가 아니면 gorm.ErrRecordNotFound를 돌려준다.
+func (r *DeviceRepositoryImpl) DeleteDevice(deviceId int, userId string) (err error) {
+	result := r.db.Where("id = ? AND user_id = ?", deviceId, userId).Delete(&models.Device{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return
+}
+
+// 푸시 서비스가 더 이상 유효하지 않다고 알려준 토큰을 지운다.
+func (r *DeviceRepositoryImpl) DeleteDeviceByToken(token string) (err error) {
+	err = r.db.Where("token = ?", token).Delete(&models.Device{}).Error
+	return
+}
+
+func (r *DeviceRepositoryImpl) DeleteSessionDevices(sessionId string) (err error) {
+	err = r.db.Where("session_id = ?", sessionId).Delete(&models.Device{}).Error
+	return
+}
+
+func (r *DeviceRepositoryImpl) DeleteUserDevices(userId string) (err error) {
+	err = r.db.Where("user_id = ?", userId).Delete(&models.Device{}).Error
+	return
+}
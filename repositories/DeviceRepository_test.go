@@ -0,0 +1,77 @@
+package repositories_test
+
+import (
+	"carrot-market-clone-api/config"
+	"carrot-market-clone-api/models"
+	"carrot-market-clone-api/repositories"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestDeviceRepository(t *testing.T) {
+	conf, err := config.LoadTestConfig()
+	if err != nil {
+		assert.Error(t, err)
+	}
+
+	db, err := conf.InitDBConnection()
+	if err != nil {
+		assert.Error(t, err)
+	}
+
+	r := repositories.NewDeviceRepositoryImpl(db)
+
+	sellerId := "517ff837-98ef-4851-b87a-c8199a8d465c"
+	buyerId := "7e2cfeea-1e1f-4fd0-9542-0f802e1dd954"
+
+	// insert
+	device := &models.Device{UserID: sellerId, Token: "test token", DeviceType: models.IOS, SessionID: "test session"}
+	assert.NoError(t, r.InsertDevice(device))
+	assert.NotZero(t, device.ID)
+	assert.False(t, device.CreatedAt.IsZero())
+
+	devices, err := r.GetDevices([]string{sellerId})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(devices))
+	assert.Equal(t, "test token", devices[0].Token)
+
+	// 같은 토큰을 다른 사용자가 등록하면 마지막 사용자의 기기만 남는다.
+	device = &models.Device{UserID: buyerId, Token: "test token", DeviceType: models.IOS, SessionID: "other session"}
+	assert.NoError(t, r.InsertDevice(device))
+
+	devices, err = r.GetDevices([]string{sellerId, buyerId})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(devices))
+	assert.Equal(t, buyerId, devices[0].UserID)
+
+	// 같은 로그인에서 토큰이 바뀌면 이전 토큰을 지운다.
+	device = &models.Device{UserID: buyerId, Token: "new token", DeviceType: models.IOS, SessionID: "other session"}
+	assert.NoError(t, r.InsertDevice(device))
+
+	devices, err = r.GetDevices([]string{buyerId})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(devices))
+	assert.Equal(t, "new token", devices[0].Token)
+
+	// delete
+	assert.Equal(t, gorm.ErrRecordNotFound, r.DeleteDevice(device.ID, sellerId))
+	assert.NoError(t, r.DeleteDevice(device.ID, buyerId))
+
+	assert.NoError(t, r.InsertDevice(&models.Device{UserID: buyerId, Token: "session token", DeviceType: models.ANDROID, SessionID: "session"}))
+	assert.NoError(t, r.InsertDevice(&models.Device{UserID: buyerId, Token: "expired token", DeviceType: models.ANDROID}))
+	assert.NoError(t, r.InsertDevice(&models.Device{UserID: buyerId, Token: "other token", DeviceType: models.ANDROID}))
+
+	assert.NoError(t, r.DeleteSessionDevices("session"))
+	assert.NoError(t, r.DeleteDeviceByToken("expired token"))
+	devices, err = r.GetDevices([]string{buyerId})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(devices))
+	assert.Equal(t, "other token", devices[0].Token)
+
+	assert.NoError(t, r.DeleteUserDevices(buyerId))
+	devices, err = r.GetDevices([]string{buyerId})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(devices))
+}
@@ -0,0 +1,57 @@
+package repositories
+
+import (
+	"sync"
+	"time"
+)
+
+// 단일 인스턴스로 실행할 때 사용하는 메모리 저장소.
+// 서버가 재시작되면 폐기 목록도 사라진다.
+type MemoryRevocationStore struct {
+	mutex  sync.RWMutex
+	tokens map[string]time.Time
+	users  map[string]time.Time
+}
+
+func NewMemoryRevocationStore() RevocationStore {
+	return &MemoryRevocationStore{
+		tokens: make(map[string]time.Time),
+		users:  make(map[string]time.Time),
+	}
+}
+
+func (r *MemoryRevocationStore) RevokeToken(tokenId string, expiresAt time.Time) (err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	now := time.Now()
+	for id, exp := range r.tokens {
+		if exp.Before(now) {
+			delete(r.tokens, id)
+		}
+	}
+
+	r.tokens[tokenId] = expiresAt
+	return
+}
+
+func (r *MemoryRevocationStore) RevokeUser(userId string, revokedAt time.Time) (err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.users[userId] = revokedAt
+	return
+}
+
+func (r *MemoryRevocationStore) IsRevoked(tokenId, userId string, issuedAt time.Time) (revoked bool, err error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	if _, ok := r.tokens[tokenId]; ok {
+		return true, nil
+	}
+	if revokedAt, ok := r.users[userId]; ok && !revokedAt.Before(issuedAt) {
+		return true, nil
+	}
+	return false, nil
+}
@@ -0,0 +1,37 @@
+package repositories_test
+
+import (
+	"testing"
+	"time"
+
+	"carrot-market-clone-api/repositories"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryRevocationStore(t *testing.T) {
+	r := repositories.NewMemoryRevocationStore()
+	now := time.Now().Truncate(time.Second)
+
+	isRevoked := func(tokenId, userId string, issuedAt time.Time) bool {
+		revoked, err := r.IsRevoked(tokenId, userId, issuedAt)
+		assert.NoError(t, err)
+		return revoked
+	}
+
+	// revoke token
+	assert.False(t, isRevoked("token 1", "user 1", now))
+	assert.NoError(t, r.RevokeToken("token 1", now.Add(time.Hour)))
+	assert.True(t, isRevoked("token 1", "user 1", now))
+	assert.False(t, isRevoked("token 2", "user 1", now))
+
+	// revoke user
+	assert.NoError(t, r.RevokeUser("user 2", now))
+	assert.True(t, isRevoked("token 3", "user 2", now.Add(-time.Minute)))
+	assert.True(t, isRevoked("token 3", "user 2", now))
+	assert.False(t, isRevoked("token 4", "user 2", now.Add(time.Second)))
+	assert.False(t, isRevoked("token 3", "user 3", now))
+
+	// 폐기한 뒤 같은 초에 발급된 토큰은 유효하다.
+	assert.False(t, isRevoked("token 5", "user 2", now.Add(time.Millisecond)))
+}
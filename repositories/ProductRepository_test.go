@@ -27,10 +27,11 @@ func TestProductRepository(t *testing.T) {
 
 	products := make([]models.Product, 5)
 	for i := 0; i < len(products); i++ {
+		price := (i + 1) * 10000
 		products[i] = models.Product{
 			Title:      fmt.Sprintf("test title %d", i+1),
 			Content:    fmt.Sprintf("test content %d", i+1),
-			Price:      (i + 1) * 10000,
+			Price:      &price,
 			CategoryID: (i + 1),
 			UserID:     "user",
 			Images: []models.ProductImage{
@@ -0,0 +1,91 @@
+package repositories
+
+import (
+	"carrot-market-clone-api/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type ReplyRepository interface {
+	GetReplyTemplates(userId string) (templates []models.ReplyTemplate, err error)
+
+	GetReplyTemplate(templateId int, userId string) (template *models.ReplyTemplate, err error)
+
+	CountReplyTemplates(userId string) (count int64, err error)
+
+	InsertReplyTemplate(template *models.ReplyTemplate) (err error)
+
+	UpdateReplyTemplate(template *models.ReplyTemplate) (err error)
+
+	DeleteReplyTemplate(templateId int, userId string) (err error)
+
+	GetAwayMode(userId string) (awayMode *models.AwayMode, err error)
+
+	UpsertAwayMode(awayMode *models.AwayMode) (err error)
+}
+
+type ReplyRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func NewReplyRepositoryImpl(db *gorm.DB) ReplyRepository {
+	return &ReplyRepositoryImpl{db: db}
+}
+
+func (r *ReplyRepositoryImpl) GetReplyTemplates(userId string) (templates []models.ReplyTemplate, err error) {
+	templates = []models.ReplyTemplate{}
+	err = r.db.Where("user_id = ?", userId).Order("id").Find(&templates).Error
+	return
+}
+
+// 다른 사용자의 템플릿이면 gorm.ErrRecordNotFound를 돌려준다.
+func (r *ReplyRepositoryImpl) GetReplyTemplate(templateId int, userId string) (template *models.ReplyTemplate, err error) {
+	template = &models.ReplyTemplate{}
+	err = r.db.Where("id = ? AND user_id = ?", templateId, userId).First(template).Error
+	return
+}
+
+func (r *ReplyRepositoryImpl) CountReplyTemplates(userId string) (count int64, err error) {
+	err = r.db.Model(&models.ReplyTemplate{}).Where("user_id = ?", userId).Count(&count).Error
+	return
+}
+
+func (r *ReplyRepositoryImpl) InsertReplyTemplate(template *models.ReplyTemplate) (err error) {
+	err = r.db.Create(template).Error
+	return
+}
+
+func (r *ReplyRepositoryImpl) UpdateReplyTemplate(template *models.ReplyTemplate) (err error) {
+	err = r.db.Model(&models.ReplyTemplate{}).
+		Where("id = ? AND user_id = ?", template.ID, template.UserID).
+		Update("content", template.Content).
+		Error
+	return
+}
+
+func (r *ReplyRepositoryImpl) DeleteReplyTemplate(templateId int, userId string) (err error) {
+	result := r.db.Where("id = ? AND user_id = ?", templateId, userId).Delete(&models.ReplyTemplate{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return
+}
+
+// 설정한 적이 없으면 꺼진 상태로 돌려준다.
+func (r *ReplyRepositoryImpl) GetAwayMode(userId string) (awayMode *models.AwayMode, err error) {
+	awayMode = &models.AwayMode{}
+	err = r.db.Where("user_id = ?", userId).First(awayMode).Error
+	if err == gorm.ErrRecordNotFound {
+		return &models.AwayMode{UserID: userId}, nil
+	}
+	return
+}
+
+func (r *ReplyRepositoryImpl) UpsertAwayMode(awayMode *models.AwayMode) (err error) {
+	err = r.db.Clauses(clause.OnConflict{UpdateAll: true}).Create(awayMode).Error
+	return
+}
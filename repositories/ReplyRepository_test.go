@@ -0,0 +1,72 @@
+package repositories_test
+
+import (
+	"carrot-market-clone-api/config"
+	"carrot-market-clone-api/models"
+	"carrot-market-clone-api/repositories"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestReplyRepository(t *testing.T) {
+	conf, err := config.LoadTestConfig()
+	if err != nil {
+		assert.Error(t, err)
+	}
+
+	db, err := conf.InitDBConnection()
+	if err != nil {
+		assert.Error(t, err)
+	}
+
+	r := repositories.NewReplyRepositoryImpl(db)
+
+	sellerId := "517ff837-98ef-4851-b87a-c8199a8d465c"
+	buyerId := "7e2cfeea-1e1f-4fd0-9542-0f802e1dd954"
+
+	// insert reply templates
+	template := &models.ReplyTemplate{UserID: sellerId, Content: "test reply"}
+	assert.NoError(t, r.InsertReplyTemplate(template))
+	assert.NotZero(t, template.ID)
+
+	count, err := r.CountReplyTemplates(sellerId)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+
+	templates, err := r.GetReplyTemplates(sellerId)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(templates))
+	assert.Equal(t, "test reply", templates[0].Content)
+
+	// 다른 사용자의 템플릿은 조회하거나 지울 수 없다.
+	_, err = r.GetReplyTemplate(template.ID, buyerId)
+	assert.Equal(t, gorm.ErrRecordNotFound, err)
+	assert.Equal(t, gorm.ErrRecordNotFound, r.DeleteReplyTemplate(template.ID, buyerId))
+
+	// update
+	template.Content = "edited reply"
+	assert.NoError(t, r.UpdateReplyTemplate(template))
+	testTemplate, err := r.GetReplyTemplate(template.ID, sellerId)
+	assert.NoError(t, err)
+	assert.Equal(t, "edited reply", testTemplate.Content)
+
+	// delete
+	assert.NoError(t, r.DeleteReplyTemplate(template.ID, sellerId))
+	templates, err = r.GetReplyTemplates(sellerId)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(templates))
+
+	// away mode
+	awayMode, err := r.GetAwayMode(buyerId)
+	assert.NoError(t, err)
+	assert.False(t, awayMode.Enabled)
+
+	assert.NoError(t, r.UpsertAwayMode(&models.AwayMode{UserID: sellerId, Enabled: true, Message: "test away"}))
+	assert.NoError(t, r.UpsertAwayMode(&models.AwayMode{UserID: sellerId, Enabled: false, Message: "test away"}))
+	awayMode, err = r.GetAwayMode(sellerId)
+	assert.NoError(t, err)
+	assert.False(t, awayMode.Enabled)
+	assert.Equal(t, "test away", awayMode.Message)
+}
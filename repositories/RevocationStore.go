@@ -0,0 +1,60 @@
+package repositories
+
+import (
+	"carrot-market-clone-api/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type RevocationStore interface {
+	RevokeToken(tokenId string, expiresAt time.Time) (err error)
+
+	RevokeUser(userId string, revokedAt time.Time) (err error)
+
+	IsRevoked(tokenId, userId string, issuedAt time.Time) (revoked bool, err error)
+}
+
+type RevocationStoreImpl struct {
+	db *gorm.DB
+}
+
+func NewRevocationStoreImpl(db *gorm.DB) RevocationStore {
+	return &RevocationStoreImpl{db: db}
+}
+
+func (r *RevocationStoreImpl) RevokeToken(tokenId string, expiresAt time.Time) (err error) {
+	err = r.db.Transaction(func(tx *gorm.DB) error {
+		// 만료된 토큰은 어차피 검증을 통과하지 못하므로 함께 정리한다.
+		if err := tx.Delete(&models.RevokedToken{}, "expires_at < ?", time.Now()).Error; err != nil {
+			return err
+		}
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.RevokedToken{
+			ID:        tokenId,
+			ExpiresAt: expiresAt,
+		}).Error
+	})
+	return
+}
+
+func (r *RevocationStoreImpl) RevokeUser(userId string, revokedAt time.Time) (err error) {
+	err = r.db.Clauses(clause.OnConflict{UpdateAll: true}).Create(&models.UserRevocation{
+		UserID:    userId,
+		RevokedAt: revokedAt,
+	}).Error
+	return
+}
+
+// 조회에 실패하면 err를 돌려주며, 호출한 쪽은 토큰을 거부해야 한다.
+func (r *RevocationStoreImpl) IsRevoked(tokenId, userId string, issuedAt time.Time) (revoked bool, err error) {
+	err = r.db.Model(&models.RevokedToken{}).Select("count(*) > 0").Where("id = ?", tokenId).Find(&revoked).Error
+	if err != nil || revoked {
+		return
+	}
+	err = r.db.Model(&models.UserRevocation{}).Select("count(*) > 0").
+		Where("user_id = ? AND revoked_at >= ?", userId, issuedAt).
+		Find(&revoked).
+		Error
+	return
+}
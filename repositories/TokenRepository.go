@@ -0,0 +1,63 @@
+package repositories
+
+import (
+	"carrot-market-clone-api/models"
+
+	"gorm.io/gorm"
+)
+
+type TokenRepository interface {
+	GetRefreshToken(tokenId string) (token *models.RefreshToken, err error)
+
+	InsertRefreshToken(token *models.RefreshToken) (err error)
+
+	UseRefreshToken(tokenId string) (ok bool, err error)
+
+	RevokeTokenFamily(familyId string) (err error)
+
+	RevokeUserTokens(userId string) (err error)
+}
+
+type TokenRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func NewTokenRepositoryImpl(db *gorm.DB) TokenRepository {
+	return &TokenRepositoryImpl{db: db}
+}
+
+func (r *TokenRepositoryImpl) GetRefreshToken(tokenId string) (token *models.RefreshToken, err error) {
+	token = &models.RefreshToken{}
+	err = r.db.Model(&models.RefreshToken{}).First(token, "id = ?", tokenId).Error
+	return
+}
+
+func (r *TokenRepositoryImpl) InsertRefreshToken(token *models.RefreshToken) (err error) {
+	err = r.db.Create(token).Error
+	return
+}
+
+// 아직 사용되지 않은 토큰만 사용 처리한다.
+// 이미 사용되었거나 폐기된 토큰이면 ok는 false이다.
+func (r *TokenRepositoryImpl) UseRefreshToken(tokenId string) (ok bool, err error) {
+	result := r.db.Model(&models.RefreshToken{}).
+		Where("id = ? AND used = ? AND revoked = ?", tokenId, false, false).
+		Update("used", true)
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *TokenRepositoryImpl) RevokeTokenFamily(familyId string) (err error) {
+	err = r.db.Model(&models.RefreshToken{}).
+		Where("family_id = ?", familyId).
+		Update("revoked", true).
+		Error
+	return
+}
+
+func (r *TokenRepositoryImpl) RevokeUserTokens(userId string) (err error) {
+	err = r.db.Model(&models.RefreshToken{}).
+		Where("user_id = ? AND revoked = ?", userId, false).
+		Update("revoked", true).
+		Error
+	return
+}
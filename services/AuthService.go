@@ -1,37 +1,85 @@
 package services
 
 import (
+	"carrot-market-clone-api/models"
 	"carrot-market-clone-api/repositories"
 	"gorm.io/gorm"
+	"math"
 	"os"
 	"time"
     "errors"
 
 	"github.com/golang-jwt/jwt"
+	"github.com/google/uuid"
+)
+
+const (
+    accessTokenTTL  = time.Minute * 30
+    refreshTokenTTL = time.Hour * 24 * 30
+)
+
+// 액세스 토큰의 role 클레임. 운영자도 자신의 사용자 API는 그대로 쓸 수 있다.
+const (
+    RoleUser  = "user"
+    RoleAdmin = "admin"
+)
+
+var (
+    ErrInvalidRefreshToken  = errors.New("invalid refresh token")
+    ErrRefreshTokenReused   = errors.New("refresh token reuse detected")
+    ErrTokenRevoked         = errors.New("token has been revoked")
+    ErrMissingTokenId       = errors.New("token has no jti")
 )
 
 type AuthService interface {
-    CreateAccessToken(userId string)        (at string, err error)
-    VerifyAccessToken(at string)            (claims jwt.MapClaims, err error)      
+    CreateAccessToken(userId, sessionId string) (at string, err error)
+    VerifyAccessToken(at string)                (claims jwt.MapClaims, err error)
+    CreateRefreshToken(userId string)           (rt string, sessionId string, err error)
+    RefreshTokens(rt string)                    (at string, newRt string, err error)
+    Logout(claims jwt.MapClaims, rt string)     (err error)
+    LogoutAll(userId string)                    (err error)
 }
 
 type AuthServiceImpl struct {
-    userRepo repositories.UserRepository
+    userRepo        repositories.UserRepository
+    tokenRepo       repositories.TokenRepository
+    deviceRepo      repositories.DeviceRepository
+    revocationStore repositories.RevocationStore
 }
 
-func NewAuthServiceImpl(userRepo repositories.UserRepository) AuthService {
-    return &AuthServiceImpl{ userRepo: userRepo }
+func NewAuthServiceImpl(
+    userRepo repositories.UserRepository,
+    tokenRepo repositories.TokenRepository,
+    deviceRepo repositories.DeviceRepository,
+    revocationStore repositories.RevocationStore,
+) AuthService {
+    return &AuthServiceImpl{
+        userRepo:           userRepo,
+        tokenRepo:          tokenRepo,
+        deviceRepo:         deviceRepo,
+        revocationStore:    revocationStore,
+    }
 }
 
-func (s *AuthServiceImpl) CreateAccessToken(userId string) (at string, err error) {
+// sessionId는 같은 로그인에서 발급된 리프레시 토큰의 패밀리 ID이며 sid 클레임에 담는다.
+func (s *AuthServiceImpl) CreateAccessToken(userId, sessionId string) (at string, err error) {
     atClaims := jwt.MapClaims{}
-    if !s.userRepo.CheckUserExists("id", userId) {
-        return "", gorm.ErrRecordNotFound
+    user, err := s.userRepo.GetUser("id", userId)
+    if err != nil {
+        return "", err
+    }
+    role := RoleUser
+    if user.Admin {
+        role = RoleAdmin
     }
+    now := time.Now()
     atClaims["authorized"] = true
+    atClaims["jti"] = uuid.NewString()
     atClaims["user_id"] = userId
-    atClaims["role"] = "user"
-    atClaims["exp"] = time.Now().Add(time.Hour * 24 * 7).Unix()
+    atClaims["sid"] = sessionId
+    atClaims["role"] = role
+    atClaims["iat"] = issuedAt(now)
+    atClaims["exp"] = now.Add(accessTokenTTL).Unix()
     token := jwt.NewWithClaims(jwt.SigningMethodHS256, atClaims)
     at, err = token.SignedString([]byte(os.Getenv("ACCESS_SECRET")))
 
@@ -39,15 +87,184 @@ func (s *AuthServiceImpl) CreateAccessToken(userId string) (at string, err error
 }
 
 func (s *AuthServiceImpl) VerifyAccessToken(at string) (claims jwt.MapClaims, err error) {
+    claims, err = verifyToken(at, os.Getenv("ACCESS_SECRET"))
+    if err != nil {
+        return
+    }
+
+    // jti가 없는 예전 토큰은 하나씩 폐기할 수 없으므로 받지 않는다.
+    tokenId, _ := claims["jti"].(string)
+    if tokenId == "" {
+        return nil, ErrMissingTokenId
+    }
+    userId, _ := claims["user_id"].(string)
+    revoked, err := s.revocationStore.IsRevoked(tokenId, userId, claimTime(claims, "iat"))
+    if err != nil {
+        return nil, err
+    }
+    if revoked {
+        return nil, ErrTokenRevoked
+    }
+    return
+}
+
+// 로그인할 때마다 새로운 토큰 패밀리를 시작하고, 패밀리 ID를 sessionId로 돌려준다.
+func (s *AuthServiceImpl) CreateRefreshToken(userId string) (rt string, sessionId string, err error) {
+    if !s.userRepo.CheckUserExists("id", userId) {
+        return "", "", gorm.ErrRecordNotFound
+    }
+    sessionId = uuid.NewString()
+    rt, err = s.issueRefreshToken(userId, sessionId)
+    return
+}
+
+// 리프레시 토큰을 한 번 사용하고, 같은 패밀리의 새 토큰과 액세스 토큰을 발급한다.
+// 이미 사용된 토큰이 다시 들어오면 탈취된 것으로 보고 패밀리 전체를 폐기한다.
+func (s *AuthServiceImpl) RefreshTokens(rt string) (at string, newRt string, err error) {
+    claims, err := verifyToken(rt, os.Getenv("REFRESH_SECRET"))
+    if err != nil {
+        return
+    }
+
+    tokenId, _ := claims["jti"].(string)
+    userId, _ := claims["user_id"].(string)
+
+    token, err := s.tokenRepo.GetRefreshToken(tokenId)
+    if err == gorm.ErrRecordNotFound {
+        return "", "", ErrInvalidRefreshToken
+    } else if err != nil {
+        return
+    }
+
+    if token.UserID != userId || token.Revoked {
+        return "", "", ErrInvalidRefreshToken
+    }
+
+    revoked, err := s.revocationStore.IsRevoked(tokenId, userId, claimTime(claims, "iat"))
+    if err != nil {
+        return
+    }
+    if revoked {
+        return "", "", ErrTokenRevoked
+    }
+
+    ok, err := s.tokenRepo.UseRefreshToken(tokenId)
+    if err != nil {
+        return
+    }
+    if !ok {
+        if err = s.tokenRepo.RevokeTokenFamily(token.FamilyID); err != nil {
+            return
+        }
+        return "", "", ErrRefreshTokenReused
+    }
+
+    if at, err = s.CreateAccessToken(userId, token.FamilyID); err != nil {
+        return
+    }
+    newRt, err = s.issueRefreshToken(userId, token.FamilyID)
+    return
+}
+
+// 현재 액세스 토큰과 그 로그인(sid)의 리프레시 토큰 패밀리, 함께 전달된 리프레시 토큰의 패밀리를 폐기한다.
+// 이 로그인에서 등록한 기기도 지워 더 이상 푸시 알림을 받지 않게 한다.
+func (s *AuthServiceImpl) Logout(claims jwt.MapClaims, rt string) (err error) {
+    tokenId, _ := claims["jti"].(string)
+    userId, _ := claims["user_id"].(string)
+    sessionId, _ := claims["sid"].(string)
+
+    err = s.revocationStore.RevokeToken(tokenId, claimTime(claims, "exp"))
+    if err != nil {
+        return
+    }
+    if sessionId != "" {
+        if err = s.tokenRepo.RevokeTokenFamily(sessionId); err != nil {
+            return
+        }
+        if err = s.deviceRepo.DeleteSessionDevices(sessionId); err != nil {
+            return
+        }
+    }
+    if rt == "" {
+        return
+    }
+
+    rtClaims, err := verifyToken(rt, os.Getenv("REFRESH_SECRET"))
+    if err != nil {
+        return ErrInvalidRefreshToken
+    }
+    refreshTokenId, _ := rtClaims["jti"].(string)
+
+    token, err := s.tokenRepo.GetRefreshToken(refreshTokenId)
+    if err == gorm.ErrRecordNotFound || (err == nil && token.UserID != userId) {
+        return ErrInvalidRefreshToken
+    } else if err != nil {
+        return
+    }
+    if err = s.tokenRepo.RevokeTokenFamily(token.FamilyID); err != nil {
+        return
+    }
+    if token.FamilyID != sessionId {
+        err = s.deviceRepo.DeleteSessionDevices(token.FamilyID)
+    }
+    return
+}
+
+// 지금까지 발급된 사용자의 모든 액세스 토큰과 리프레시 토큰을 폐기하고 등록된 기기를 모두 지운다.
+func (s *AuthServiceImpl) LogoutAll(userId string) (err error) {
+    // 토큰의 iat와 같은 밀리초 단위로 맞춘다. 폐기한 뒤 같은 초에 다시 로그인해도 새 토큰은 유효하다.
+    if err = s.revocationStore.RevokeUser(userId, time.Now().Truncate(time.Millisecond)); err != nil {
+        return
+    }
+    if err = s.tokenRepo.RevokeUserTokens(userId); err != nil {
+        return
+    }
+    return s.deviceRepo.DeleteUserDevices(userId)
+}
+
+func (s *AuthServiceImpl) issueRefreshToken(userId, familyId string) (rt string, err error) {
+    token := &models.RefreshToken{
+        ID:         uuid.NewString(),
+        FamilyID:   familyId,
+        UserID:     userId,
+        ExpiresAt:  time.Now().Add(refreshTokenTTL),
+    }
+
+    rtClaims := jwt.MapClaims{}
+    rtClaims["jti"] = token.ID
+    rtClaims["user_id"] = userId
+    rtClaims["iat"] = issuedAt(time.Now())
+    rtClaims["exp"] = token.ExpiresAt.Unix()
+    rt, err = jwt.NewWithClaims(jwt.SigningMethodHS256, rtClaims).
+        SignedString([]byte(os.Getenv("REFRESH_SECRET")))
+    if err != nil {
+        return
+    }
+
+    err = s.tokenRepo.InsertRefreshToken(token)
+    return
+}
+
+func verifyToken(tokenString, secret string) (claims jwt.MapClaims, err error) {
     claims = jwt.MapClaims{}
     verifying := func(token *jwt.Token) (interface{}, error) {
         if token.Method != jwt.SigningMethodHS256 {
             return nil, errors.New("Unexpected Signing Method")
         }
-        return []byte(os.Getenv("ACCESS_SECRET")), nil
+        return []byte(secret), nil
     }
-    _, err = jwt.ParseWithClaims(at, &claims, verifying)
+    _, err = jwt.ParseWithClaims(tokenString, &claims, verifying)
     return
 }
 
+// iat는 같은 초에 로그아웃하고 다시 로그인한 토큰을 구분할 수 있도록 밀리초까지 담는다.
+func issuedAt(now time.Time) float64 {
+    return float64(now.UnixNano() / int64(time.Millisecond)) / 1000
+}
 
+func claimTime(claims jwt.MapClaims, key string) time.Time {
+    if v, ok := claims[key].(float64); ok {
+        return time.Unix(0, int64(math.Round(v * 1000)) * int64(time.Millisecond))
+    }
+    return time.Time{}
+}
@@ -0,0 +1,397 @@
+package services_test
+
+import (
+	"carrot-market-clone-api/models"
+	"carrot-market-clone-api/repositories"
+	"carrot-market-clone-api/services"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+type stubUserRepository struct {
+	repositories.UserRepository
+}
+
+func (r *stubUserRepository) CheckUserExists(column, value string) bool {
+	return value == "user 1"
+}
+
+func (r *stubUserRepository) GetUser(column, value string) (*models.User, error) {
+	if value != "user 1" {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &models.User{ID: value}, nil
+}
+
+// 메모리에 리프레시 토큰을 저장하는 TokenRepository
+type memoryTokenRepository struct {
+	mutex  sync.Mutex
+	tokens map[string]*models.RefreshToken
+}
+
+func newMemoryTokenRepository() *memoryTokenRepository {
+	return &memoryTokenRepository{tokens: make(map[string]*models.RefreshToken)}
+}
+
+func (r *memoryTokenRepository) GetRefreshToken(tokenId string) (*models.RefreshToken, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	token, ok := r.tokens[tokenId]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	copied := *token
+	return &copied, nil
+}
+
+func (r *memoryTokenRepository) InsertRefreshToken(token *models.RefreshToken) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	copied := *token
+	r.tokens[token.ID] = &copied
+	return nil
+}
+
+func (r *memoryTokenRepository) UseRefreshToken(tokenId string) (bool, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	token, ok := r.tokens[tokenId]
+	if !ok || token.Used || token.Revoked {
+		return false, nil
+	}
+	token.Used = true
+	return true, nil
+}
+
+func (r *memoryTokenRepository) RevokeTokenFamily(familyId string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, token := range r.tokens {
+		if token.FamilyID == familyId {
+			token.Revoked = true
+		}
+	}
+	return nil
+}
+
+func (r *memoryTokenRepository) RevokeUserTokens(userId string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, token := range r.tokens {
+		if token.UserID == userId {
+			token.Revoked = true
+		}
+	}
+	return nil
+}
+
+// 패밀리의 모든 토큰이 폐기되었으면 true를 돌려준다.
+func (r *memoryTokenRepository) familyRevoked(familyId string) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, token := range r.tokens {
+		if token.FamilyID == familyId && !token.Revoked {
+			return false
+		}
+	}
+	return true
+}
+
+type stubDeviceRepository struct {
+	repositories.DeviceRepository
+}
+
+func (r *stubDeviceRepository) DeleteSessionDevices(sessionId string) error {
+	return nil
+}
+
+func (r *stubDeviceRepository) DeleteUserDevices(userId string) error {
+	return nil
+}
+
+// 조회할 때마다 실패하는 RevocationStore
+type failingRevocationStore struct {
+	repositories.RevocationStore
+}
+
+var errStoreDown = errors.New("revocation store is down")
+
+func (r *failingRevocationStore) IsRevoked(tokenId, userId string, issuedAt time.Time) (bool, error) {
+	return false, errStoreDown
+}
+
+func newAuthService(t *testing.T, revocationStore repositories.RevocationStore) (services.AuthService, *memoryTokenRepository) {
+	t.Setenv("ACCESS_SECRET", "access secret")
+	t.Setenv("REFRESH_SECRET", "refresh secret")
+
+	tokenRepo := newMemoryTokenRepository()
+	s := services.NewAuthServiceImpl(&stubUserRepository{}, tokenRepo, &stubDeviceRepository{}, revocationStore)
+	return s, tokenRepo
+}
+
+// 모든 기기에서 로그아웃하면 이전 토큰은 폐기되지만, 같은 초에 다시 로그인한 토큰은 유효하다.
+func TestAuthServiceLogoutAll(t *testing.T) {
+	s, _ := newAuthService(t, repositories.NewMemoryRevocationStore())
+
+	rt, sessionId, err := s.CreateRefreshToken("user 1")
+	assert.NoError(t, err)
+	at, err := s.CreateAccessToken("user 1", sessionId)
+	assert.NoError(t, err)
+
+	time.Sleep(2 * time.Millisecond)
+	assert.NoError(t, s.LogoutAll("user 1"))
+	time.Sleep(2 * time.Millisecond)
+
+	_, err = s.VerifyAccessToken(at)
+	assert.Equal(t, services.ErrTokenRevoked, err)
+	_, _, err = s.RefreshTokens(rt)
+	assert.Equal(t, services.ErrInvalidRefreshToken, err)
+
+	rt, sessionId, err = s.CreateRefreshToken("user 1")
+	assert.NoError(t, err)
+	at, err = s.CreateAccessToken("user 1", sessionId)
+	assert.NoError(t, err)
+
+	_, err = s.VerifyAccessToken(at)
+	assert.NoError(t, err)
+	_, _, err = s.RefreshTokens(rt)
+	assert.NoError(t, err)
+}
+
+// 리프레시 토큰 없이 로그아웃해도 그 로그인의 리프레시 토큰은 더 이상 쓸 수 없다.
+func TestAuthServiceLogout(t *testing.T) {
+	s, _ := newAuthService(t, repositories.NewMemoryRevocationStore())
+
+	rt, sessionId, err := s.CreateRefreshToken("user 1")
+	assert.NoError(t, err)
+	at, err := s.CreateAccessToken("user 1", sessionId)
+	assert.NoError(t, err)
+	other, _, err := s.CreateRefreshToken("user 1")
+	assert.NoError(t, err)
+
+	claims, err := s.VerifyAccessToken(at)
+	assert.NoError(t, err)
+	assert.NoError(t, s.Logout(claims, ""))
+
+	_, err = s.VerifyAccessToken(at)
+	assert.Equal(t, services.ErrTokenRevoked, err)
+	_, _, err = s.RefreshTokens(rt)
+	assert.Equal(t, services.ErrInvalidRefreshToken, err)
+
+	// 다른 기기의 로그인은 그대로 둔다.
+	_, _, err = s.RefreshTokens(other)
+	assert.NoError(t, err)
+}
+
+// jti가 없는 토큰은 폐기 여부를 확인할 수 없으므로 거부한다.
+func TestAuthServiceMissingTokenId(t *testing.T) {
+	s, _ := newAuthService(t, repositories.NewMemoryRevocationStore())
+
+	at, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"authorized": true,
+		"user_id":    "user 1",
+		"exp":        time.Now().Add(time.Minute).Unix(),
+	}).SignedString([]byte("access secret"))
+	assert.NoError(t, err)
+
+	_, err = s.VerifyAccessToken(at)
+	assert.Equal(t, services.ErrMissingTokenId, err)
+}
+
+// 폐기 여부를 확인하지 못하면 토큰을 거부한다.
+func TestAuthServiceRevocationStoreError(t *testing.T) {
+	s, _ := newAuthService(t, &failingRevocationStore{})
+
+	rt, sessionId, err := s.CreateRefreshToken("user 1")
+	assert.NoError(t, err)
+	at, err := s.CreateAccessToken("user 1", sessionId)
+	assert.NoError(t, err)
+
+	_, err = s.VerifyAccessToken(at)
+	assert.Equal(t, errStoreDown, err)
+	_, _, err = s.RefreshTokens(rt)
+	assert.Equal(t, errStoreDown, err)
+}
+
+// 저장소에 토큰을 넣고 claims로 서명한 리프레시 토큰을 만든다.
+func signRefreshToken(t *testing.T, tokenRepo *memoryTokenRepository, token *models.RefreshToken, claims jwt.MapClaims) string {
+	assert.NoError(t, tokenRepo.InsertRefreshToken(token))
+
+	claims["jti"] = token.ID
+	claims["iat"] = float64(token.ExpiresAt.Add(-time.Hour).Unix())
+	claims["exp"] = token.ExpiresAt.Unix()
+	rt, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("refresh secret"))
+	assert.NoError(t, err)
+	return rt
+}
+
+func familyId(t *testing.T, tokenRepo *memoryTokenRepository, rt string) string {
+	claims := jwt.MapClaims{}
+	_, _, err := new(jwt.Parser).ParseUnverified(rt, &claims)
+	assert.NoError(t, err)
+
+	token, err := tokenRepo.GetRefreshToken(claims["jti"].(string))
+	assert.NoError(t, err)
+	return token.FamilyID
+}
+
+func TestAuthServiceRefreshTokens(t *testing.T) {
+	tests := []struct {
+		name string
+		// 리프레시할 토큰과 그 토큰의 패밀리를 만든다.
+		setup func(t *testing.T, s services.AuthService, tokenRepo *memoryTokenRepository) (rt string, familyId string)
+		err   error
+		// 만료된 토큰은 jwt.ValidationError로 거부된다.
+		expired       bool
+		familyRevoked bool
+	}{
+		{
+			name: "rotated token",
+			setup: func(t *testing.T, s services.AuthService, tokenRepo *memoryTokenRepository) (string, string) {
+				rt, sessionId, err := s.CreateRefreshToken("user 1")
+				assert.NoError(t, err)
+				_, rt, err = s.RefreshTokens(rt)
+				assert.NoError(t, err)
+				return rt, sessionId
+			},
+		},
+		{
+			name: "reused token revokes family",
+			setup: func(t *testing.T, s services.AuthService, tokenRepo *memoryTokenRepository) (string, string) {
+				rt, sessionId, err := s.CreateRefreshToken("user 1")
+				assert.NoError(t, err)
+				_, _, err = s.RefreshTokens(rt)
+				assert.NoError(t, err)
+				return rt, sessionId
+			},
+			err:           services.ErrRefreshTokenReused,
+			familyRevoked: true,
+		},
+		{
+			name: "reused token in rotation chain revokes family",
+			setup: func(t *testing.T, s services.AuthService, tokenRepo *memoryTokenRepository) (string, string) {
+				rt, sessionId, err := s.CreateRefreshToken("user 1")
+				assert.NoError(t, err)
+				_, rotated, err := s.RefreshTokens(rt)
+				assert.NoError(t, err)
+				_, _, err = s.RefreshTokens(rotated)
+				assert.NoError(t, err)
+				return rotated, sessionId
+			},
+			err:           services.ErrRefreshTokenReused,
+			familyRevoked: true,
+		},
+		{
+			name: "latest token after reuse",
+			setup: func(t *testing.T, s services.AuthService, tokenRepo *memoryTokenRepository) (string, string) {
+				rt, sessionId, err := s.CreateRefreshToken("user 1")
+				assert.NoError(t, err)
+				_, rotated, err := s.RefreshTokens(rt)
+				assert.NoError(t, err)
+				_, _, err = s.RefreshTokens(rt)
+				assert.Equal(t, services.ErrRefreshTokenReused, err)
+				return rotated, sessionId
+			},
+			err:           services.ErrInvalidRefreshToken,
+			familyRevoked: true,
+		},
+		{
+			name: "logged out family",
+			setup: func(t *testing.T, s services.AuthService, tokenRepo *memoryTokenRepository) (string, string) {
+				rt, sessionId, err := s.CreateRefreshToken("user 1")
+				assert.NoError(t, err)
+				at, err := s.CreateAccessToken("user 1", sessionId)
+				assert.NoError(t, err)
+				claims, err := s.VerifyAccessToken(at)
+				assert.NoError(t, err)
+				assert.NoError(t, s.Logout(claims, rt))
+				return rt, sessionId
+			},
+			err:           services.ErrInvalidRefreshToken,
+			familyRevoked: true,
+		},
+		{
+			name: "expired family",
+			setup: func(t *testing.T, s services.AuthService, tokenRepo *memoryTokenRepository) (string, string) {
+				token := &models.RefreshToken{
+					ID:        "expired",
+					FamilyID:  "expired family",
+					UserID:    "user 1",
+					ExpiresAt: time.Now().Add(-time.Minute),
+				}
+				return signRefreshToken(t, tokenRepo, token, jwt.MapClaims{"user_id": "user 1"}), token.FamilyID
+			},
+			expired: true,
+		},
+		{
+			name: "unknown token",
+			setup: func(t *testing.T, s services.AuthService, tokenRepo *memoryTokenRepository) (string, string) {
+				rt, sessionId, err := s.CreateRefreshToken("user 1")
+				assert.NoError(t, err)
+				claims := jwt.MapClaims{}
+				_, _, err = new(jwt.Parser).ParseUnverified(rt, &claims)
+				assert.NoError(t, err)
+				claims["jti"] = "unknown"
+				rt, err = jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("refresh secret"))
+				assert.NoError(t, err)
+				return rt, sessionId
+			},
+			err: services.ErrInvalidRefreshToken,
+		},
+		{
+			name: "token of another user",
+			setup: func(t *testing.T, s services.AuthService, tokenRepo *memoryTokenRepository) (string, string) {
+				token := &models.RefreshToken{
+					ID:        "other",
+					FamilyID:  "other family",
+					UserID:    "user 2",
+					ExpiresAt: time.Now().Add(time.Hour),
+				}
+				return signRefreshToken(t, tokenRepo, token, jwt.MapClaims{"user_id": "user 1"}), token.FamilyID
+			},
+			err: services.ErrInvalidRefreshToken,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s, tokenRepo := newAuthService(t, repositories.NewMemoryRevocationStore())
+			rt, family := test.setup(t, s, tokenRepo)
+
+			at, newRt, err := s.RefreshTokens(rt)
+			switch {
+			case test.expired:
+				validationErr, ok := err.(*jwt.ValidationError)
+				assert.True(t, ok)
+				if ok {
+					assert.Equal(t, jwt.ValidationErrorExpired, validationErr.Errors)
+				}
+			case test.err != nil:
+				assert.Equal(t, test.err, err)
+			default:
+				assert.NoError(t, err)
+				_, err = s.VerifyAccessToken(at)
+				assert.NoError(t, err)
+				assert.Equal(t, family, familyId(t, tokenRepo, newRt))
+			}
+
+			if err != nil {
+				assert.Empty(t, at)
+				assert.Empty(t, newRt)
+			}
+			assert.Equal(t, test.familyRevoked, tokenRepo.familyRevoked(family))
+		})
+	}
+}
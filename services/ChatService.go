@@ -3,57 +3,351 @@ package services
 import (
 	"carrot-market-clone-api/models"
 	"carrot-market-clone-api/repositories"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"mime/multipart"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidChat       = errors.New("메시지 형식이 올바르지 않습니다.")
+	ErrNotChatSender     = errors.New("본인이 보낸 메시지가 아닙니다.")
+	ErrChatDeleted       = errors.New("이미 삭제된 메시지입니다.")
+	ErrEditWindowExpired = errors.New("수정하거나 삭제할 수 있는 시간이 지났습니다.")
+	ErrInvalidCursor     = errors.New("cursor가 올바르지 않습니다.")
+	ErrInvalidKeyword    = errors.New("검색어는 2자 이상 100자 이하여야 합니다.")
+	ErrNotProductOwner   = errors.New("본인의 상품이 아닙니다.")
+	ErrCounterpartLeft   = errors.New("상대방이 나간 채팅방에는 메시지를 보낼 수 없습니다.")
+	ErrChatTooLong       = fmt.Errorf("메시지는 %d자 이하여야 합니다.", MaxChatLength)
+)
+
+// CHAT_EDIT_WINDOW가 없을 때 메시지를 수정하거나 취소할 수 있는 시간
+const defaultEditWindow = 15 * time.Minute
+
+const maxClientMsgIdLength = 64
+
+// 메시지 내용의 최대 글자 수. 소켓으로 읽는 프레임의 크기 제한도 이 길이를 기준으로 정한다.
+const MaxChatLength = 1000
+
+const DefaultChatroomSize = 10
+
+const (
+	DefaultSearchSize = 20
+	MaxSearchSize     = 100
+
+	// 검색 인덱스의 ngram 길이보다 짧은 검색어는 찾을 수 없다.
+	minKeywordLength = 2
+	maxKeywordLength = 100
+	// 긴 메시지는 첫 번째 검색어 앞뒤로 이만큼의 글자만 보여준다.
+	searchContextLength = 40
+)
+
+const (
+	DefaultSyncSize = 100
+	MaxSyncSize     = 500
 )
 
 type ChatService interface {
-	CreateChatroom(productId int, userId string) (chatroomId int, err error)
-	InsertChat(chatroomId int, userId, content string) (err error)
+	CreateChatroom(
+		productId int,
+		userId string,
+		chat *models.Chat,
+	) (chatroomId int, created bool, duplicate bool, err error)
+	InsertChat(userId string, chat *models.Chat) (duplicate bool, err error)
+	SendImage(chatroomId int, userId string, file multipart.File) (chat *models.Chat, err error)
 	CheckCorrectUser(userId string, chatroomId int) (isCorrect bool)
-	GetChatroom(chatroomId int) (chatroom *models.Chatroom, err error)
+	GetChatroom(chatroomId int, userId string) (chatroom *models.Chatroom, err error)
+	GetChatroomIds(userId string) (chatroomIds []int, err error)
+	GetProductChatroomId(productId int, userId string) (chatroomId int)
+	GetChatroomUserIds(chatroomId int) (userIds []string, err error)
 	GetChatrooms(
 		userId string,
-		last *int,
-		size *int,
-	) (chatrooms []models.Chatroom, count int, err error)
+		cursor string,
+		size int,
+		archived bool,
+	) (chatrooms []models.Chatroom, nextCursor string, err error)
+	GetProductChatrooms(
+		productId int,
+		userId string,
+		cursor string,
+		size int,
+	) (chatrooms []models.Chatroom, nextCursor string, err error)
+	LeaveChatroom(chatroomId int, userId string) (chat *models.Chat, err error)
+	UpdateChatroomSettings(
+		chatroomId int,
+		userId string,
+		settings models.ChatroomSettings,
+	) (chatroom *models.Chatroom, err error)
 	GetChats(
 		chatroomId int,
 		last *int,
 		size int,
 	) (chats []models.Chat, count int, err error)
+	ReadChats(chatroomId int, userId string, chatId int) (lastReadChatId int, err error)
+	SyncChats(userId string, since int, size int) (chats []models.Chat, hasMore bool, err error)
+	SearchChats(
+		userId string,
+		keyword string,
+		cursor string,
+		size int,
+	) (results []models.ChatSearchResult, nextCursor string, err error)
+	EditChat(userId string, chatroomId, chatId int, content string) (chat *models.Chat, err error)
+	UnsendChat(userId string, chatroomId, chatId int) (chat *models.Chat, err error)
+	UpdateLastSeen(userId string, lastSeenAt time.Time) (err error)
+	GetTranscript(chatroomId int, withDeleted bool) (transcript *models.Transcript, err error)
+	GetReplyTemplate(userId string, templateId int) (template *models.ReplyTemplate, err error)
+	CreateAwayReply(chatroomId int, buyerId string) (chat *models.Chat, err error)
 }
 
 type ChatServiceImpl struct {
-	chatRepo repositories.ChatRepository
+	chatRepo       repositories.ChatRepository
+	replyRepo      repositories.ReplyRepository
+	awsService     AWSService
+	contentChecker ContentChecker
 }
 
-func NewChatServiceImpl(chatRepo repositories.ChatRepository) ChatService {
+func NewChatServiceImpl(
+	chatRepo repositories.ChatRepository,
+	replyRepo repositories.ReplyRepository,
+	awsService AWSService,
+	contentChecker ContentChecker,
+) ChatService {
 	return &ChatServiceImpl{
-		chatRepo: chatRepo,
+		chatRepo:       chatRepo,
+		replyRepo:      replyRepo,
+		awsService:     awsService,
+		contentChecker: contentChecker,
 	}
 }
 
-func (s *ChatServiceImpl) CreateChatroom(productId int, userId string) (chatroomId int, err error) {
-	chatroom, err := s.chatRepo.InsertChatroom(productId, userId)
+// 구매자 userId와 판매자의 채팅방을 만든다. 이미 있으면 그 채팅방을 쓰고 created는 false이다.
+// chat이 있으면 채팅방과 함께 첫 메시지로 저장하고 저장된 메시지로 채운다.
+// 같은 ClientMsgID로 이미 보낸 메시지가 있으면 저장하지 않고 그 메시지로 채운 뒤 duplicate를 돌려준다.
+func (s *ChatServiceImpl) CreateChatroom(
+	productId int,
+	userId string,
+	chat *models.Chat,
+) (chatroomId int, created bool, duplicate bool, err error) {
+	if chat != nil {
+		if chat.Type == "" {
+			chat.Type = models.TEXT
+		}
+		if err = validateChat(chat); err != nil {
+			return
+		}
+	}
+
+	chatroomId = s.chatRepo.GetChatroomId(productId, userId)
+	created = chatroomId == 0
+	if chat != nil && !created {
+		chat.ChatUserID = s.chatRepo.GetChatUserId(chatroomId, userId)
+		if duplicate, err = s.findDuplicate(chat); duplicate || err != nil {
+			return
+		}
+		if s.chatRepo.CheckCounterpartLeft(userId, chatroomId) {
+			return chatroomId, false, false, ErrCounterpartLeft
+		}
+	}
+
+	chatroom, err := s.chatRepo.InsertChatroom(productId, userId, chat)
+	if err != nil {
+		// 동시에 재전송된 같은 요청이 먼저 저장된 경우
+		if chat != nil && chat.ClientMsgID != nil {
+			if chatroomId = s.chatRepo.GetChatroomId(productId, userId); chatroomId != 0 {
+				chat.ChatUserID = s.chatRepo.GetChatUserId(chatroomId, userId)
+				if duplicate, _ = s.findDuplicate(chat); duplicate {
+					return chatroomId, false, true, nil
+				}
+			}
+		}
+		return 0, false, false, err
+	}
 	chatroomId = chatroom.ID
+
+	if chat != nil {
+		saved, err := s.chatRepo.GetChat(chat.ID)
+		if err != nil {
+			return chatroomId, created, false, err
+		}
+		*chat = *saved
+		s.flagChat(userId, chat)
+	}
+	return
+}
+
+// chat.ChatroomID의 채팅방에 userId가 보낸 메시지로 저장하고, 저장된 메시지로 chat을 채운다.
+// 같은 사용자가 같은 ClientMsgID로 이미 보낸 메시지가 있으면 저장하지 않고 그 메시지로 채운 뒤 duplicate를 돌려준다.
+// 상대방이 나간 채팅방이면 메시지가 전달되지 않으므로 ErrCounterpartLeft를 돌려준다.
+func (s *ChatServiceImpl) InsertChat(userId string, chat *models.Chat) (duplicate bool, err error) {
+	if chat.Type == "" {
+		chat.Type = models.TEXT
+	}
+	if err = validateChat(chat); err != nil {
+		return
+	}
+
+	chat.ChatUserID = s.chatRepo.GetChatUserId(chat.ChatroomID, userId)
+	if duplicate, err = s.findDuplicate(chat); duplicate || err != nil {
+		return
+	}
+	if s.chatRepo.CheckCounterpartLeft(userId, chat.ChatroomID) {
+		return false, ErrCounterpartLeft
+	}
+
+	if err = s.chatRepo.InsertChat(chat); err != nil {
+		// 동시에 재전송된 같은 메시지가 먼저 저장되어 (chat_user_id, client_msg_id) 유일 인덱스에 걸린 경우
+		if duplicate, _ = s.findDuplicate(chat); duplicate {
+			err = nil
+		}
+		return
+	}
+
+	saved, err := s.chatRepo.GetChat(chat.ID)
+	if err != nil {
+		return
+	}
+	*chat = *saved
+	s.flagChat(userId, chat)
 	return
 }
 
-func (s *ChatServiceImpl) InsertChat(chatroomId int, userId, content string) (err error) {
-	err = s.chatRepo.InsertChat(&models.Chat{
+// 저장된 메시지가 의심스러우면 이유를 기록하고 chat.Flags에 채운다.
+// 검사나 기록에 실패해도 메시지는 그대로 보낸다.
+func (s *ChatServiceImpl) flagChat(userId string, chat *models.Chat) {
+	reasons, err := s.contentChecker.Check(userId, chat)
+	if err != nil {
+		log.Println(err)
+	}
+	if len(reasons) == 0 {
+		return
+	}
+
+	if err := s.chatRepo.InsertChatFlags(chat.ID, reasons); err != nil {
+		log.Println(err)
+	}
+	chat.Flags = reasons
+}
+
+func (s *ChatServiceImpl) findDuplicate(chat *models.Chat) (duplicate bool, err error) {
+	if chat.ClientMsgID == nil {
+		return
+	}
+
+	saved, err := s.chatRepo.GetChatByClientMsgId(chat.ChatUserID, *chat.ClientMsgID)
+	if err == gorm.ErrRecordNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return
+	}
+	*chat = *saved
+	return true, nil
+}
+
+// 이미지를 업로드하고 IMAGE 메시지로 저장한다.
+func (s *ChatServiceImpl) SendImage(
+	chatroomId int,
+	userId string,
+	file multipart.File,
+) (chat *models.Chat, err error) {
+	filename, err := s.awsService.UploadFile(file)
+	if err != nil {
+		return
+	}
+
+	url := fmt.Sprintf("https://%s/images/%s", os.Getenv("AWS_S3_DOMAIN"), filename)
+	payload, err := json.Marshal(models.ImagePayload{URL: url})
+	if err != nil {
+		return
+	}
+
+	chat = &models.Chat{
 		ChatroomID: chatroomId,
-		ChatUserID: s.chatRepo.GetChatUserId(chatroomId, userId),
-		Content:    content,
-	})
+		Type:       models.IMAGE,
+		Payload:    payload,
+	}
+	if _, err = s.InsertChat(userId, chat); err != nil {
+		if err := s.awsService.DeleteFile(filename); err != nil {
+			log.Println(err)
+		}
+		return nil, err
+	}
 	return
 }
 
+func validateChat(chat *models.Chat) error {
+	if utf8.RuneCountInString(chat.Content) > MaxChatLength {
+		return ErrChatTooLong
+	}
+	if chat.ClientMsgID != nil && (*chat.ClientMsgID == "" || len(*chat.ClientMsgID) > maxClientMsgIdLength) {
+		return ErrInvalidChat
+	}
+
+	switch chat.Type {
+	case models.TEXT:
+		if strings.TrimSpace(chat.Content) == "" || len(chat.Payload) > 0 {
+			return ErrInvalidChat
+		}
+	case models.IMAGE:
+		payload := models.ImagePayload{}
+		if err := json.Unmarshal(chat.Payload, &payload); err != nil || payload.URL == "" {
+			return ErrInvalidChat
+		}
+	case models.LOCATION:
+		payload := models.LocationPayload{}
+		if err := json.Unmarshal(chat.Payload, &payload); err != nil ||
+			payload.Latitude < -90 || payload.Latitude > 90 ||
+			payload.Longitude < -180 || payload.Longitude > 180 {
+			return ErrInvalidChat
+		}
+	case models.SYSTEM:
+		payload := models.SystemPayload{}
+		if err := json.Unmarshal(chat.Payload, &payload); err != nil || payload.Event == "" {
+			return ErrInvalidChat
+		}
+	default:
+		return ErrInvalidChat
+	}
+	return nil
+}
+
 func (s *ChatServiceImpl) CheckCorrectUser(userId string, chatroomId int) (isCorrect bool) {
 	isCorrect = s.chatRepo.CheckCorrectUser(userId, chatroomId)
 	return
 }
 
-func (s *ChatServiceImpl) GetChatroom(chatroomId int) (chatroom *models.Chatroom, err error) {
-	return s.chatRepo.GetChatroom(chatroomId)
+func (s *ChatServiceImpl) GetChatroom(chatroomId int, userId string) (chatroom *models.Chatroom, err error) {
+	chatroom, err = s.chatRepo.GetChatroom(chatroomId, userId)
+	if err != nil {
+		return
+	}
+
+	hideDeleted(chatroom.LastChat)
+	unreadCounts, err := s.chatRepo.GetUnreadCounts(userId, []int{chatroomId})
+	chatroom.UnreadCount = unreadCounts[chatroomId]
+	return
+}
+
+func (s *ChatServiceImpl) GetChatroomIds(userId string) (chatroomIds []int, err error) {
+	return s.chatRepo.GetChatroomIds(userId)
+}
+
+// 구매자 userId가 상품에 대해 만든 채팅방 ID를 돌려준다. 없으면 0이다.
+func (s *ChatServiceImpl) GetProductChatroomId(productId int, userId string) (chatroomId int) {
+	return s.chatRepo.GetChatroomId(productId, userId)
+}
+
+func (s *ChatServiceImpl) GetChatroomUserIds(chatroomId int) (userIds []string, err error) {
+	return s.chatRepo.GetChatroomUserIds(chatroomId)
 }
 
 func (s *ChatServiceImpl) GetChats(
@@ -61,13 +355,507 @@ func (s *ChatServiceImpl) GetChats(
 	last *int,
 	size int,
 ) (chats []models.Chat, count int, err error) {
-	return s.chatRepo.GetChats(chatroomId, last, size)
+	chats, count, err = s.chatRepo.GetChats(chatroomId, last, size)
+	for i := range chats {
+		hideDeleted(&chats[i])
+	}
+	return
 }
 
+// 마지막 대화가 최근인 채팅방부터 size개씩 가져온다. 다음 페이지가 있으면 nextCursor로 이어서 요청한다.
+// 보관한 채팅방은 archived가 true일 때만 가져온다.
+// 보관하지 않은 목록의 첫 페이지에는 고정한 채팅방을 모두 앞에 붙이고, 나머지는 고정하지 않은 채팅방으로 페이지를 나눈다.
 func (s *ChatServiceImpl) GetChatrooms(
 	userId string,
-	last *int,
-	size *int,
-) (chatrooms []models.Chatroom, count int, err error) {
-	return s.chatRepo.GetChatrooms(userId, last, size)
+	cursor string,
+	size int,
+	archived bool,
+) (chatrooms []models.Chatroom, nextCursor string, err error) {
+	if size <= 0 {
+		size = DefaultChatroomSize
+	}
+
+	var after *repositories.ChatroomCursor
+	if cursor != "" {
+		if after, err = decodeChatroomCursor(cursor); err != nil {
+			return
+		}
+	}
+
+	chatrooms = []models.Chatroom{}
+	filter := repositories.ChatroomFilter{Archived: archived}
+	if !archived {
+		pinned, unpinned := true, false
+		filter.Pinned = &unpinned
+		if after == nil {
+			pinnedChatrooms, _, err := s.chatRepo.GetChatrooms(userId, nil, nil, repositories.ChatroomFilter{Pinned: &pinned})
+			if err != nil {
+				return nil, "", err
+			}
+			chatrooms = append(chatrooms, pinnedChatrooms...)
+		}
+	}
+
+	limit := size + 1
+	page, _, err := s.chatRepo.GetChatrooms(userId, after, &limit, filter)
+	if err != nil {
+		return
+	}
+	if len(page) > size {
+		page = page[:size]
+		nextCursor = encodeChatroomCursor(page[size-1])
+	}
+	chatrooms = append(chatrooms, page...)
+
+	err = s.fillChatrooms(userId, chatrooms)
+	return
+}
+
+// 판매자가 자신의 상품에 대한 구매자별 채팅방을 GetChatrooms와 같은 순서로 가져온다.
+func (s *ChatServiceImpl) GetProductChatrooms(
+	productId int,
+	userId string,
+	cursor string,
+	size int,
+) (chatrooms []models.Chatroom, nextCursor string, err error) {
+	ownerId := s.chatRepo.GetProductOwnerId(productId)
+	if ownerId == "" {
+		return nil, "", gorm.ErrRecordNotFound
+	}
+	if ownerId != userId {
+		return nil, "", ErrNotProductOwner
+	}
+
+	if size <= 0 {
+		size = DefaultChatroomSize
+	}
+
+	var after *repositories.ChatroomCursor
+	if cursor != "" {
+		if after, err = decodeChatroomCursor(cursor); err != nil {
+			return
+		}
+	}
+
+	limit := size + 1
+	chatrooms, _, err = s.chatRepo.GetProductChatrooms(productId, userId, after, &limit)
+	if err != nil {
+		return
+	}
+	if len(chatrooms) > size {
+		chatrooms = chatrooms[:size]
+		nextCursor = encodeChatroomCursor(chatrooms[size-1])
+	}
+
+	err = s.fillChatrooms(userId, chatrooms)
+	return
+}
+
+// 목록에 보여줄 수 있도록 취소된 마지막 메시지를 가리고 userId가 읽지 않은 메시지 수를 채운다.
+func (s *ChatServiceImpl) fillChatrooms(userId string, chatrooms []models.Chatroom) (err error) {
+	chatroomIds := make([]int, len(chatrooms))
+	for i, chatroom := range chatrooms {
+		chatroomIds[i] = chatroom.ID
+		hideDeleted(chatrooms[i].LastChat)
+	}
+
+	unreadCounts, err := s.chatRepo.GetUnreadCounts(userId, chatroomIds)
+	for i := range chatrooms {
+		chatrooms[i].UnreadCount = unreadCounts[chatrooms[i].ID]
+	}
+	return
+}
+
+// 상대방에게 나갔다는 SYSTEM 메시지를 남기고 채팅방에서 나간다. 저장된 메시지를 돌려준다.
+func (s *ChatServiceImpl) LeaveChatroom(chatroomId int, userId string) (chat *models.Chat, err error) {
+	payload, err := json.Marshal(models.SystemPayload{Event: models.SystemEventLeave})
+	if err != nil {
+		return
+	}
+
+	chatUserId := s.chatRepo.GetChatUserId(chatroomId, userId)
+	if chatUserId == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	chat = &models.Chat{
+		ChatUserID: chatUserId,
+		Type:       models.SYSTEM,
+		Content:    models.LeaveChatContent,
+		Payload:    payload,
+	}
+	if err = s.chatRepo.LeaveChatroom(chatroomId, userId, chat, time.Now()); err != nil {
+		return nil, err
+	}
+	return s.chatRepo.GetChat(chat.ID)
+}
+
+// 바꾼 설정이 반영된 채팅방을 돌려준다.
+func (s *ChatServiceImpl) UpdateChatroomSettings(
+	chatroomId int,
+	userId string,
+	settings models.ChatroomSettings,
+) (chatroom *models.Chatroom, err error) {
+	if err = s.chatRepo.UpdateChatroomSettings(chatroomId, userId, settings, time.Now()); err != nil {
+		return
+	}
+	return s.GetChatroom(chatroomId, userId)
+}
+
+// 채팅방 목록의 cursor는 정렬 기준을 드러내지 않도록 감싸서 내려준다.
+func encodeChatroomCursor(chatroom models.Chatroom) string {
+	cursor := fmt.Sprintf("%d:%d", chatroom.LastActivityAt.UnixNano(), chatroom.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(cursor))
+}
+
+func decodeChatroomCursor(cursor string) (*repositories.ChatroomCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var lastActivityAt int64
+	after := &repositories.ChatroomCursor{}
+	if _, err := fmt.Sscanf(string(data), "%d:%d", &lastActivityAt, &after.ChatroomID); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	after.LastActivityAt = time.Unix(0, lastActivityAt)
+	return after, nil
+}
+
+// chatId까지 읽은 것으로 표시한다. chatId가 0이면 채팅방의 마지막 메시지까지 읽은 것으로 본다.
+// 이미 더 뒤의 메시지까지 읽었다면 읽은 위치는 바뀌지 않으며, 최종 위치를 돌려준다.
+func (s *ChatServiceImpl) ReadChats(chatroomId int, userId string, chatId int) (lastReadChatId int, err error) {
+	if chatId == 0 {
+		if chatId, err = s.chatRepo.GetLastChatId(chatroomId); err != nil {
+			return
+		}
+	} else {
+		chat, err := s.chatRepo.GetChat(chatId)
+		if err != nil {
+			return 0, err
+		}
+		if chat.ChatroomID != chatroomId {
+			return 0, gorm.ErrRecordNotFound
+		}
+	}
+
+	if err = s.chatRepo.UpdateLastReadChatId(chatroomId, userId, chatId); err != nil {
+		return
+	}
+	return s.chatRepo.GetLastReadChatId(chatroomId, userId)
+}
+
+func (s *ChatServiceImpl) UpdateLastSeen(userId string, lastSeenAt time.Time) (err error) {
+	return s.chatRepo.UpdateLastSeen(userId, lastSeenAt)
+}
+
+// 사용자의 모든 채팅방에서 since 이후의 메시지를 size개까지 가져온다.
+// hasMore가 true이면 마지막 메시지의 ID를 since로 다시 요청한다.
+func (s *ChatServiceImpl) SyncChats(
+	userId string,
+	since int,
+	size int,
+) (chats []models.Chat, hasMore bool, err error) {
+	if size <= 0 {
+		size = DefaultSyncSize
+	}
+	if size > MaxSyncSize {
+		size = MaxSyncSize
+	}
+
+	chats, err = s.chatRepo.GetChatsSince(userId, since, size+1)
+	if err != nil {
+		return
+	}
+
+	if len(chats) > size {
+		chats = chats[:size]
+		hasMore = true
+	}
+	for i := range chats {
+		hideDeleted(&chats[i])
+	}
+	return
+}
+
+// 사용자가 참여 중인 채팅방의 메시지에서 keyword를 찾아 최근 메시지부터 size개씩 돌려준다.
+// 다음 페이지가 있으면 nextCursor로 이어서 요청한다.
+func (s *ChatServiceImpl) SearchChats(
+	userId string,
+	keyword string,
+	cursor string,
+	size int,
+) (results []models.ChatSearchResult, nextCursor string, err error) {
+	keyword = strings.TrimSpace(keyword)
+	if length := utf8.RuneCountInString(keyword); length < minKeywordLength || length > maxKeywordLength {
+		return nil, "", ErrInvalidKeyword
+	}
+	if size <= 0 {
+		size = DefaultSearchSize
+	}
+	if size > MaxSearchSize {
+		size = MaxSearchSize
+	}
+
+	before := 0
+	if cursor != "" {
+		if before, err = decodeSearchCursor(cursor); err != nil {
+			return
+		}
+	}
+
+	chats, err := s.chatRepo.SearchChats(userId, keyword, before, size+1)
+	if err != nil {
+		return
+	}
+	if len(chats) > size {
+		chats = chats[:size]
+		nextCursor = encodeSearchCursor(chats[size-1].ID)
+	}
+
+	chatroomIds := []int{}
+	seen := map[int]bool{}
+	for _, chat := range chats {
+		if !seen[chat.ChatroomID] {
+			seen[chat.ChatroomID] = true
+			chatroomIds = append(chatroomIds, chat.ChatroomID)
+		}
+	}
+
+	chatrooms, err := s.chatRepo.GetChatroomsByIds(chatroomIds, userId)
+	if err != nil {
+		return
+	}
+	byId := make(map[int]*models.Chatroom, len(chatrooms))
+	for i := range chatrooms {
+		hideDeleted(chatrooms[i].LastChat)
+		byId[chatrooms[i].ID] = &chatrooms[i]
+	}
+
+	results = make([]models.ChatSearchResult, len(chats))
+	for i, chat := range chats {
+		results[i] = models.ChatSearchResult{
+			Chat:       chat,
+			Chatroom:   byId[chat.ChatroomID],
+			Highlights: highlight(chat.Content, keyword),
+		}
+	}
+	return
+}
+
+func encodeSearchCursor(chatId int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(chatId)))
+}
+
+func decodeSearchCursor(cursor string) (int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, ErrInvalidCursor
+	}
+
+	chatId, err := strconv.Atoi(string(data))
+	if err != nil || chatId <= 0 {
+		return 0, ErrInvalidCursor
+	}
+	return chatId, nil
+}
+
+// content를 keyword와 대소문자 구분 없이 일치하는 조각과 나머지 조각으로 나눈다.
+// 내용이 길면 첫 번째 일치 앞뒤로 searchContextLength 글자만 남기고 잘린 곳에 "…"을 붙인다.
+// DB의 collation 때문에 일치하는 조각을 찾지 못하면 앞부분만 보여준다.
+func highlight(content, keyword string) (highlights []models.Highlight) {
+	text := []rune(content)
+	pattern := []rune(keyword)
+
+	matches := []int{}
+	for i := 0; i+len(pattern) <= len(text); {
+		if strings.EqualFold(string(text[i:i+len(pattern)]), keyword) {
+			matches = append(matches, i)
+			i += len(pattern)
+		} else {
+			i++
+		}
+	}
+
+	start, end := 0, len(text)
+	if len(matches) > 0 {
+		if matches[0] > searchContextLength {
+			start = matches[0] - searchContextLength
+		}
+		if last := matches[0] + len(pattern) + searchContextLength; last < end {
+			end = last
+		}
+	} else if end > 2*searchContextLength {
+		end = 2 * searchContextLength
+	}
+
+	highlights = []models.Highlight{}
+	appendText := func(from, to int, match bool) {
+		if from < to {
+			highlights = append(highlights, models.Highlight{Text: string(text[from:to]), Match: match})
+		}
+	}
+
+	if start > 0 {
+		highlights = append(highlights, models.Highlight{Text: "…"})
+	}
+	position := start
+	for _, match := range matches {
+		if match+len(pattern) > end {
+			break
+		}
+		appendText(position, match, false)
+		appendText(match, match+len(pattern), true)
+		position = match + len(pattern)
+	}
+	appendText(position, end, false)
+	if end < len(text) {
+		highlights = append(highlights, models.Highlight{Text: "…"})
+	}
+	return
+}
+
+// 보낸 사람이 수정 가능 시간 안에 TEXT 메시지의 내용을 바꾼다.
+func (s *ChatServiceImpl) EditChat(userId string, chatroomId, chatId int, content string) (chat *models.Chat, err error) {
+	if chat, err = s.getEditableChat(userId, chatroomId, chatId); err != nil {
+		return nil, err
+	}
+	if chat.Type != models.TEXT || strings.TrimSpace(content) == "" {
+		return nil, ErrInvalidChat
+	}
+	if utf8.RuneCountInString(content) > MaxChatLength {
+		return nil, ErrChatTooLong
+	}
+
+	editedAt := time.Now()
+	if err = s.chatRepo.UpdateChatContent(chatId, content, editedAt); err != nil {
+		return nil, err
+	}
+
+	chat.Content = content
+	chat.EditedAt = &editedAt
+	s.flagChat(userId, chat)
+	return
+}
+
+// 보낸 사람이 수정 가능 시간 안에 메시지를 취소한다. 돌려주는 메시지는 읽는 사람이 보는 모습이다.
+func (s *ChatServiceImpl) UnsendChat(userId string, chatroomId, chatId int) (chat *models.Chat, err error) {
+	if chat, err = s.getEditableChat(userId, chatroomId, chatId); err != nil {
+		return nil, err
+	}
+
+	deletedAt := time.Now()
+	if err = s.chatRepo.UnsendChat(chatId, deletedAt); err != nil {
+		return nil, err
+	}
+
+	chat.DeletedAt = &deletedAt
+	hideDeleted(chat)
+	return
+}
+
+func (s *ChatServiceImpl) getEditableChat(userId string, chatroomId, chatId int) (chat *models.Chat, err error) {
+	chat, err = s.chatRepo.GetChat(chatId)
+	if err != nil {
+		return
+	}
+
+	if chat.ChatroomID != chatroomId {
+		return nil, gorm.ErrRecordNotFound
+	}
+	if chat.ChatUserID != s.chatRepo.GetChatUserId(chat.ChatroomID, userId) {
+		return nil, ErrNotChatSender
+	}
+	if chat.DeletedAt != nil {
+		return nil, ErrChatDeleted
+	}
+	if time.Since(chat.SendDate) > editWindow() {
+		return nil, ErrEditWindowExpired
+	}
+	return
+}
+
+// 채팅방의 전체 대화 내용을 가져온다. withDeleted가 false이면 취소된 메시지의 내용을 가린다.
+func (s *ChatServiceImpl) GetTranscript(chatroomId int, withDeleted bool) (transcript *models.Transcript, err error) {
+	chatroom, err := s.chatRepo.GetTranscriptChatroom(chatroomId)
+	if err != nil {
+		return
+	}
+
+	chats, err := s.chatRepo.GetTranscriptChats(chatroomId)
+	if err != nil {
+		return
+	}
+	if !withDeleted {
+		for i := range chats {
+			hideDeleted(&chats[i])
+		}
+	}
+
+	transcript = &models.Transcript{
+		ChatroomID: chatroom.ID,
+		Product:    chatroom.Product,
+		Seller:     chatroom.Seller,
+		Buyer:      chatroom.Buyer,
+		Chats:      chats,
+		ExportedAt: time.Now(),
+	}
+	return
+}
+
+// 다른 사용자의 템플릿이면 gorm.ErrRecordNotFound를 돌려준다.
+func (s *ChatServiceImpl) GetReplyTemplate(userId string, templateId int) (template *models.ReplyTemplate, err error) {
+	return s.replyRepo.GetReplyTemplate(templateId, userId)
+}
+
+// 구매자가 만든 채팅방의 판매자가 자리 비움 모드이면 자동 응답을 판매자가 보낸 SYSTEM 메시지로 저장한다.
+// 자리 비움 모드가 꺼져 있으면 chat은 nil이다.
+func (s *ChatServiceImpl) CreateAwayReply(chatroomId int, buyerId string) (chat *models.Chat, err error) {
+	chatroom, err := s.chatRepo.GetChatroom(chatroomId, buyerId)
+	if err != nil {
+		return
+	}
+	sellerId := chatroom.Seller.UserID
+	if sellerId == buyerId {
+		return nil, nil
+	}
+
+	awayMode, err := s.replyRepo.GetAwayMode(sellerId)
+	if err != nil || !awayMode.Enabled || awayMode.Message == "" {
+		return nil, err
+	}
+
+	payload, err := json.Marshal(models.SystemPayload{Event: models.SystemEventAwayReply})
+	if err != nil {
+		return
+	}
+
+	chat = &models.Chat{
+		ChatroomID: chatroomId,
+		Type:       models.SYSTEM,
+		Content:    awayMode.Message,
+		Payload:    payload,
+	}
+	if _, err = s.InsertChat(sellerId, chat); err != nil {
+		return nil, err
+	}
+	return
+}
+
+func editWindow() time.Duration {
+	window, err := time.ParseDuration(os.Getenv("CHAT_EDIT_WINDOW"))
+	if err != nil || window <= 0 {
+		return defaultEditWindow
+	}
+	return window
+}
+
+// 취소된 메시지는 내용 대신 삭제 안내를 보여준다.
+func hideDeleted(chat *models.Chat) {
+	if chat == nil || chat.DeletedAt == nil {
+		return
+	}
+	chat.Content = models.DeletedChatContent
+	chat.Payload = nil
 }
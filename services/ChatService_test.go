@@ -0,0 +1,103 @@
+package services_test
+
+import (
+	"carrot-market-clone-api/models"
+	"carrot-market-clone-api/repositories"
+	"carrot-market-clone-api/services"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+// 상품 1에 대해 판매자 seller와 구매자 buyer가 참여하는 채팅방 1만 있는 ChatRepository
+type stubChatRepository struct {
+	repositories.ChatRepository
+	left  map[string]bool
+	chats []models.Chat
+}
+
+var chatUserIds = map[string]int{"seller": 1, "buyer": 2}
+
+func (r *stubChatRepository) GetChatroomId(productId int, buyerId string) int {
+	if productId == 1 && buyerId == "buyer" {
+		return 1
+	}
+	return 0
+}
+
+func (r *stubChatRepository) GetChatUserId(chatroomId int, userId string) int {
+	return chatUserIds[userId]
+}
+
+func (r *stubChatRepository) GetChatByClientMsgId(chatUserId int, clientMsgId string) (*models.Chat, error) {
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *stubChatRepository) CheckCounterpartLeft(userId string, chatroomId int) bool {
+	for id, left := range r.left {
+		if id != userId && left {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *stubChatRepository) InsertChat(chat *models.Chat) error {
+	chat.ID = len(r.chats) + 1
+	r.chats = append(r.chats, *chat)
+	return nil
+}
+
+func (r *stubChatRepository) InsertChatroom(productId int, buyerId string, chat *models.Chat) (*models.Chatroom, error) {
+	if chat != nil {
+		chat.ChatUserID = chatUserIds[buyerId]
+		r.InsertChat(chat)
+	}
+	return &models.Chatroom{ID: 1, ProductID: productId}, nil
+}
+
+func (r *stubChatRepository) GetChat(chatId int) (*models.Chat, error) {
+	chat := r.chats[chatId-1]
+	chat.ChatroomID = 1
+	return &chat, nil
+}
+
+type stubContentChecker struct{}
+
+func (c *stubContentChecker) Check(userId string, chat *models.Chat) ([]models.FlagReason, error) {
+	return nil, nil
+}
+
+// 상대방이 나간 채팅방에 보낸 메시지는 저장하지 않는다.
+func TestChatServiceCounterpartLeft(t *testing.T) {
+	tests := []struct {
+		name   string
+		left   string
+		sender string
+		err    error
+	}{
+		{name: "nobody left", sender: "buyer"},
+		{name: "seller left", left: "seller", sender: "buyer", err: services.ErrCounterpartLeft},
+		{name: "buyer left", left: "buyer", sender: "seller", err: services.ErrCounterpartLeft},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			chatRepo := &stubChatRepository{left: map[string]bool{test.left: test.left != ""}}
+			s := services.NewChatServiceImpl(chatRepo, nil, nil, &stubContentChecker{})
+
+			_, err := s.InsertChat(test.sender, &models.Chat{ChatroomID: 1, Content: "test content"})
+			assert.Equal(t, test.err, err)
+
+			if test.sender == "buyer" {
+				_, _, _, err = s.CreateChatroom(1, "buyer", &models.Chat{Content: "test first"})
+				assert.Equal(t, test.err, err)
+			}
+
+			if test.err != nil {
+				assert.Empty(t, chatRepo.chats)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package services
+
+import (
+	"carrot-market-clone-api/models"
+	"carrot-market-clone-api/repositories"
+	"carrot-market-clone-api/utils/spam"
+	"time"
+)
+
+// ContentChecker는 사용자가 보낸 메시지가 사기나 스팸으로 의심되면 그 이유를 돌려준다.
+// 메시지를 저장한 뒤에 검사하며, 메시지를 막지 않고 돌려준 이유를 저장해 메시지와 함께 전달한다.
+type ContentChecker interface {
+	Check(userId string, chat *models.Chat) (reasons []models.FlagReason, err error)
+}
+
+// 같은 메시지를 이만큼의 판매자에게 보냈으면 반복 메시지로 본다.
+const (
+	repeatedMessageSellers = 3
+	repeatedMessageWindow  = time.Hour
+)
+
+// 기본 검사 목록
+func NewContentChecker(chatRepo repositories.ChatRepository) ContentChecker {
+	return ContentCheckers{
+		&PatternChecker{},
+		&RepeatChecker{
+			chatRepo: chatRepo,
+			sellers:  repeatedMessageSellers,
+			window:   repeatedMessageWindow,
+		},
+	}
+}
+
+// 여러 ContentChecker의 결과를 합친다. 하나가 실패해도 나머지 결과는 돌려준다.
+type ContentCheckers []ContentChecker
+
+func (c ContentCheckers) Check(userId string, chat *models.Chat) (reasons []models.FlagReason, err error) {
+	for _, checker := range c {
+		found, checkErr := checker.Check(userId, chat)
+		if checkErr != nil {
+			err = checkErr
+		}
+		reasons = append(reasons, found...)
+	}
+	return
+}
+
+// TEXT 메시지에서 외부 메신저 아이디와 계좌번호를 찾는다.
+type PatternChecker struct{}
+
+func (c *PatternChecker) Check(userId string, chat *models.Chat) (reasons []models.FlagReason, err error) {
+	if chat.Type != models.TEXT {
+		return
+	}
+	if spam.ContainsMessengerID(chat.Content) {
+		reasons = append(reasons, models.FlagExternalMessenger)
+	}
+	if spam.ContainsBankAccount(chat.Content) {
+		reasons = append(reasons, models.FlagBankAccount)
+	}
+	return
+}
+
+// 구매자가 window 안에 똑같은 TEXT 메시지를 여러 판매자에게 보냈는지 확인한다.
+type RepeatChecker struct {
+	chatRepo repositories.ChatRepository
+	sellers  int
+	window   time.Duration
+}
+
+func (c *RepeatChecker) Check(userId string, chat *models.Chat) (reasons []models.FlagReason, err error) {
+	if chat.Type != models.TEXT {
+		return
+	}
+
+	count, err := c.chatRepo.CountSellersWithContent(userId, chat.Content, time.Now().Add(-c.window))
+	if err != nil {
+		return
+	}
+	if count >= c.sellers {
+		reasons = append(reasons, models.FlagRepeatedMessage)
+	}
+	return
+}
@@ -0,0 +1,49 @@
+package services
+
+import (
+	"carrot-market-clone-api/models"
+	"carrot-market-clone-api/repositories"
+	"errors"
+)
+
+var ErrInvalidDevice = errors.New("기기 토큰과 종류(IOS, ANDROID)를 올바르게 입력해주세요.")
+
+// FCM과 APNs 토큰은 이보다 길지 않다.
+const maxDeviceTokenLength = 4096
+
+type DeviceService interface {
+	RegisterDevice(userId string, sessionId string, device *models.Device) (err error)
+	GetDevices(userId string) (devices []models.Device, err error)
+	DeleteDevice(userId string, deviceId int) (err error)
+}
+
+type DeviceServiceImpl struct {
+	deviceRepo repositories.DeviceRepository
+}
+
+func NewDeviceServiceImpl(deviceRepo repositories.DeviceRepository) DeviceService {
+	return &DeviceServiceImpl{deviceRepo: deviceRepo}
+}
+
+// sessionId는 요청한 액세스 토큰의 로그인이며, 그 로그인에서 로그아웃하면 기기도 지워진다.
+func (s *DeviceServiceImpl) RegisterDevice(userId string, sessionId string, device *models.Device) (err error) {
+	if device.Token == "" || len(device.Token) > maxDeviceTokenLength {
+		return ErrInvalidDevice
+	}
+	if device.DeviceType != models.IOS && device.DeviceType != models.ANDROID {
+		return ErrInvalidDevice
+	}
+
+	device.ID = 0
+	device.UserID = userId
+	device.SessionID = sessionId
+	return s.deviceRepo.InsertDevice(device)
+}
+
+func (s *DeviceServiceImpl) GetDevices(userId string) (devices []models.Device, err error) {
+	return s.deviceRepo.GetDevices([]string{userId})
+}
+
+func (s *DeviceServiceImpl) DeleteDevice(userId string, deviceId int) (err error) {
+	return s.deviceRepo.DeleteDevice(deviceId, userId)
+}
@@ -0,0 +1,119 @@
+package services
+
+import (
+	"carrot-market-clone-api/models"
+	"carrot-market-clone-api/repositories"
+	"carrot-market-clone-api/utils/push"
+	"log"
+	"os"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+// PUSH_COLLAPSE_WINDOW가 없을 때 한 채팅방의 알림을 하나로 합치는 시간
+const defaultCollapseWindow = 3 * time.Second
+
+// 알림 본문은 이 글자 수까지만 보낸다.
+const maxNotificationBodyLength = 100
+
+type NotificationService interface {
+	NotifyChat(senderId string, userIds []string, chat *models.Chat)
+}
+
+type NotificationServiceImpl struct {
+	chatRepo   repositories.ChatRepository
+	userRepo   repositories.UserRepository
+	deviceRepo repositories.DeviceRepository
+	dispatcher *push.Dispatcher
+}
+
+// notifiers에 없는 플랫폼의 기기에는 알림을 보내지 않는다.
+func NewNotificationServiceImpl(
+	chatRepo repositories.ChatRepository,
+	userRepo repositories.UserRepository,
+	deviceRepo repositories.DeviceRepository,
+	notifiers push.Notifiers,
+) NotificationService {
+	prune := func(token string) {
+		if err := deviceRepo.DeleteDeviceByToken(token); err != nil {
+			log.Println(err)
+		}
+	}
+	return &NotificationServiceImpl{
+		chatRepo:   chatRepo,
+		userRepo:   userRepo,
+		deviceRepo: deviceRepo,
+		dispatcher: push.NewDispatcher(notifiers, collapseWindow(), prune),
+	}
+}
+
+// userIds 중 채팅방 알림을 끄지 않은 사용자의 모든 기기에 새 메시지를 알린다.
+// 같은 채팅방의 알림은 CollapseKey가 같으므로 기기에는 마지막 알림만 남는다.
+func (s *NotificationServiceImpl) NotifyChat(senderId string, userIds []string, chat *models.Chat) {
+	if chat.DeletedAt != nil || len(userIds) == 0 {
+		return
+	}
+
+	userIds, err := s.chatRepo.GetUnmutedUserIds(chat.ChatroomID, userIds)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	devices, err := s.deviceRepo.GetDevices(userIds)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	if len(devices) == 0 {
+		return
+	}
+
+	targets := make([]push.Target, len(devices))
+	for i, device := range devices {
+		targets[i] = push.Target{Platform: string(device.DeviceType), Token: device.Token}
+	}
+
+	title := ""
+	if sender, err := s.userRepo.GetUser("id", senderId); err == nil {
+		title = sender.Nickname
+	}
+
+	chatroomId := strconv.Itoa(chat.ChatroomID)
+	s.dispatcher.Dispatch(targets, push.Notification{
+		Title:       title,
+		Body:        notificationBody(chat),
+		CollapseKey: "chatroom-" + chatroomId,
+		Data: map[string]string{
+			"chatroomId": chatroomId,
+			"chatId":     strconv.Itoa(chat.ID),
+		},
+	})
+}
+
+func notificationBody(chat *models.Chat) string {
+	body := chat.Content
+	switch chat.Type {
+	case models.IMAGE:
+		body = "사진을 보냈습니다."
+	case models.LOCATION:
+		if body == "" {
+			body = "위치를 보냈습니다."
+		}
+	}
+
+	if utf8.RuneCountInString(body) > maxNotificationBodyLength {
+		body = string([]rune(body)[:maxNotificationBodyLength]) + "…"
+	}
+	return body
+}
+
+// 0s로 설정하면 알림을 합치지 않는다.
+func collapseWindow() time.Duration {
+	window, err := time.ParseDuration(os.Getenv("PUSH_COLLAPSE_WINDOW"))
+	if err != nil || window < 0 {
+		return defaultCollapseWindow
+	}
+	return window
+}
@@ -0,0 +1,120 @@
+package services
+
+import (
+	"carrot-market-clone-api/models"
+	"carrot-market-clone-api/repositories"
+	"errors"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	ErrInvalidReply          = errors.New("답장 내용은 1자 이상 500자 이하여야 합니다.")
+	ErrTooManyReplyTemplates = errors.New("자주 쓰는 답장은 20개까지 저장할 수 있습니다.")
+)
+
+const (
+	maxReplyTemplates     = 20
+	maxReplyContentLength = 500
+)
+
+type ReplyService interface {
+	GetReplyTemplates(userId string) (templates []models.ReplyTemplate, err error)
+	InsertReplyTemplate(userId string, content string) (template *models.ReplyTemplate, err error)
+	UpdateReplyTemplate(userId string, templateId int, content string) (template *models.ReplyTemplate, err error)
+	DeleteReplyTemplate(userId string, templateId int) (err error)
+	GetAwayMode(userId string) (awayMode *models.AwayMode, err error)
+	UpdateAwayMode(userId string, enabled bool, message string) (awayMode *models.AwayMode, err error)
+}
+
+type ReplyServiceImpl struct {
+	replyRepo repositories.ReplyRepository
+}
+
+func NewReplyServiceImpl(replyRepo repositories.ReplyRepository) ReplyService {
+	return &ReplyServiceImpl{replyRepo: replyRepo}
+}
+
+func (s *ReplyServiceImpl) GetReplyTemplates(userId string) (templates []models.ReplyTemplate, err error) {
+	return s.replyRepo.GetReplyTemplates(userId)
+}
+
+func (s *ReplyServiceImpl) InsertReplyTemplate(userId string, content string) (template *models.ReplyTemplate, err error) {
+	if !validReply(content) {
+		return nil, ErrInvalidReply
+	}
+
+	count, err := s.replyRepo.CountReplyTemplates(userId)
+	if err != nil {
+		return
+	}
+	if count >= maxReplyTemplates {
+		return nil, ErrTooManyReplyTemplates
+	}
+
+	template = &models.ReplyTemplate{UserID: userId, Content: content}
+	if err = s.replyRepo.InsertReplyTemplate(template); err != nil {
+		return nil, err
+	}
+	return s.replyRepo.GetReplyTemplate(template.ID, userId)
+}
+
+// 다른 사용자의 템플릿이면 gorm.ErrRecordNotFound를 돌려준다.
+func (s *ReplyServiceImpl) UpdateReplyTemplate(
+	userId string,
+	templateId int,
+	content string,
+) (template *models.ReplyTemplate, err error) {
+	if !validReply(content) {
+		return nil, ErrInvalidReply
+	}
+
+	if template, err = s.replyRepo.GetReplyTemplate(templateId, userId); err != nil {
+		return
+	}
+
+	template.Content = content
+	if err = s.replyRepo.UpdateReplyTemplate(template); err != nil {
+		return nil, err
+	}
+	return
+}
+
+func (s *ReplyServiceImpl) DeleteReplyTemplate(userId string, templateId int) (err error) {
+	return s.replyRepo.DeleteReplyTemplate(templateId, userId)
+}
+
+func (s *ReplyServiceImpl) GetAwayMode(userId string) (awayMode *models.AwayMode, err error) {
+	return s.replyRepo.GetAwayMode(userId)
+}
+
+// message가 비어 있으면 저장된 자동 응답 메시지를 그대로 쓴다. 켤 때는 자동 응답 메시지가 있어야 한다.
+func (s *ReplyServiceImpl) UpdateAwayMode(
+	userId string,
+	enabled bool,
+	message string,
+) (awayMode *models.AwayMode, err error) {
+	if awayMode, err = s.replyRepo.GetAwayMode(userId); err != nil {
+		return
+	}
+
+	if message != "" {
+		if !validReply(message) {
+			return nil, ErrInvalidReply
+		}
+		awayMode.Message = message
+	}
+	if enabled && awayMode.Message == "" {
+		return nil, ErrInvalidReply
+	}
+	awayMode.Enabled = enabled
+
+	if err = s.replyRepo.UpsertAwayMode(awayMode); err != nil {
+		return nil, err
+	}
+	return
+}
+
+func validReply(content string) bool {
+	return strings.TrimSpace(content) != "" && utf8.RuneCountInString(content) <= maxReplyContentLength
+}
@@ -5,6 +5,7 @@ import (
 	"carrot-market-clone-api/repositories"
 	"carrot-market-clone-api/utils/encryption"
 	"fmt"
+	"log"
 	"mime/multipart"
 	"os"
 	"regexp"
@@ -36,20 +37,23 @@ type UserService interface {
 }
 
 type UserServiceImpl struct {
-	userRepo   repositories.UserRepository
-	awsService AWSService
-	client     *s3.Client
+	userRepo       repositories.UserRepository
+	awsService     AWSService
+	passwordHasher encryption.PasswordHasher
+	client         *s3.Client
 }
 
 func NewUserServiceImpl(
 	userRepo repositories.UserRepository,
 	awsService AWSService,
+	passwordHasher encryption.PasswordHasher,
 	client *s3.Client,
 ) UserService {
 	return &UserServiceImpl{
-		userRepo:   userRepo,
-		awsService: awsService,
-		client:     client,
+		userRepo:       userRepo,
+		awsService:     awsService,
+		passwordHasher: passwordHasher,
+		client:         client,
 	}
 }
 
@@ -67,7 +71,24 @@ func (s *UserServiceImpl) Login(user *models.User) (ok bool, err error) {
 	if err != nil {
 		return false, err
 	}
-	return encryption.EncryptSHA256(insertedPassword) == userDetail.PW, nil
+
+	ok, err = s.passwordHasher.Verify(insertedPassword, userDetail.PW)
+	if err != nil || !ok {
+		return
+	}
+
+	// 이전 형식의 해시는 로그인에 성공했을 때 현재 형식으로 교체한다.
+	if s.passwordHasher.NeedsRehash(userDetail.PW) {
+		encoded, err := s.passwordHasher.Hash(insertedPassword)
+		if err == nil {
+			err = s.userRepo.UpdateUser(&models.User{ID: userDetail.ID, PW: encoded})
+		}
+		if err != nil {
+			log.Println(err)
+		}
+	}
+
+	return true, nil
 }
 
 // Validate Admin PW. If valid, it returns nil.
@@ -165,7 +186,10 @@ func (s *UserServiceImpl) Register(
 		url := fmt.Sprintf("https://%s/images/default_profile_image", os.Getenv("AWS_S3_DOMAIN"))
 		user.ProfileImage = url
 		user.ID = uuid.NewString()
-		user.PW = encryption.EncryptSHA256(user.PW)
+		user.PW, err = s.passwordHasher.Hash(user.PW)
+		if err != nil {
+			return nil, err
+		}
 		err = s.userRepo.InsertUser(user)
 
 		if err != nil {
@@ -183,8 +207,10 @@ func (s *UserServiceImpl) Register(
 		user.ProfileImage = url
 
 		user.ID = uuid.NewString()
-		user.PW = encryption.EncryptSHA256(user.PW)
-		err = s.userRepo.InsertUser(user)
+		user.PW, err = s.passwordHasher.Hash(user.PW)
+		if err == nil {
+			err = s.userRepo.InsertUser(user)
+		}
 
 		if err != nil {
 			if err := s.awsService.DeleteFile(filename); err != nil {
@@ -212,6 +238,11 @@ func (s *UserServiceImpl) Update(
 		return
 	}
 
+	user.PW, err = s.passwordHasher.Hash(user.PW)
+	if err != nil {
+		return
+	}
+
 	filename, err := s.awsService.UploadFile(file)
 	if err != nil {
 		return
@@ -0,0 +1,73 @@
+package encryption
+
+import "errors"
+
+var ErrUnknownHashFormat = errors.New("unknown password hash format")
+
+type PasswordHasher interface {
+	// 비밀번호를 알고리즘과 파라미터가 포함된 문자열로 인코딩한다.
+	Hash(password string) (encoded string, err error)
+
+	// 저장된 해시와 비밀번호를 상수 시간으로 비교한다.
+	Verify(password, encoded string) (ok bool, err error)
+
+	// 저장된 해시를 현재 설정으로 다시 만들어야 하는지 여부
+	NeedsRehash(encoded string) bool
+
+	// 해시 문자열이 이 알고리즘의 형식인지 여부
+	Identify(encoded string) bool
+}
+
+type MultiPasswordHasher struct {
+	primary PasswordHasher
+	legacy  []PasswordHasher
+}
+
+// 새 해시는 primary로 만들고, 기존 해시는 형식에 맞는 해셔로 검증한다.
+// primary가 아닌 형식으로 저장된 해시는 항상 NeedsRehash가 true이다.
+func NewMultiPasswordHasher(primary PasswordHasher, legacy ...PasswordHasher) PasswordHasher {
+	return &MultiPasswordHasher{primary: primary, legacy: legacy}
+}
+
+func NewPasswordHasher() PasswordHasher {
+	return NewMultiPasswordHasher(
+		NewArgon2idHasher(DefaultArgon2idParams),
+		NewBcryptHasher(DefaultBcryptCost),
+		&SHA256Hasher{},
+	)
+}
+
+func (h *MultiPasswordHasher) Hash(password string) (string, error) {
+	return h.primary.Hash(password)
+}
+
+func (h *MultiPasswordHasher) Verify(password, encoded string) (bool, error) {
+	hasher := h.find(encoded)
+	if hasher == nil {
+		return false, ErrUnknownHashFormat
+	}
+	return hasher.Verify(password, encoded)
+}
+
+func (h *MultiPasswordHasher) NeedsRehash(encoded string) bool {
+	if h.primary.Identify(encoded) {
+		return h.primary.NeedsRehash(encoded)
+	}
+	return true
+}
+
+func (h *MultiPasswordHasher) Identify(encoded string) bool {
+	return h.find(encoded) != nil
+}
+
+func (h *MultiPasswordHasher) find(encoded string) PasswordHasher {
+	if h.primary.Identify(encoded) {
+		return h.primary
+	}
+	for _, hasher := range h.legacy {
+		if hasher.Identify(encoded) {
+			return hasher
+		}
+	}
+	return nil
+}
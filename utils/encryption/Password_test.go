@@ -0,0 +1,65 @@
+package encryption_test
+
+import (
+	"strings"
+	"testing"
+
+	"carrot-market-clone-api/utils/encryption"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPasswordHasher(t *testing.T) {
+	hasher := encryption.NewPasswordHasher()
+	password := "Test1234!"
+
+	// hash & verify
+	encoded, err := hasher.Hash(password)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(encoded, "$argon2id$v=19$m=65536,t=3,p=2$"))
+	assert.False(t, hasher.NeedsRehash(encoded))
+
+	ok, err := hasher.Verify(password, encoded)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = hasher.Verify("wrong password", encoded)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	// salted
+	other, err := hasher.Hash(password)
+	assert.NoError(t, err)
+	assert.NotEqual(t, encoded, other)
+
+	// legacy hashes
+	bcryptHash, err := encryption.NewBcryptHasher(4).Hash(password)
+	assert.NoError(t, err)
+
+	for _, legacy := range []string{encryption.EncryptSHA256(password), bcryptHash} {
+		ok, err := hasher.Verify(password, legacy)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.True(t, hasher.NeedsRehash(legacy))
+
+		ok, err = hasher.Verify("wrong password", legacy)
+		assert.NoError(t, err)
+		assert.False(t, ok)
+	}
+
+	// parameter change
+	weaker := encryption.NewArgon2idHasher(encryption.Argon2idParams{
+		Memory: 8 * 1024, Time: 1, Threads: 1, SaltLen: 16, KeyLen: 32,
+	})
+	weakHash, err := weaker.Hash(password)
+	assert.NoError(t, err)
+	assert.True(t, hasher.NeedsRehash(weakHash))
+
+	ok, err = hasher.Verify(password, weakHash)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	// unknown format
+	_, err = hasher.Verify(password, "plain text")
+	assert.Equal(t, encryption.ErrUnknownHashFormat, err)
+}
@@ -2,6 +2,7 @@ package encryption
 
 import (
     "crypto/sha256"
+    "crypto/subtle"
     "encoding/hex"
 )
 
@@ -12,3 +13,27 @@ func EncryptSHA256(str string) string {
     mdStr := hex.EncodeToString(md)
     return mdStr
 }
+
+// 솔트 없는 SHA-256 해시. 기존 비밀번호 검증용으로만 사용한다.
+type SHA256Hasher struct{}
+
+func (h *SHA256Hasher) Hash(password string) (string, error) {
+    return EncryptSHA256(password), nil
+}
+
+func (h *SHA256Hasher) Verify(password, encoded string) (bool, error) {
+    hashed := EncryptSHA256(password)
+    return subtle.ConstantTimeCompare([]byte(hashed), []byte(encoded)) == 1, nil
+}
+
+func (h *SHA256Hasher) NeedsRehash(encoded string) bool {
+    return true
+}
+
+func (h *SHA256Hasher) Identify(encoded string) bool {
+    if len(encoded) != sha256.Size * 2 {
+        return false
+    }
+    _, err := hex.DecodeString(encoded)
+    return err == nil
+}
@@ -0,0 +1,156 @@
+package push
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+const DefaultAPNsEndpoint = "https://api.push.apple.com"
+
+// APNs는 한 시간이 지난 인증 토큰을 거부하고 20분보다 자주 바꾸는 것도 막으므로 그 사이에 갱신한다.
+const apnsTokenLifetime = 50 * time.Minute
+
+// APNsNotifier는 토큰 기반 인증(.p8 키)으로 APNs에 iOS 알림을 보낸다.
+type APNsNotifier struct {
+	endpoint string
+	topic    string
+	keyId    string
+	teamId   string
+	key      *ecdsa.PrivateKey
+	client   *http.Client
+
+	mutex    sync.Mutex
+	token    string
+	issuedAt time.Time
+}
+
+// topic은 앱의 번들 ID이고 privateKey는 Apple 개발자 계정에서 받은 PEM 형식의 키이다.
+func NewAPNsNotifier(endpoint, topic, keyId, teamId string, privateKey []byte) (*APNsNotifier, error) {
+	key, err := jwt.ParseECPrivateKeyFromPEM(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	if endpoint == "" {
+		endpoint = DefaultAPNsEndpoint
+	}
+	return &APNsNotifier{
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		topic:    topic,
+		keyId:    keyId,
+		teamId:   teamId,
+		key:      key,
+		client:   newHTTPClient(),
+	}, nil
+}
+
+type apnsPayload struct {
+	APS  apnsAPS           `json:"aps"`
+	Data map[string]string `json:"data,omitempty"`
+}
+
+type apnsAPS struct {
+	Alert    apnsAlert `json:"alert"`
+	Sound    string    `json:"sound"`
+	ThreadID string    `json:"thread-id,omitempty"`
+}
+
+type apnsAlert struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+}
+
+type apnsErrorResponse struct {
+	Reason string `json:"reason"`
+}
+
+func (n *APNsNotifier) Send(notification Notification) error {
+	authToken, err := n.authToken()
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(apnsPayload{
+		APS: apnsAPS{
+			Alert:    apnsAlert{Title: notification.Title, Body: notification.Body},
+			Sound:    "default",
+			ThreadID: notification.CollapseKey,
+		},
+		Data: notification.Data,
+	})
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequest(http.MethodPost, n.endpoint+"/3/device/"+notification.Token, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Authorization", "bearer "+authToken)
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("apns-topic", n.topic)
+	request.Header.Set("apns-push-type", "alert")
+	request.Header.Set("apns-priority", "10")
+	if notification.CollapseKey != "" {
+		request.Header.Set("apns-collapse-id", notification.CollapseKey)
+	}
+
+	response, err := n.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	result := apnsErrorResponse{}
+	json.NewDecoder(response.Body).Decode(&result)
+	switch result.Reason {
+	case "BadDeviceToken", "Unregistered", "DeviceTokenNotForTopic":
+		return ErrInvalidToken
+	case "ExpiredProviderToken", "InvalidProviderToken":
+		n.resetAuthToken()
+	}
+	if response.StatusCode == http.StatusGone {
+		return ErrInvalidToken
+	}
+	return &StatusError{StatusCode: response.StatusCode, Reason: result.Reason}
+}
+
+func (n *APNsNotifier) authToken() (string, error) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	now := time.Now()
+	if n.token != "" && now.Sub(n.issuedAt) < apnsTokenLifetime {
+		return n.token, nil
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"iss": n.teamId,
+		"iat": now.Unix(),
+	})
+	token.Header["kid"] = n.keyId
+
+	signed, err := token.SignedString(n.key)
+	if err != nil {
+		return "", err
+	}
+	n.token = signed
+	n.issuedAt = now
+	return signed, nil
+}
+
+func (n *APNsNotifier) resetAuthToken() {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.token = ""
+}
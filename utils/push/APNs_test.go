@@ -0,0 +1,119 @@
+package push
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/stretchr/testify/assert"
+)
+
+type apnsRequest struct {
+	token   string
+	header  http.Header
+	payload apnsPayload
+}
+
+// fakeAPNs는 인증 토큰을 검증하고 "bad"와 "gone" 토큰을 거부하는 APNs 서버이다.
+func newFakeAPNs(t *testing.T, key *ecdsa.PrivateKey, requests chan<- apnsRequest) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authToken := strings.TrimPrefix(r.Header.Get("Authorization"), "bearer ")
+		token, err := jwt.Parse(authToken, func(token *jwt.Token) (interface{}, error) {
+			assert.Equal(t, "key-id", token.Header["kid"])
+			return &key.PublicKey, nil
+		})
+		if err != nil || token.Claims.(jwt.MapClaims)["iss"] != "team-id" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"reason":"InvalidProviderToken"}`))
+			return
+		}
+
+		request := apnsRequest{token: strings.TrimPrefix(r.URL.Path, "/3/device/"), header: r.Header}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&request.payload))
+		requests <- request
+
+		switch request.token {
+		case "bad":
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"reason":"BadDeviceToken"}`))
+		case "gone":
+			w.WriteHeader(http.StatusGone)
+			w.Write([]byte(`{"reason":"Unregistered","timestamp":1650000000000}`))
+		case "busy":
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"reason":"TooManyRequests"}`))
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newTestKey(t *testing.T) (*ecdsa.PrivateKey, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	assert.NoError(t, err)
+	return key, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+func TestAPNsNotifier(t *testing.T) {
+	key, keyPEM := newTestKey(t)
+	requests := make(chan apnsRequest, 10)
+	server := newFakeAPNs(t, key, requests)
+
+	n, err := NewAPNsNotifier(server.URL, "com.example.carrot", "key-id", "team-id", keyPEM)
+	assert.NoError(t, err)
+
+	notification := Notification{
+		Token:       "device",
+		Title:       "당근",
+		Body:        "안녕하세요",
+		CollapseKey: "chatroom-1",
+		Data:        map[string]string{"chatroomId": "1"},
+	}
+	assert.NoError(t, n.Send(notification))
+
+	request := <-requests
+	assert.Equal(t, "device", request.token)
+	assert.Equal(t, "com.example.carrot", request.header.Get("apns-topic"))
+	assert.Equal(t, "alert", request.header.Get("apns-push-type"))
+	assert.Equal(t, "chatroom-1", request.header.Get("apns-collapse-id"))
+	assert.Equal(t, "당근", request.payload.APS.Alert.Title)
+	assert.Equal(t, "안녕하세요", request.payload.APS.Alert.Body)
+	assert.Equal(t, "chatroom-1", request.payload.APS.ThreadID)
+	assert.Equal(t, "1", request.payload.Data["chatroomId"])
+
+	// 인증 토큰은 다시 만들지 않고 재사용한다.
+	authToken := request.header.Get("Authorization")
+	assert.NoError(t, n.Send(notification))
+	assert.Equal(t, authToken, (<-requests).header.Get("Authorization"))
+
+	for _, token := range []string{"bad", "gone"} {
+		notification.Token = token
+		assert.Equal(t, ErrInvalidToken, n.Send(notification))
+		<-requests
+	}
+
+	notification.Token = "busy"
+	err = n.Send(notification)
+	<-requests
+	assert.Equal(t, &StatusError{StatusCode: 429, Reason: "TooManyRequests"}, err)
+
+	// 다른 키로 서명한 인증 토큰은 거부되지만 기기 토큰 문제는 아니다.
+	_, otherPEM := newTestKey(t)
+	n, err = NewAPNsNotifier(server.URL, "com.example.carrot", "key-id", "team-id", otherPEM)
+	assert.NoError(t, err)
+	err = n.Send(notification)
+	assert.Equal(t, &StatusError{StatusCode: 403, Reason: "InvalidProviderToken"}, err)
+
+	_, err = NewAPNsNotifier(server.URL, "com.example.carrot", "key-id", "team-id", []byte("not a key"))
+	assert.Error(t, err)
+}
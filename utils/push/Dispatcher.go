@@ -0,0 +1,101 @@
+package push
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// 알림을 받을 기기
+type Target struct {
+	Platform string
+	Token    string
+}
+
+// Dispatcher는 기기의 플랫폼에 맞는 Notifier로 알림을 보낸다.
+// 한 기기에 CollapseKey가 같은 알림을 보낸 뒤 window 동안 들어온 알림은 바로 보내지 않고,
+// window가 끝날 때 그중 마지막 알림 하나만 보낸다.
+// Notifier가 ErrInvalidToken을 돌려주면 prune으로 토큰을 지운다.
+type Dispatcher struct {
+	notifiers Notifiers
+	window    time.Duration
+	prune     func(token string)
+
+	mutex   sync.Mutex
+	pending map[string]*pending
+}
+
+// window 동안 기다리는 알림. next가 nil이면 window가 끝날 때 보낼 알림이 없다.
+type pending struct {
+	platform string
+	next     *Notification
+}
+
+func NewDispatcher(notifiers Notifiers, window time.Duration, prune func(token string)) *Dispatcher {
+	return &Dispatcher{
+		notifiers: notifiers,
+		window:    window,
+		prune:     prune,
+		pending:   make(map[string]*pending),
+	}
+}
+
+// 알림은 다른 고루틴에서 보내므로 바로 돌아온다.
+func (d *Dispatcher) Dispatch(targets []Target, notification Notification) {
+	for _, target := range targets {
+		n := notification
+		n.Token = target.Token
+
+		if d.window <= 0 {
+			go d.send(target.Platform, n)
+			continue
+		}
+
+		key := n.Token + "\x00" + n.CollapseKey
+		d.mutex.Lock()
+		if p, ok := d.pending[key]; ok {
+			p.next = &n
+			d.mutex.Unlock()
+			continue
+		}
+		d.pending[key] = &pending{platform: target.Platform}
+		d.mutex.Unlock()
+
+		time.AfterFunc(d.window, func() { d.flush(key) })
+		go d.send(target.Platform, n)
+	}
+}
+
+func (d *Dispatcher) flush(key string) {
+	d.mutex.Lock()
+	p := d.pending[key]
+	if p.next == nil {
+		delete(d.pending, key)
+		d.mutex.Unlock()
+		return
+	}
+	n := *p.next
+	p.next = nil
+	d.mutex.Unlock()
+
+	time.AfterFunc(d.window, func() { d.flush(key) })
+	d.send(p.platform, n)
+}
+
+func (d *Dispatcher) send(platform string, notification Notification) {
+	notifier, ok := d.notifiers[platform]
+	if !ok {
+		return
+	}
+
+	err := notifier.Send(notification)
+	if err == ErrInvalidToken {
+		if d.prune != nil {
+			d.prune(notification.Token)
+		}
+		return
+	}
+	if err != nil {
+		log.Println(err)
+	}
+}
@@ -0,0 +1,118 @@
+package push
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeNotifier struct {
+	sent    chan Notification
+	invalid map[string]bool
+}
+
+func newFakeNotifier(invalid ...string) *fakeNotifier {
+	n := &fakeNotifier{sent: make(chan Notification, 10), invalid: make(map[string]bool)}
+	for _, token := range invalid {
+		n.invalid[token] = true
+	}
+	return n
+}
+
+func (n *fakeNotifier) Send(notification Notification) error {
+	n.sent <- notification
+	if n.invalid[notification.Token] {
+		return ErrInvalidToken
+	}
+	return nil
+}
+
+func receiveNotification(t *testing.T, n *fakeNotifier) Notification {
+	t.Helper()
+	select {
+	case notification := <-n.sent:
+		return notification
+	case <-time.After(time.Second):
+		t.Fatal("notification was not sent")
+		return Notification{}
+	}
+}
+
+func assertNoNotification(t *testing.T, n *fakeNotifier, wait time.Duration) {
+	t.Helper()
+	select {
+	case notification := <-n.sent:
+		t.Fatalf("unexpected notification %+v", notification)
+	case <-time.After(wait):
+	}
+}
+
+func TestDispatcherPlatforms(t *testing.T) {
+	ios, android := newFakeNotifier(), newFakeNotifier()
+	d := NewDispatcher(Notifiers{PlatformIOS: ios, PlatformAndroid: android}, 0, nil)
+
+	d.Dispatch([]Target{
+		{Platform: PlatformIOS, Token: "iphone"},
+		{Platform: PlatformAndroid, Token: "galaxy"},
+		{Platform: "WEB", Token: "browser"},
+	}, Notification{Body: "hello", CollapseKey: "chatroom-1"})
+
+	assert.Equal(t, Notification{Token: "iphone", Body: "hello", CollapseKey: "chatroom-1"}, receiveNotification(t, ios))
+	assert.Equal(t, Notification{Token: "galaxy", Body: "hello", CollapseKey: "chatroom-1"}, receiveNotification(t, android))
+}
+
+// window 안에 같은 채팅방에서 온 알림은 마지막 하나만 보낸다.
+func TestDispatcherCollapse(t *testing.T) {
+	window := 100 * time.Millisecond
+	n := newFakeNotifier()
+	d := NewDispatcher(Notifiers{PlatformAndroid: n}, window, nil)
+	target := []Target{{Platform: PlatformAndroid, Token: "galaxy"}}
+
+	d.Dispatch(target, Notification{Body: "first", CollapseKey: "chatroom-1"})
+	assert.Equal(t, "first", receiveNotification(t, n).Body)
+
+	d.Dispatch(target, Notification{Body: "second", CollapseKey: "chatroom-1"})
+	d.Dispatch(target, Notification{Body: "third", CollapseKey: "chatroom-1"})
+	// 다른 채팅방의 알림은 따로 보낸다.
+	d.Dispatch(target, Notification{Body: "other room", CollapseKey: "chatroom-2"})
+	assert.Equal(t, "other room", receiveNotification(t, n).Body)
+	assertNoNotification(t, n, window/2)
+
+	assert.Equal(t, "third", receiveNotification(t, n).Body)
+
+	// 보낼 알림 없이 window가 지나면 다음 알림은 바로 보낸다.
+	time.Sleep(3 * window)
+	d.mutex.Lock()
+	assert.Len(t, d.pending, 0)
+	d.mutex.Unlock()
+
+	d.Dispatch(target, Notification{Body: "later", CollapseKey: "chatroom-1"})
+	assert.Equal(t, "later", receiveNotification(t, n).Body)
+}
+
+func TestDispatcherPrune(t *testing.T) {
+	n := newFakeNotifier("expired")
+
+	var mutex sync.Mutex
+	pruned := []string{}
+	d := NewDispatcher(Notifiers{PlatformIOS: n}, 0, func(token string) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		pruned = append(pruned, token)
+	})
+
+	d.Dispatch([]Target{
+		{Platform: PlatformIOS, Token: "expired"},
+		{Platform: PlatformIOS, Token: "valid"},
+	}, Notification{Body: "hello"})
+	receiveNotification(t, n)
+	receiveNotification(t, n)
+
+	assert.Eventually(t, func() bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return len(pruned) == 1 && pruned[0] == "expired"
+	}, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,116 @@
+package push
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+const DefaultFCMEndpoint = "https://fcm.googleapis.com"
+
+// FCMNotifier는 FCM HTTP v1 API로 안드로이드 기기에 알림을 보낸다.
+// tokenSource는 요청마다 유효한 OAuth 액세스 토큰을 돌려주며, 보통 ServiceAccountTokenSource.Token을 쓴다.
+type FCMNotifier struct {
+	endpoint    string
+	projectId   string
+	tokenSource func() (string, error)
+	client      *http.Client
+}
+
+func NewFCMNotifier(endpoint, projectId string, tokenSource func() (string, error)) *FCMNotifier {
+	if endpoint == "" {
+		endpoint = DefaultFCMEndpoint
+	}
+	return &FCMNotifier{
+		endpoint:    strings.TrimSuffix(endpoint, "/"),
+		projectId:   projectId,
+		tokenSource: tokenSource,
+		client:      newHTTPClient(),
+	}
+}
+
+type fcmRequest struct {
+	Message fcmMessage `json:"message"`
+}
+
+type fcmMessage struct {
+	Token        string            `json:"token"`
+	Notification fcmNotification   `json:"notification"`
+	Data         map[string]string `json:"data,omitempty"`
+	Android      fcmAndroid        `json:"android"`
+}
+
+type fcmNotification struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+}
+
+type fcmAndroid struct {
+	CollapseKey  string             `json:"collapse_key,omitempty"`
+	Notification fcmAndroidSettings `json:"notification"`
+}
+
+// tag가 같은 알림은 알림 창에서 새 알림으로 바뀐다.
+type fcmAndroidSettings struct {
+	Tag string `json:"tag,omitempty"`
+}
+
+type fcmErrorResponse struct {
+	Error struct {
+		Status  string `json:"status"`
+		Message string `json:"message"`
+		Details []struct {
+			ErrorCode string `json:"errorCode"`
+		} `json:"details"`
+	} `json:"error"`
+}
+
+func (n *FCMNotifier) Send(notification Notification) error {
+	accessToken, err := n.tokenSource()
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(fcmRequest{Message: fcmMessage{
+		Token:        notification.Token,
+		Notification: fcmNotification{Title: notification.Title, Body: notification.Body},
+		Data:         notification.Data,
+		Android: fcmAndroid{
+			CollapseKey:  notification.CollapseKey,
+			Notification: fcmAndroidSettings{Tag: notification.CollapseKey},
+		},
+	}})
+	if err != nil {
+		return err
+	}
+
+	url := n.endpoint + "/v1/projects/" + n.projectId + "/messages:send"
+	request, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Authorization", "Bearer "+accessToken)
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := n.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	// 프로젝트 ID나 엔드포인트가 잘못되어도 404가 오므로 상태 코드만으로는 토큰을 지우지 않는다.
+	result := fcmErrorResponse{}
+	json.NewDecoder(response.Body).Decode(&result)
+	for _, detail := range result.Error.Details {
+		// 앱이 삭제되었거나 다른 프로젝트에서 발급된 토큰
+		if detail.ErrorCode == "UNREGISTERED" || detail.ErrorCode == "SENDER_ID_MISMATCH" {
+			return ErrInvalidToken
+		}
+	}
+	return &StatusError{StatusCode: response.StatusCode, Reason: result.Error.Status}
+}
@@ -0,0 +1,87 @@
+package push
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeFCM은 "expired" 토큰만 등록 해제된 것으로 보는 FCM HTTP v1 서버이며, carrot 프로젝트만 있다.
+func newFakeFCM(t *testing.T, requests chan<- fcmRequest) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/projects/carrot/messages:send" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":{"code":404,"status":"NOT_FOUND"}}`))
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer access-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":{"code":401,"status":"UNAUTHENTICATED"}}`))
+			return
+		}
+
+		request := fcmRequest{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+		requests <- request
+
+		switch request.Message.Token {
+		case "expired":
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":{"code":404,"status":"NOT_FOUND","details":[{"errorCode":"UNREGISTERED"}]}}`))
+		case "unavailable":
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"error":{"code":503,"status":"UNAVAILABLE"}}`))
+		default:
+			w.Write([]byte(`{"name":"projects/carrot/messages/1"}`))
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestFCMNotifier(t *testing.T) {
+	requests := make(chan fcmRequest, 10)
+	server := newFakeFCM(t, requests)
+	n := NewFCMNotifier(server.URL+"/", "carrot", func() (string, error) { return "access-token", nil })
+
+	notification := Notification{
+		Token:       "device",
+		Title:       "당근",
+		Body:        "안녕하세요",
+		CollapseKey: "chatroom-1",
+		Data:        map[string]string{"chatroomId": "1"},
+	}
+	assert.NoError(t, n.Send(notification))
+
+	request := <-requests
+	assert.Equal(t, "device", request.Message.Token)
+	assert.Equal(t, "당근", request.Message.Notification.Title)
+	assert.Equal(t, "안녕하세요", request.Message.Notification.Body)
+	assert.Equal(t, "chatroom-1", request.Message.Android.CollapseKey)
+	assert.Equal(t, "chatroom-1", request.Message.Android.Notification.Tag)
+	assert.Equal(t, "1", request.Message.Data["chatroomId"])
+
+	notification.Token = "expired"
+	assert.Equal(t, ErrInvalidToken, n.Send(notification))
+	<-requests
+
+	notification.Token = "unavailable"
+	err := n.Send(notification)
+	<-requests
+	assert.Equal(t, &StatusError{StatusCode: 503, Reason: "UNAVAILABLE"}, err)
+
+	// 프로젝트를 찾지 못한 404는 토큰 문제가 아니다.
+	n = NewFCMNotifier(server.URL, "unknown", func() (string, error) { return "access-token", nil })
+	notification.Token = "device"
+	err = n.Send(notification)
+	assert.Equal(t, &StatusError{StatusCode: 404, Reason: "NOT_FOUND"}, err)
+
+	// 인증에 실패해도 토큰을 지우지 않는다.
+	n = NewFCMNotifier(server.URL, "carrot", func() (string, error) { return "wrong", nil })
+	err = n.Send(notification)
+	assert.Error(t, err)
+	assert.NotEqual(t, ErrInvalidToken, err)
+}
@@ -0,0 +1,50 @@
+package push
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const requestTimeout = 10 * time.Second
+
+// Platform은 models.DeviceType과 같은 값을 쓴다.
+const (
+	PlatformIOS     = "IOS"
+	PlatformAndroid = "ANDROID"
+)
+
+// 기기 토큰이 만료되었거나 등록 해제되어 더 이상 보낼 수 없을 때 Notifier가 돌려준다.
+var ErrInvalidToken = errors.New("push: invalid device token")
+
+// CollapseKey가 같은 알림은 기기에서 마지막 알림 하나로 합쳐진다.
+type Notification struct {
+	Token       string
+	Title       string
+	Body        string
+	CollapseKey string
+	Data        map[string]string
+}
+
+// Notifier는 푸시 서비스 하나에 알림을 보낸다.
+type Notifier interface {
+	Send(notification Notification) error
+}
+
+// 플랫폼별 Notifier
+type Notifiers map[string]Notifier
+
+// 푸시 서비스가 돌려준 응답 중 토큰 문제가 아닌 오류
+type StatusError struct {
+	StatusCode int
+	Reason     string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("push: %d %s", e.StatusCode, e.Reason)
+}
+
+func newHTTPClient() *http.Client {
+	return &http.Client{Timeout: requestTimeout}
+}
@@ -0,0 +1,131 @@
+package push
+
+import (
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+const (
+	fcmScope = "https://www.googleapis.com/auth/firebase.messaging"
+
+	defaultGoogleTokenURI = "https://oauth2.googleapis.com/token"
+
+	// 요청 중에 만료되지 않도록 액세스 토큰을 이만큼 일찍 갱신한다.
+	accessTokenRefreshMargin = 5 * time.Minute
+	// 서명한 JWT로 액세스 토큰을 요청할 수 있는 최대 시간
+	assertionLifetime = time.Hour
+)
+
+// ServiceAccountTokenSource는 Google 서비스 계정 키로 서명한 JWT를 OAuth 액세스 토큰으로 바꾼다.
+// FCM 액세스 토큰은 한 시간 정도 지나면 만료되므로 받은 토큰을 만료 전까지 재사용하고 그 뒤에 다시 받는다.
+type ServiceAccountTokenSource struct {
+	email    string
+	keyId    string
+	key      *rsa.PrivateKey
+	tokenURI string
+	client   *http.Client
+	now      func() time.Time
+
+	mutex     sync.Mutex
+	token     string
+	expiresAt time.Time
+}
+
+// Firebase 콘솔에서 받은 서비스 계정 키 파일의 필드
+type serviceAccountKey struct {
+	ClientEmail  string `json:"client_email"`
+	PrivateKeyID string `json:"private_key_id"`
+	PrivateKey   string `json:"private_key"`
+	TokenURI     string `json:"token_uri"`
+}
+
+type googleTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+// credentials는 서비스 계정 키 파일(JSON)의 내용이다.
+func NewServiceAccountTokenSource(credentials []byte) (*ServiceAccountTokenSource, error) {
+	account := serviceAccountKey{}
+	if err := json.Unmarshal(credentials, &account); err != nil {
+		return nil, err
+	}
+	if account.ClientEmail == "" || account.PrivateKey == "" {
+		return nil, errors.New("push: client_email and private_key are required in service account credentials")
+	}
+
+	key, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(account.PrivateKey))
+	if err != nil {
+		return nil, err
+	}
+	if account.TokenURI == "" {
+		account.TokenURI = defaultGoogleTokenURI
+	}
+	return &ServiceAccountTokenSource{
+		email:    account.ClientEmail,
+		keyId:    account.PrivateKeyID,
+		key:      key,
+		tokenURI: account.TokenURI,
+		client:   newHTTPClient(),
+		now:      time.Now,
+	}, nil
+}
+
+// 캐시한 액세스 토큰이 곧 만료되면 새로 받는다. FCMNotifier의 tokenSource로 쓴다.
+func (s *ServiceAccountTokenSource) Token() (string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := s.now()
+	if s.token != "" && now.Add(accessTokenRefreshMargin).Before(s.expiresAt) {
+		return s.token, nil
+	}
+
+	assertion := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":   s.email,
+		"scope": fcmScope,
+		"aud":   s.tokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(assertionLifetime).Unix(),
+	})
+	if s.keyId != "" {
+		assertion.Header["kid"] = s.keyId
+	}
+	signed, err := assertion.SignedString(s.key)
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "urn:ietf:params:oauth:grant-type:jwt-bearer")
+	form.Set("assertion", signed)
+	response, err := s.client.Post(s.tokenURI, "application/x-www-form-urlencoded", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return "", &StatusError{StatusCode: response.StatusCode, Reason: "token exchange failed"}
+	}
+
+	result := googleTokenResponse{}
+	if err := json.NewDecoder(response.Body).Decode(&result); err != nil {
+		return "", err
+	}
+	if result.AccessToken == "" {
+		return "", errors.New("push: empty access token in token response")
+	}
+
+	s.token = result.AccessToken
+	s.expiresAt = now.Add(time.Duration(result.ExpiresIn) * time.Second)
+	return s.token, nil
+}
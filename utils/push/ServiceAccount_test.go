@@ -0,0 +1,78 @@
+package push
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServiceAccountTokenSource(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	issued := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, r.ParseForm())
+		assert.Equal(t, "urn:ietf:params:oauth:grant-type:jwt-bearer", r.PostForm.Get("grant_type"))
+
+		// 테스트에서 시각을 옮기므로 iat, exp는 검사하지 않는다.
+		claims := jwt.MapClaims{}
+		parser := &jwt.Parser{SkipClaimsValidation: true}
+		_, err := parser.ParseWithClaims(r.PostForm.Get("assertion"), &claims, func(token *jwt.Token) (interface{}, error) {
+			assert.Equal(t, "key-1", token.Header["kid"])
+			return &key.PublicKey, nil
+		})
+		if !assert.NoError(t, err) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		assert.Equal(t, "push@carrot.iam.gserviceaccount.com", claims["iss"])
+		assert.Equal(t, fcmScope, claims["scope"])
+
+		issued++
+		fmt.Fprintf(w, `{"access_token":"token-%d","expires_in":3600,"token_type":"Bearer"}`, issued)
+	}))
+	t.Cleanup(server.Close)
+
+	privateKey := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	credentials, err := json.Marshal(serviceAccountKey{
+		ClientEmail:  "push@carrot.iam.gserviceaccount.com",
+		PrivateKeyID: "key-1",
+		PrivateKey:   string(privateKey),
+		TokenURI:     server.URL,
+	})
+	assert.NoError(t, err)
+
+	s, err := NewServiceAccountTokenSource(credentials)
+	assert.NoError(t, err)
+	now := time.Now()
+	s.now = func() time.Time { return now }
+
+	token, err := s.Token()
+	assert.NoError(t, err)
+	assert.Equal(t, "token-1", token)
+
+	// 만료되기 전에는 받은 토큰을 재사용한다.
+	now = now.Add(50 * time.Minute)
+	token, err = s.Token()
+	assert.NoError(t, err)
+	assert.Equal(t, "token-1", token)
+
+	now = now.Add(6 * time.Minute)
+	token, err = s.Token()
+	assert.NoError(t, err)
+	assert.Equal(t, "token-2", token)
+
+	_, err = NewServiceAccountTokenSource([]byte(`{"client_email":"push@carrot.iam.gserviceaccount.com"}`))
+	assert.Error(t, err)
+}
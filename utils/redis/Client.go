@@ -0,0 +1,335 @@
+package redis
+
+import (
+	"bufio"
+	"errors"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	dialTimeout      = 5 * time.Second
+	subscribeTimeout = 5 * time.Second
+	reconnectBackoff = time.Second
+	messageBuffer    = 1024
+)
+
+var (
+	ErrClosed           = errors.New("redis: client is closed")
+	ErrSubscribeTimeout = errors.New("redis: subscription is not confirmed")
+)
+
+type Message struct {
+	Channel string
+	Payload []byte
+}
+
+// Client는 Redis 호환 서버와 PUBLISH/SUBSCRIBE로만 통신하는 최소한의 클라이언트이다.
+// 발행과 구독은 서로 다른 연결을 사용하며, 구독 연결이 끊기면 다시 연결해 채널을 재구독한다.
+//
+// 서버는 SUBSCRIBE를 보낸 순서대로 확인 응답을 보내므로, pending에는 채널마다
+// 구독 연결에 보낸 SUBSCRIBE의 확인을 기다리는 Subscribe 호출을 보낸 순서대로 담는다.
+type Client struct {
+	addr             string
+	password         string
+	subscribeTimeout time.Duration
+
+	pubMutex  sync.Mutex
+	pubConn   net.Conn
+	pubReader *bufio.Reader
+	pubWriter *bufio.Writer
+
+	subMutex  sync.Mutex
+	subConn   net.Conn
+	subWriter *bufio.Writer
+	channels  map[string]bool
+	pending   map[string][]subscribeWaiters
+	closed    bool
+
+	messages chan Message
+}
+
+func Dial(addr, password string) (*Client, error) {
+	c := &Client{
+		addr:             addr,
+		password:         password,
+		subscribeTimeout: subscribeTimeout,
+		channels:         make(map[string]bool),
+		pending:          make(map[string][]subscribeWaiters),
+		messages:         make(chan Message, messageBuffer),
+	}
+
+	conn, reader, err := c.dial()
+	if err != nil {
+		return nil, err
+	}
+	c.subConn = conn
+	c.subWriter = bufio.NewWriter(conn)
+
+	go c.receive(reader)
+	return c, nil
+}
+
+func (c *Client) dial() (net.Conn, *bufio.Reader, error) {
+	conn, err := net.DialTimeout("tcp", c.addr, dialTimeout)
+	if err != nil {
+		return nil, nil, err
+	}
+	reader := bufio.NewReader(conn)
+
+	if c.password != "" {
+		writer := bufio.NewWriter(conn)
+		if err := writeCommand(writer, []byte("AUTH"), []byte(c.password)); err != nil {
+			conn.Close()
+			return nil, nil, err
+		}
+		reply, err := readReply(reader)
+		if err == nil {
+			if e, ok := reply.(Error); ok {
+				err = e
+			}
+		}
+		if err != nil {
+			conn.Close()
+			return nil, nil, err
+		}
+	}
+	return conn, reader, nil
+}
+
+func (c *Client) Publish(channel string, message []byte) error {
+	c.pubMutex.Lock()
+	defer c.pubMutex.Unlock()
+
+	if c.pubConn == nil {
+		conn, reader, err := c.dial()
+		if err != nil {
+			return err
+		}
+		c.pubConn = conn
+		c.pubReader = reader
+		c.pubWriter = bufio.NewWriter(conn)
+	}
+
+	err := writeCommand(c.pubWriter, []byte("PUBLISH"), []byte(channel), message)
+	if err == nil {
+		var reply interface{}
+		reply, err = readReply(c.pubReader)
+		if e, ok := reply.(Error); ok {
+			return e
+		}
+	}
+	if err != nil {
+		c.pubConn.Close()
+		c.pubConn = nil
+	}
+	return err
+}
+
+// 하나의 SUBSCRIBE 확인을 기다리는 Subscribe 호출들. 확인되면 nil을, 구독이 취소되면 에러를 받는다.
+type subscribeWaiters []chan error
+
+func (w subscribeWaiters) done(err error) {
+	for _, waiter := range w {
+		waiter <- err
+	}
+}
+
+// 서버가 구독을 확인한 뒤에 돌아오므로, 그 뒤에 발행된 메시지는 빠짐없이 받는다.
+// 구독 연결이 끊겨 있으면 다시 연결해 재구독할 때까지 기다린다.
+// subscribeTimeout 안에 확인되지 않으면 구독을 취소하고 ErrSubscribeTimeout을 돌려준다.
+func (c *Client) Subscribe(channel string) error {
+	waiter := make(chan error, 1)
+
+	c.subMutex.Lock()
+	if c.closed {
+		c.subMutex.Unlock()
+		return ErrClosed
+	}
+	c.channels[channel] = true
+	c.pending[channel] = append(c.pending[channel], subscribeWaiters{waiter})
+
+	var err error
+	if c.subConn != nil {
+		err = writeCommand(c.subWriter, []byte("SUBSCRIBE"), []byte(channel))
+	}
+	c.subMutex.Unlock()
+
+	// 쓰기에 실패하면 receive가 연결이 끊긴 것을 알고 다시 연결해 재구독한다.
+	if err != nil {
+		log.Println("redis: subscribe failed:", err)
+	}
+
+	timer := time.NewTimer(c.subscribeTimeout)
+	defer timer.Stop()
+	select {
+	case err = <-waiter:
+		return err
+	case <-timer.C:
+		c.Unsubscribe(channel)
+		return ErrSubscribeTimeout
+	}
+}
+
+// 구독 연결이 끊겨 있으면 채널 목록만 바꾸고, 다시 연결할 때 재구독하지 않는다.
+func (c *Client) Unsubscribe(channel string) error {
+	c.subMutex.Lock()
+	defer c.subMutex.Unlock()
+
+	if c.closed {
+		return ErrClosed
+	}
+	delete(c.channels, channel)
+
+	if c.subConn == nil {
+		return nil
+	}
+	return writeCommand(c.subWriter, []byte("UNSUBSCRIBE"), []byte(channel))
+}
+
+// 서버가 channel의 SUBSCRIBE를 확인했다. 가장 먼저 보낸 SUBSCRIBE를 기다리는 호출들을 깨운다.
+func (c *Client) confirm(channel string) {
+	c.subMutex.Lock()
+	defer c.subMutex.Unlock()
+
+	queue := c.pending[channel]
+	if len(queue) == 0 {
+		return
+	}
+	queue[0].done(nil)
+	if len(queue) == 1 {
+		delete(c.pending, channel)
+	} else {
+		c.pending[channel] = queue[1:]
+	}
+}
+
+func (c *Client) Messages() <-chan Message {
+	return c.messages
+}
+
+func (c *Client) Close() error {
+	c.subMutex.Lock()
+	c.closed = true
+	if c.subConn != nil {
+		c.subConn.Close()
+	}
+	for channel, queue := range c.pending {
+		for _, waiters := range queue {
+			waiters.done(ErrClosed)
+		}
+		delete(c.pending, channel)
+	}
+	c.subMutex.Unlock()
+
+	c.pubMutex.Lock()
+	defer c.pubMutex.Unlock()
+	if c.pubConn != nil {
+		c.pubConn.Close()
+		c.pubConn = nil
+	}
+	return nil
+}
+
+func (c *Client) receive(reader *bufio.Reader) {
+	defer close(c.messages)
+
+	for {
+		reply, err := readReply(reader)
+		if err != nil {
+			if reader = c.reconnect(err); reader == nil {
+				return
+			}
+			continue
+		}
+
+		// ["message", channel, payload]와 ["subscribe", channel, count] 외의 응답은 무시한다.
+		items, ok := reply.([]interface{})
+		if !ok || len(items) != 3 {
+			continue
+		}
+		kind, _ := items[0].([]byte)
+		channel, _ := items[1].([]byte)
+		switch string(kind) {
+		case "message":
+			payload, _ := items[2].([]byte)
+			c.messages <- Message{Channel: string(channel), Payload: payload}
+		case "subscribe":
+			c.confirm(string(channel))
+		}
+	}
+}
+
+// 클라이언트가 닫혔으면 nil을 돌려준다.
+func (c *Client) reconnect(cause error) *bufio.Reader {
+	c.subMutex.Lock()
+	if c.subConn != nil {
+		c.subConn.Close()
+		c.subConn = nil
+	}
+	closed := c.closed
+	c.subMutex.Unlock()
+
+	if closed {
+		return nil
+	}
+	log.Println("redis: subscription connection lost:", cause)
+
+	for {
+		time.Sleep(reconnectBackoff)
+
+		conn, reader, err := c.dial()
+
+		c.subMutex.Lock()
+		if c.closed {
+			c.subMutex.Unlock()
+			if conn != nil {
+				conn.Close()
+			}
+			return nil
+		}
+		if err != nil {
+			c.subMutex.Unlock()
+			log.Println("redis: reconnect failed:", err)
+			continue
+		}
+
+		writer := bufio.NewWriter(conn)
+		for channel := range c.channels {
+			if err = writeCommand(writer, []byte("SUBSCRIBE"), []byte(channel)); err != nil {
+				break
+			}
+		}
+		if err != nil {
+			c.subMutex.Unlock()
+			conn.Close()
+			continue
+		}
+		c.subConn = conn
+		c.subWriter = writer
+		c.resetPending()
+		c.subMutex.Unlock()
+		return reader
+	}
+}
+
+// 끊긴 연결에 보낸 SUBSCRIBE는 확인되지 않으므로, 새 연결에서 채널마다 한 번 보낸
+// SUBSCRIBE의 확인을 함께 기다리게 한다. 그 사이 구독을 취소한 채널의 호출은 실패시킨다.
+// subMutex를 잡은 상태에서 호출한다.
+func (c *Client) resetPending() {
+	for channel, queue := range c.pending {
+		merged := subscribeWaiters{}
+		for _, waiters := range queue {
+			merged = append(merged, waiters...)
+		}
+
+		if c.channels[channel] {
+			c.pending[channel] = []subscribeWaiters{merged}
+		} else {
+			merged.done(ErrSubscribeTimeout)
+			delete(c.pending, channel)
+		}
+	}
+}
@@ -0,0 +1,261 @@
+package redis
+
+import (
+	"bufio"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeServer는 AUTH, PUBLISH, SUBSCRIBE, UNSUBSCRIBE만 지원하는 Redis 호환 서버이다.
+type fakeServer struct {
+	listener    net.Listener
+	password    string
+	mutex       sync.Mutex
+	conns       map[net.Conn]*bufio.Writer
+	subscribers map[string]map[net.Conn]bool
+	// true이면 SUBSCRIBE를 처리하지만 확인 응답을 보내지 않는다.
+	silent bool
+}
+
+func newFakeServer(t *testing.T, password string) *fakeServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeServer{
+		listener:    listener,
+		password:    password,
+		conns:       make(map[net.Conn]*bufio.Writer),
+		subscribers: make(map[string]map[net.Conn]bool),
+	}
+	go s.serve()
+	t.Cleanup(func() { listener.Close() })
+	return s
+}
+
+func (s *fakeServer) addr() string {
+	return s.listener.Addr().String()
+}
+
+func (s *fakeServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mutex.Lock()
+		s.conns[conn] = bufio.NewWriter(conn)
+		s.mutex.Unlock()
+		go s.handle(conn)
+	}
+}
+
+func (s *fakeServer) handle(conn net.Conn) {
+	defer s.drop(conn)
+
+	reader := bufio.NewReader(conn)
+	for {
+		reply, err := readReply(reader)
+		if err != nil {
+			return
+		}
+		items, _ := reply.([]interface{})
+		args := make([]string, len(items))
+		for i, item := range items {
+			b, _ := item.([]byte)
+			args[i] = string(b)
+		}
+
+		s.mutex.Lock()
+		w := s.conns[conn]
+		switch strings.ToUpper(args[0]) {
+		case "AUTH":
+			if args[1] == s.password {
+				w.WriteString("+OK\r\n")
+			} else {
+				w.WriteString("-ERR invalid password\r\n")
+			}
+			w.Flush()
+		case "SUBSCRIBE":
+			if _, ok := s.subscribers[args[1]]; !ok {
+				s.subscribers[args[1]] = make(map[net.Conn]bool)
+			}
+			s.subscribers[args[1]][conn] = true
+			if !s.silent {
+				w.WriteString("*3\r\n$9\r\nsubscribe\r\n$" + strconv.Itoa(len(args[1])) + "\r\n" + args[1] + "\r\n:1\r\n")
+				w.Flush()
+			}
+		case "UNSUBSCRIBE":
+			delete(s.subscribers[args[1]], conn)
+			writeCommand(w, []byte("unsubscribe"), []byte(args[1]), []byte("0"))
+		case "PUBLISH":
+			for subscriber := range s.subscribers[args[1]] {
+				writeCommand(s.conns[subscriber], []byte("message"), []byte(args[1]), []byte(args[2]))
+			}
+			w.WriteString(":1\r\n")
+			w.Flush()
+		}
+		s.mutex.Unlock()
+	}
+}
+
+func (s *fakeServer) drop(conn net.Conn) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	conn.Close()
+	delete(s.conns, conn)
+	for _, subscribers := range s.subscribers {
+		delete(subscribers, conn)
+	}
+}
+
+func (s *fakeServer) subscriberCount(channel string) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.subscribers[channel])
+}
+
+// 서버 재시작처럼 모든 연결을 끊는다.
+func (s *fakeServer) disconnectAll() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+}
+
+func receiveMessage(t *testing.T, c *Client) Message {
+	t.Helper()
+	select {
+	case message := <-c.Messages():
+		return message
+	case <-time.After(2 * time.Second):
+		t.Fatal("message not received")
+	}
+	return Message{}
+}
+
+func TestClientPubSub(t *testing.T) {
+	s := newFakeServer(t, "")
+
+	subscriber, err := Dial(s.addr(), "")
+	assert.NoError(t, err)
+	defer subscriber.Close()
+	publisher, err := Dial(s.addr(), "")
+	assert.NoError(t, err)
+	defer publisher.Close()
+
+	// 구독이 확인된 뒤에 돌아오므로 바로 발행한 메시지도 받는다.
+	assert.NoError(t, subscriber.Subscribe("chat:chatroom:1"))
+	assert.Equal(t, 1, s.subscriberCount("chat:chatroom:1"))
+
+	assert.NoError(t, publisher.Publish("chat:chatroom:1", []byte("hello\r\nworld")))
+	assert.NoError(t, publisher.Publish("chat:chatroom:2", []byte("ignored")))
+	message := receiveMessage(t, subscriber)
+	assert.Equal(t, "chat:chatroom:1", message.Channel)
+	assert.Equal(t, "hello\r\nworld", string(message.Payload))
+
+	assert.NoError(t, subscriber.Unsubscribe("chat:chatroom:1"))
+	assert.Eventually(t, func() bool {
+		return s.subscriberCount("chat:chatroom:1") == 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestClientAuth(t *testing.T) {
+	s := newFakeServer(t, "secret")
+
+	_, err := Dial(s.addr(), "wrong")
+	assert.Equal(t, Error("ERR invalid password"), err)
+
+	c, err := Dial(s.addr(), "secret")
+	assert.NoError(t, err)
+	assert.NoError(t, c.Publish("chat:chatroom:1", []byte("hello")))
+	c.Close()
+}
+
+func TestClientReconnect(t *testing.T) {
+	s := newFakeServer(t, "")
+
+	c, err := Dial(s.addr(), "")
+	assert.NoError(t, err)
+	defer c.Close()
+	assert.NoError(t, c.Subscribe("chat:chatroom:1"))
+	assert.Eventually(t, func() bool {
+		return s.subscriberCount("chat:chatroom:1") == 1
+	}, time.Second, 10*time.Millisecond)
+
+	s.disconnectAll()
+	assert.Eventually(t, func() bool {
+		return s.subscriberCount("chat:chatroom:1") == 0
+	}, time.Second, 10*time.Millisecond)
+
+	// 다시 연결되면 이전에 구독한 채널을 재구독한다.
+	assert.Eventually(t, func() bool {
+		return s.subscriberCount("chat:chatroom:1") == 1
+	}, 3*time.Second, 10*time.Millisecond)
+
+	// 발행 연결도 끊겼으므로 첫 시도는 실패할 수 있다.
+	if err := c.Publish("chat:chatroom:1", []byte("after reconnect")); err != nil {
+		assert.NoError(t, c.Publish("chat:chatroom:1", []byte("after reconnect")))
+	}
+	assert.Equal(t, "after reconnect", string(receiveMessage(t, c).Payload))
+}
+
+// 연결이 끊긴 동안 구독하면 다시 연결해 재구독이 확인될 때까지 기다린다.
+func TestClientSubscribeWhileReconnecting(t *testing.T) {
+	s := newFakeServer(t, "")
+
+	c, err := Dial(s.addr(), "")
+	assert.NoError(t, err)
+	defer c.Close()
+	assert.NoError(t, c.Subscribe("chat:chatroom:1"))
+
+	s.disconnectAll()
+	assert.Eventually(t, func() bool {
+		c.subMutex.Lock()
+		defer c.subMutex.Unlock()
+		return c.subConn == nil
+	}, time.Second, 10*time.Millisecond)
+
+	assert.NoError(t, c.Subscribe("chat:chatroom:2"))
+	assert.Equal(t, 1, s.subscriberCount("chat:chatroom:2"))
+	assert.Equal(t, 1, s.subscriberCount("chat:chatroom:1"))
+}
+
+func TestClientSubscribeTimeout(t *testing.T) {
+	s := newFakeServer(t, "")
+	s.silent = true
+
+	c, err := Dial(s.addr(), "")
+	assert.NoError(t, err)
+	defer c.Close()
+	c.subscribeTimeout = 50 * time.Millisecond
+
+	assert.Equal(t, ErrSubscribeTimeout, c.Subscribe("chat:chatroom:1"))
+	assert.Eventually(t, func() bool {
+		return s.subscriberCount("chat:chatroom:1") == 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestClientClose(t *testing.T) {
+	s := newFakeServer(t, "")
+
+	c, err := Dial(s.addr(), "")
+	assert.NoError(t, err)
+	c.Close()
+
+	select {
+	case _, ok := <-c.Messages():
+		assert.False(t, ok)
+	case <-time.After(time.Second):
+		t.Fatal("messages channel is not closed")
+	}
+	assert.Equal(t, ErrClosed, c.Subscribe("chat:chatroom:1"))
+}
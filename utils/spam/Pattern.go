@@ -0,0 +1,47 @@
+package spam
+
+import (
+	"regexp"
+	"strings"
+)
+
+// 거래를 외부 메신저로 옮기자고 유도할 때 자주 쓰는 표현
+var messengerPattern = regexp.MustCompile(
+	`(?i)카카오\s*톡|카톡|오픈\s*채팅|open\.kakao\.com|kakao\s*talk|텔레그램|telegram|t\.me/|` +
+		`라인\s*(아이디|id)|line\s*id|위챗|wechat|왓츠앱|whats\s*app`,
+)
+
+// 하이픈이나 공백으로 나뉜 숫자 묶음
+var numberPattern = regexp.MustCompile(`\d[\d\- ]{8,}\d`)
+
+var bankPattern = regexp.MustCompile(
+	`계좌|입금|송금|은행|뱅크|국민|신한|우리|하나|농협|기업|새마을|우체국|수협|신협|[Bb]ank`,
+)
+
+// 계좌번호로 보는 숫자 자릿수
+const (
+	minAccountDigits = 10
+	maxAccountDigits = 16
+)
+
+// 메시지에 카카오톡 아이디, 오픈채팅 링크처럼 외부 메신저로 연락하자는 내용이 있는지 확인한다.
+func ContainsMessengerID(content string) bool {
+	return messengerPattern.MatchString(content)
+}
+
+// 메시지에 계좌번호로 보이는 숫자가 있는지 확인한다.
+// 휴대폰 번호(01로 시작하는 11자리 이하)는 은행이나 입금을 함께 말할 때만 계좌번호로 본다.
+func ContainsBankAccount(content string) bool {
+	mentionsBank := bankPattern.MatchString(content)
+	for _, match := range numberPattern.FindAllString(content, -1) {
+		digits := strings.NewReplacer("-", "", " ", "").Replace(match)
+		if len(digits) < minAccountDigits || len(digits) > maxAccountDigits {
+			continue
+		}
+		if strings.HasPrefix(digits, "01") && len(digits) <= 11 && !mentionsBank {
+			continue
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,51 @@
+package spam_test
+
+import (
+	"testing"
+
+	"carrot-market-clone-api/utils/spam"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContainsMessengerID(t *testing.T) {
+	for _, content := range []string{
+		"카톡 아이디 carrot123 으로 연락주세요",
+		"카카오 톡으로 얘기해요",
+		"https://open.kakao.com/o/abcdef 여기로 오세요",
+		"Telegram @carrot",
+		"t.me/carrot",
+		"라인 아이디 알려드릴게요",
+	} {
+		assert.True(t, spam.ContainsMessengerID(content), content)
+	}
+
+	for _, content := range []string{
+		"안녕하세요, 아직 판매 중인가요?",
+		"내일 오후 3시에 역 앞에서 뵐게요",
+		"라인이 예쁘네요",
+	} {
+		assert.False(t, spam.ContainsMessengerID(content), content)
+	}
+}
+
+func TestContainsBankAccount(t *testing.T) {
+	for _, content := range []string{
+		"국민 123456-01-234567 로 입금해주세요",
+		"110-123-456789 신한입니다",
+		"계좌 3333012345678 입니다",
+		"우리은행 1002 123 456789",
+		"입금은 010-1234-5678 계좌로 해주세요",
+	} {
+		assert.True(t, spam.ContainsBankAccount(content), content)
+	}
+
+	for _, content := range []string{
+		"30000원에 드릴게요",
+		"제 번호는 010-1234-5678 이에요",
+		"2022-01-01 에 샀어요",
+		"1,500,000원 입금 가능할까요?",
+	} {
+		assert.False(t, spam.ContainsBankAccount(content), content)
+	}
+}
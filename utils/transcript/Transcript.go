@@ -0,0 +1,131 @@
+package transcript
+
+import (
+	"carrot-market-clone-api/models"
+	"encoding/json"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	texttemplate "text/template"
+	"time"
+)
+
+const timeFormat = "2006-01-02 15:04:05 MST"
+
+const textLayout = `채팅방 #{{.ChatroomID}} 대화 내용
+상품: {{.Product.Title}} (#{{.Product.ID}})
+판매자: {{participant .Seller}}
+구매자: {{participant .Buyer}}
+내보낸 시각: {{time .ExportedAt}}
+{{range .Chats}}
+[{{time .SendDate}}] {{sender .}}: {{message .}}{{end}}
+`
+
+const htmlLayout = `<!DOCTYPE html>
+<html lang="ko">
+<head>
+<meta charset="utf-8">
+<title>채팅방 #{{.ChatroomID}} 대화 내용</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+dt { font-weight: bold; }
+table { border-collapse: collapse; width: 100%; }
+th, td { border: 1px solid #ddd; padding: 4px 8px; text-align: left; vertical-align: top; }
+td.message { white-space: pre-wrap; }
+</style>
+</head>
+<body>
+<h1>채팅방 #{{.ChatroomID}} 대화 내용</h1>
+<dl>
+<dt>상품</dt><dd>{{.Product.Title}} (#{{.Product.ID}})</dd>
+<dt>판매자</dt><dd>{{participant .Seller}}</dd>
+<dt>구매자</dt><dd>{{participant .Buyer}}</dd>
+<dt>내보낸 시각</dt><dd>{{time .ExportedAt}}</dd>
+</dl>
+<table>
+<thead><tr><th>시각</th><th>보낸 사람</th><th>메시지</th></tr></thead>
+<tbody>
+{{- range .Chats}}
+<tr><td>{{time .SendDate}}</td><td>{{sender .}}</td><td class="message">{{message .}}</td></tr>
+{{- end}}
+</tbody>
+</table>
+</body>
+</html>
+`
+
+// 대화 내용을 사람이 읽을 수 있는 텍스트로 쓴다.
+func WriteText(w io.Writer, t *models.Transcript) error {
+	tmpl, err := texttemplate.New("transcript").Funcs(funcs(t)).Parse(textLayout)
+	if err != nil {
+		return err
+	}
+	return tmpl.Execute(w, t)
+}
+
+// 대화 내용을 브라우저에서 열거나 인쇄할 수 있는 HTML 문서로 쓴다. 메시지 내용은 이스케이프한다.
+func WriteHTML(w io.Writer, t *models.Transcript) error {
+	tmpl, err := htmltemplate.New("transcript").Funcs(funcs(t)).Parse(htmlLayout)
+	if err != nil {
+		return err
+	}
+	return tmpl.Execute(w, t)
+}
+
+func funcs(t *models.Transcript) map[string]interface{} {
+	return map[string]interface{}{
+		"time": func(at time.Time) string {
+			return at.Format(timeFormat)
+		},
+		"participant": func(user models.ChatUser) string {
+			return fmt.Sprintf("%s (%s)", user.Nickname, user.UserID)
+		},
+		"sender": func(chat models.Chat) string {
+			return sender(t, chat)
+		},
+		"message": message,
+	}
+}
+
+// 탈퇴 등으로 별칭을 알 수 없으면 사용자 ID로 보여준다.
+func sender(t *models.Transcript, chat models.Chat) string {
+	name := t.Nickname(chat.UserID)
+	if name == "" {
+		name = chat.UserID
+	}
+
+	switch chat.Role {
+	case models.SELLER:
+		return name + "(판매자)"
+	case models.BUYER:
+		return name + "(구매자)"
+	}
+	return name
+}
+
+// 메시지 종류에 따라 내용을 한 줄로 나타내고 수정, 취소 여부를 붙인다.
+// 취소된 메시지의 페이로드를 가렸으면 가린 내용만 보여준다.
+func message(chat models.Chat) string {
+	text := chat.Content
+	switch chat.Type {
+	case models.IMAGE:
+		payload := models.ImagePayload{}
+		if err := json.Unmarshal(chat.Payload, &payload); err == nil {
+			text = "[사진] " + payload.URL
+		}
+	case models.LOCATION:
+		payload := models.LocationPayload{}
+		if err := json.Unmarshal(chat.Payload, &payload); err == nil {
+			text = fmt.Sprintf("[위치] %s (%g, %g)", chat.Content, payload.Latitude, payload.Longitude)
+		}
+	case models.SYSTEM:
+		text = "[알림] " + chat.Content
+	}
+
+	if chat.DeletedAt != nil {
+		text += fmt.Sprintf(" (%s 취소됨)", chat.DeletedAt.Format(timeFormat))
+	} else if chat.EditedAt != nil {
+		text += fmt.Sprintf(" (%s 수정됨)", chat.EditedAt.Format(timeFormat))
+	}
+	return text
+}
@@ -0,0 +1,62 @@
+package transcript_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"carrot-market-clone-api/models"
+	"carrot-market-clone-api/utils/transcript"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTranscript() *models.Transcript {
+	at := func(minute int) time.Time {
+		return time.Date(2022, 1, 1, 12, minute, 0, 0, time.UTC)
+	}
+	editedAt, deletedAt := at(3), at(4)
+
+	return &models.Transcript{
+		ChatroomID: 1,
+		Product:    models.Product{ID: 7, Title: "자전거"},
+		Seller:     models.ChatUser{UserID: "seller", Nickname: "당근"},
+		Buyer:      models.ChatUser{UserID: "buyer", Nickname: "<b>구매</b>"},
+		Chats: []models.Chat{
+			{ID: 1, UserID: "buyer", Role: models.BUYER, Type: models.TEXT, Content: "구매 가능한가요?", SendDate: at(0), EditedAt: &editedAt},
+			{ID: 2, UserID: "seller", Role: models.SELLER, Type: models.IMAGE, Payload: []byte(`{"url":"https://example.com/1.png"}`), SendDate: at(1)},
+			{ID: 3, UserID: "seller", Role: models.SELLER, Type: models.LOCATION, Content: "역 앞", Payload: []byte(`{"latitude":37.5,"longitude":127}`), SendDate: at(2)},
+			{ID: 4, UserID: "buyer", Role: models.BUYER, Type: models.IMAGE, Content: models.DeletedChatContent, SendDate: at(3), DeletedAt: &deletedAt},
+			{ID: 5, UserID: "left", Role: models.BUYER, Type: models.SYSTEM, Content: models.LeaveChatContent, Payload: []byte(`{"event":"LEAVE"}`), SendDate: at(5)},
+		},
+		ExportedAt: at(10),
+	}
+}
+
+func TestWriteText(t *testing.T) {
+	buf := &bytes.Buffer{}
+	assert.NoError(t, transcript.WriteText(buf, newTranscript()))
+	assert.Equal(t, `채팅방 #1 대화 내용
+상품: 자전거 (#7)
+판매자: 당근 (seller)
+구매자: <b>구매</b> (buyer)
+내보낸 시각: 2022-01-01 12:10:00 UTC
+
+[2022-01-01 12:00:00 UTC] <b>구매</b>(구매자): 구매 가능한가요? (2022-01-01 12:03:00 UTC 수정됨)
+[2022-01-01 12:01:00 UTC] 당근(판매자): [사진] https://example.com/1.png
+[2022-01-01 12:02:00 UTC] 당근(판매자): [위치] 역 앞 (37.5, 127)
+[2022-01-01 12:03:00 UTC] <b>구매</b>(구매자): 삭제된 메시지입니다. (2022-01-01 12:04:00 UTC 취소됨)
+[2022-01-01 12:05:00 UTC] left(구매자): [알림] 상대방이 채팅방을 나갔습니다.
+`, buf.String())
+}
+
+func TestWriteHTML(t *testing.T) {
+	buf := &bytes.Buffer{}
+	assert.NoError(t, transcript.WriteHTML(buf, newTranscript()))
+
+	html := buf.String()
+	assert.Contains(t, html, "<title>채팅방 #1 대화 내용</title>")
+	assert.Contains(t, html, "<dd>&lt;b&gt;구매&lt;/b&gt; (buyer)</dd>")
+	assert.Contains(t, html, `<tr><td>2022-01-01 12:01:00 UTC</td><td>당근(판매자)</td><td class="message">[사진] https://example.com/1.png</td></tr>`)
+	assert.NotContains(t, html, "<b>구매</b>")
+}